@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+const usage = `Usage: gogentctl [-nats url] <command> [args]
+
+Commands:
+  dlq list [-limit n]          List dead-lettered logs
+  dlq show <seq>               Show a dead-lettered log and its failure details
+  dlq redrive [-all] [seq...]  Republish dead-lettered logs to their original subject
+  feedback submit [-rating n] [-correction text] [-resolution text] [-author name] <log-id>
+                               Rate a log's analysis 1-5, correct it or record what fixed it
+  feedback list [-limit n] [log-id]
+                               List feedback, on one log or on all of them
+  logs query [-since dur] [-from time] [-to time] [-host name] [-service name] [-severity level]
+             [-text words] [-incident id] [-asc] [-limit n] [-cursor c] [-json]
+                               Query stored logs and their analyses, newest first
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gogentctl: ")
+
+	natsURL := flag.String("nats", envOr("NATS_URL", shared.NATSURL), "NATS server URL")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	nc, err := nats.Connect(*natsURL)
+	if err != nil {
+		log.Fatalf("failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		log.Fatalf("failed to create JetStream context: %v", err)
+	}
+
+	switch args[0] {
+	case "dlq":
+		err = runDLQ(js, args[1], args[2:])
+	case "feedback":
+		err = runFeedback(nc, args[1], args[2:])
+	case "logs":
+		err = runLogs(nc, args[1], args[2:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runDLQ(js nats.JetStreamContext, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("dlq list", flag.ExitOnError)
+		limit := fs.Int("limit", 50, "maximum number of entries to list")
+		fs.Parse(args)
+
+		entries, err := agent.ListDLQ(js, *limit)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tFAILED AT\tREASON\tATTEMPTS\tPROVIDER\tERROR")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", e.Seq, e.Entry.FailedAt.Format("2006-01-02 15:04:05"),
+				e.Entry.Reason, e.Entry.Attempts, e.Entry.Provider, truncate(e.Entry.Error, 80))
+		}
+		return w.Flush()
+
+	case "show":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: gogentctl dlq show <seq>")
+		}
+		seq, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid sequence %q: %v", args[0], err)
+		}
+		entry, err := agent.GetDLQEntry(js, seq)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sequence:   %d\n", seq)
+		fmt.Printf("Subject:    %s\n", entry.Subject)
+		fmt.Printf("Stream seq: %d\n", entry.StreamSeq)
+		fmt.Printf("Failed at:  %s\n", entry.FailedAt.Format("2006-01-02 15:04:05 MST"))
+		fmt.Printf("Reason:     %s\n", entry.Reason)
+		fmt.Printf("Attempts:   %d\n", entry.Attempts)
+		fmt.Printf("Provider:   %s\n", entry.Provider)
+		fmt.Printf("Error:      %s\n", entry.Error)
+		fmt.Printf("Payload:\n%s\n", printable(entry.Payload))
+		return nil
+
+	case "redrive":
+		fs := flag.NewFlagSet("dlq redrive", flag.ExitOnError)
+		all := fs.Bool("all", false, "redrive every entry in the DLQ")
+		fs.Parse(args)
+
+		var seqs []uint64
+		if *all {
+			entries, err := agent.ListDLQ(js, 0)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				seqs = append(seqs, e.Seq)
+			}
+		}
+		for _, arg := range fs.Args() {
+			seq, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid sequence %q: %v", arg, err)
+			}
+			seqs = append(seqs, seq)
+		}
+		if len(seqs) == 0 {
+			return fmt.Errorf("usage: gogentctl dlq redrive [-all] [seq...]")
+		}
+
+		for _, seq := range seqs {
+			if err := agent.RedriveDLQ(js, seq); err != nil {
+				return err
+			}
+			fmt.Printf("Redrove DLQ entry %d\n", seq)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown dlq command %q", cmd)
+	}
+}
+
+func runFeedback(nc *nats.Conn, cmd string, args []string) error {
+	switch cmd {
+	case "submit":
+		fs := flag.NewFlagSet("feedback submit", flag.ExitOnError)
+		rating := fs.Int("rating", 0, "rating of the analysis from 1 (wrong) to 5 (spot on)")
+		correction := fs.String("correction", "", "what the analysis should have said")
+		resolution := fs.String("resolution", "", "what actually fixed the problem")
+		author := fs.String("author", os.Getenv("USER"), "who is giving the feedback")
+		fs.Parse(args)
+
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: gogentctl feedback submit [-rating n] [-correction text] [-resolution text] [-author name] <log-id>")
+		}
+		logID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid log ID %q: %v", fs.Arg(0), err)
+		}
+
+		reply, err := agent.SubmitFeedback(nc, agent.FeedbackRequest{
+			LogID:      logID,
+			Rating:     *rating,
+			Correction: *correction,
+			Resolution: *resolution,
+			Author:     *author,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored feedback %d on log %d\n", reply.ID, logID)
+		if reply.Withdrawn {
+			fmt.Println("The analysis will no longer be reused for similar logs")
+		}
+		return nil
+
+	case "list":
+		fs := flag.NewFlagSet("feedback list", flag.ExitOnError)
+		limit := fs.Int("limit", shared.FeedbackLimit, "maximum number of entries to list")
+		fs.Parse(args)
+
+		var query agent.FeedbackQuery
+		query.Limit = *limit
+		if fs.NArg() > 0 {
+			logID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid log ID %q: %v", fs.Arg(0), err)
+			}
+			query.LogID = logID
+		}
+
+		feedback, err := agent.ListFeedback(nc, query)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tLOG\tCREATED AT\tRATING\tAUTHOR\tCORRECTION\tRESOLUTION")
+		for _, f := range feedback {
+			rating := "-"
+			if f.Rating > 0 {
+				rating = strconv.Itoa(f.Rating)
+			}
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n", f.ID, f.LogID, f.CreatedAt.Format("2006-01-02 15:04:05"),
+				rating, f.Author, truncate(f.Correction, 60), truncate(f.Resolution, 60))
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown feedback command %q", cmd)
+	}
+}
+
+func runLogs(nc *nats.Conn, cmd string, args []string) error {
+	if cmd != "query" {
+		return fmt.Errorf("unknown logs command %q", cmd)
+	}
+
+	fs := flag.NewFlagSet("logs query", flag.ExitOnError)
+	since := fs.Duration("since", 0, "only logs stored within this long, e.g. 2h")
+	from := fs.String("from", "", "only logs stored at or after this RFC 3339 time")
+	to := fs.String("to", "", "only logs stored before this RFC 3339 time")
+	host := fs.String("host", "", "only logs from this hostname")
+	service := fs.String("service", "", "only logs from this service")
+	severity := fs.String("severity", "", "only logs of this severity")
+	text := fs.String("text", "", "only logs containing all of these words")
+	incident := fs.Int64("incident", 0, "only logs correlated into this incident")
+	asc := fs.Bool("asc", false, "oldest first")
+	limit := fs.Int("limit", shared.QueryLimit, "maximum number of entries to list")
+	cursor := fs.String("cursor", "", "continue from a previous page")
+	asJSON := fs.Bool("json", false, "print the reply as JSON")
+	fs.Parse(args)
+
+	query := agent.LogQuery{
+		From:       *from,
+		To:         *to,
+		Hostname:   *host,
+		Service:    *service,
+		Severity:   *severity,
+		Text:       *text,
+		IncidentID: *incident,
+		Cursor:     *cursor,
+		Limit:      *limit,
+	}
+	if *since > 0 && query.From == "" {
+		query.From = time.Now().Add(-*since).Format(time.RFC3339)
+	}
+	if *asc {
+		query.Order = "asc"
+	}
+
+	reply, err := agent.QueryLogs(nc, query)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reply)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIMESTAMP\tHOST\tSERVICE\tSEVERITY\tRISK\tMESSAGE\tSUMMARY")
+	for _, e := range reply.Entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, e.Timestamp, e.Hostname, e.Service, e.Severity,
+			e.RiskScore, truncate(e.Message, 60), truncate(e.Summary, 60))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if reply.NextCursor != "" {
+		fmt.Printf("More entries: -cursor %s\n", reply.NextCursor)
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// truncate shortens s to at most n bytes, cutting on a rune boundary
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+func printable(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return fmt.Sprintf("%q", data)
+}
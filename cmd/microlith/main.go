@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
 	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/embed"
 	embeddednats "github.com/tobalo/gogent/pkg/embeddednats"
+	"github.com/tobalo/gogent/pkg/httpapi"
+	"github.com/tobalo/gogent/pkg/ingest"
 	"github.com/tobalo/gogent/pkg/shared"
 )
 
@@ -25,7 +34,11 @@ func main() {
 
 	// Initialize embedded NATS server
 	log.Println("Starting embedded NATS server...")
-	natsService, err := embeddednats.NewNatsService(shared.NATSPort)
+	natsOpts, err := natsOptions()
+	if err != nil {
+		log.Fatalf("Invalid MQTT configuration: %v", err)
+	}
+	natsService, err := embeddednats.NewNatsService(shared.NATSPort, natsOpts)
 	if err != nil {
 		log.Fatalf("Failed to create NATS service: %v", err)
 	}
@@ -50,6 +63,16 @@ func main() {
 		model = shared.AgentModel
 	}
 
+	embedder, err := newEmbedder(os.Getenv("EMBEDDER"))
+	if err != nil {
+		log.Fatalf("Invalid EMBEDDER: %v", err)
+	}
+
+	providers, err := parseProviders(os.Getenv("PROVIDERS"), envDuration("PROVIDER_TIMEOUT", shared.AnalysisTimeout))
+	if err != nil {
+		log.Fatalf("Invalid PROVIDERS: %v", err)
+	}
+
 	// Initialize agent service
 	log.Printf("Initializing agent service with %s provider...", provider)
 	agentService, err := agent.NewService(agent.Config{
@@ -59,12 +82,71 @@ func main() {
 		Instructions: shared.AgentInstructions,
 		Model:        model,
 		Provider:     provider,
+		AckWait:      envDuration("ACK_WAIT", shared.AckWait),
+		MaxDeliver:   envInt("MAX_DELIVER", shared.MaxDeliver),
+		Workers:      envInt("WORKERS", shared.Workers),
+		MaxInFlight:  envInt("MAX_IN_FLIGHT", 0),
+		BatchSize:    envInt("BATCH_SIZE", 0),
+		BatchDelay:   envDuration("BATCH_DELAY", shared.BatchDelay),
+		MockScript:   os.Getenv("MOCK_SCRIPT"),
+
+		Providers:        providers,
+		BreakerThreshold: envInt("BREAKER_THRESHOLD", shared.BreakerThreshold),
+		BreakerCooldown:  envDuration("BREAKER_COOLDOWN", shared.BreakerCooldown),
+
+		PromptDir:    os.Getenv("PROMPT_DIR"),
+		PromptBucket: os.Getenv("PROMPT_BUCKET"),
+		PromptReload: envDuration("PROMPT_RELOAD", shared.PromptReload),
+
+		CacheTTL:         envDuration("CACHE_TTL", shared.CacheTTL),
+		CacheIncludeHost: os.Getenv("CACHE_INCLUDE_HOST") == "true",
+
+		TemplateReuse:      os.Getenv("TEMPLATE_REUSE") != "false",
+		TemplateSimilarity: envFloat("TEMPLATE_SIMILARITY", shared.TemplateSimilarity),
+		TemplateLimit:      envInt("TEMPLATE_LIMIT", shared.TemplateLimit),
+
+		ClusterReuse:     os.Getenv("CLUSTER_REUSE") != "false",
+		ClusterThreshold: envFloat("CLUSTER_THRESHOLD", shared.ClusterThreshold),
+		ClusterLimit:     envInt("CLUSTER_LIMIT", shared.ClusterLimit),
+
+		AnomalyWindow:    envDuration("ANOMALY_WINDOW", shared.AnomalyWindow),
+		AnomalyThreshold: envFloat("ANOMALY_THRESHOLD", shared.AnomalyThreshold),
+
+		IncidentWindow:   envDuration("INCIDENT_WINDOW", shared.IncidentWindow),
+		IncidentQuiet:    envDuration("INCIDENT_QUIET", shared.IncidentQuiet),
+		IncidentMinLogs:  envInt("INCIDENT_MIN_LOGS", shared.IncidentMinLogs),
+		HostGroupPattern: os.Getenv("INCIDENT_HOST_GROUP"),
+
+		HistoryResults: envInt("HISTORY_RESULTS", shared.HistoryResults),
+		Embedder:       embedder,
 	})
 	if err != nil {
 		log.Fatalf("Failed to create agent service: %v", err)
 	}
 	defer agentService.Stop()
 
+	// Client connection for the HTTP API and the ingest listeners
+	nc, err := nats.Connect(shared.NATSURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to NATS: %v", err)
+	}
+	defer nc.Close()
+
+	// Serve the optional HTTP API for clients that cannot speak NATS, listening before the agent
+	// starts so a bad address fails startup before any message is taken
+	var httpServer *httpapi.Server
+	var httpErrs <-chan error
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		httpServer, err = httpapi.NewServer(addr, nc)
+		if err != nil {
+			log.Fatalf("Failed to create HTTP API: %v", err)
+		}
+		if err := httpServer.Start(); err != nil {
+			log.Fatalf("Failed to start HTTP API: %v", err)
+		}
+		httpErrs = httpServer.Errors()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -74,9 +156,303 @@ func main() {
 	log.Println("Agent service started successfully")
 	log.Printf("Ready to process messages on %s", shared.SubjectName)
 
+	shifts, err := parseShifts(os.Getenv("REPORT_SHIFTS"))
+	if err != nil {
+		log.Fatalf("Invalid REPORT_SHIFTS: %v", err)
+	}
+	if len(shifts) > 0 {
+		reportDir := os.Getenv("REPORT_DIR")
+		if reportDir == "" {
+			reportDir = shared.ReportDir
+		}
+		go runShiftReports(ctx, agentService, shifts, reportDir)
+	}
+
+	// Receive syslog from devices that cannot publish to NATS
+	syslogServer, err := newSyslogServer(nc)
+	if err != nil {
+		log.Fatalf("Invalid syslog configuration: %v", err)
+	}
+	if syslogServer != nil {
+		if err := syslogServer.Start(ctx); err != nil {
+			log.Fatalf("Failed to start syslog listener: %v", err)
+		}
+	}
+
+	// Receive OpenTelemetry log exports
+	otlpServer, err := newOTLPServer(nc)
+	if err != nil {
+		log.Fatalf("Invalid OTLP configuration: %v", err)
+	}
+	if otlpServer != nil {
+		if err := otlpServer.Start(); err != nil {
+			log.Fatalf("Failed to start OTLP receiver: %v", err)
+		}
+	}
+
+	// Follow the log files of hosts that only write to disk
+	tailer, err := newTailer(nc)
+	if err != nil {
+		log.Fatalf("Invalid tail configuration: %v", err)
+	}
+	if tailer != nil {
+		tailer.Start(ctx)
+	}
+
+	// Turn Sparkplug B telemetry from MQTT edge nodes into logs
+	var sparkplug *ingest.SparkplugListener
+	if natsOpts.MQTTAddr != "" && os.Getenv("SPARKPLUG") != "false" {
+		sparkplug, err = newSparkplugListener(nc)
+		if err != nil {
+			log.Fatalf("Invalid Sparkplug configuration: %v", err)
+		}
+		if err := sparkplug.Start(ctx); err != nil {
+			log.Fatalf("Failed to start Sparkplug listener: %v", err)
+		}
+	}
+
 	// Wait for interrupt signal
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-sigCh
-	log.Printf("Received signal %v, shutting down gracefully...", sig)
+	select {
+	case sig := <-sigCh:
+		log.Printf("Received signal %v, shutting down gracefully...", sig)
+	case err := <-httpErrs:
+		log.Printf("Error serving HTTP API, shutting down gracefully: %v", err)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shared.HTTPShutdownTimeout)
+	defer cancelShutdown()
+	if otlpServer != nil {
+		otlpServer.Stop(shutdownCtx)
+	}
+	if tailer != nil {
+		tailer.Stop()
+	}
+	if syslogServer != nil {
+		syslogServer.Stop()
+	}
+	if sparkplug != nil {
+		sparkplug.Stop()
+	}
+	if httpServer != nil {
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down HTTP API: %v", err)
+		}
+	}
+}
+
+// envInt reads an integer setting from the environment, exiting on malformed values
+func envInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return n
+}
+
+// envDuration reads a duration setting from the environment, exiting on malformed values
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return d
+}
+
+// envFloat reads a decimal setting from the environment, exiting on malformed values
+func envFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return f
+}
+
+// newEmbedder creates the embedder named by EMBEDDER, or nil when it is unset
+func newEmbedder(name string) (embed.Embedder, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return nil, nil
+	case "ollama":
+		url := os.Getenv("EMBED_URL")
+		if url == "" {
+			url = os.Getenv("OLLAMA_HOST")
+		}
+		if url == "" {
+			url = shared.OllamaURL
+		}
+		model := os.Getenv("EMBED_MODEL")
+		if model == "" {
+			model = shared.EmbedModel
+		}
+		return embed.NewOllama(url, model), nil
+	case "hash":
+		return embed.NewHash(envInt("EMBED_DIMS", shared.EmbedDims)), nil
+	default:
+		return nil, fmt.Errorf("unsupported embedder %q, want ollama or hash", name)
+	}
+}
+
+// newSyslogServer creates the syslog listener configured by SYSLOG_UDP_ADDR, SYSLOG_TCP_ADDR
+// and SYSLOG_TLS_ADDR, or returns nil when none is set. TLS needs SYSLOG_TLS_CERT and
+// SYSLOG_TLS_KEY; SYSLOG_TLS_CA additionally requires client certificates signed by it.
+func newSyslogServer(nc *nats.Conn) (*ingest.SyslogServer, error) {
+	cfg := ingest.SyslogConfig{
+		UDPAddr: os.Getenv("SYSLOG_UDP_ADDR"),
+		TCPAddr: os.Getenv("SYSLOG_TCP_ADDR"),
+		TLSAddr: os.Getenv("SYSLOG_TLS_ADDR"),
+	}
+	if cfg.UDPAddr == "" && cfg.TCPAddr == "" && cfg.TLSAddr == "" {
+		return nil, nil
+	}
+	if cfg.TLSAddr != "" {
+		tlsConfig, err := loadTLSConfig(os.Getenv("SYSLOG_TLS_CERT"), os.Getenv("SYSLOG_TLS_KEY"), os.Getenv("SYSLOG_TLS_CA"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLSConfig = tlsConfig
+	}
+
+	publisher, err := ingest.NewPublisher(nc)
+	if err != nil {
+		return nil, err
+	}
+	return ingest.NewSyslogServer(cfg, publisher)
+}
+
+// newOTLPServer creates the OTLP receiver configured by OTLP_GRPC_ADDR and OTLP_HTTP_ADDR, or
+// returns nil when neither is set
+func newOTLPServer(nc *nats.Conn) (*ingest.OTLPServer, error) {
+	cfg := ingest.OTLPConfig{
+		GRPCAddr: os.Getenv("OTLP_GRPC_ADDR"),
+		HTTPAddr: os.Getenv("OTLP_HTTP_ADDR"),
+	}
+	if cfg.GRPCAddr == "" && cfg.HTTPAddr == "" {
+		return nil, nil
+	}
+
+	publisher, err := ingest.NewPublisher(nc)
+	if err != nil {
+		return nil, err
+	}
+	return ingest.NewOTLPServer(cfg, publisher)
+}
+
+// newTailer creates the file tailer configured by the JSON file at TAIL_CONFIG, or returns nil
+// when it is unset
+func newTailer(nc *nats.Conn) (*ingest.Tailer, error) {
+	path := os.Getenv("TAIL_CONFIG")
+	if path == "" {
+		return nil, nil
+	}
+	sources, err := ingest.LoadTailSources(path)
+	if err != nil {
+		return nil, err
+	}
+
+	publisher, err := ingest.NewPublisher(nc)
+	if err != nil {
+		return nil, err
+	}
+	return ingest.NewTailer(sources, publisher, envDuration("TAIL_POLL", shared.TailPoll))
+}
+
+// natsOptions reads the optional listeners of the embedded server: MQTT on MQTT_ADDR, with
+// MQTT_USERNAME and MQTT_PASSWORD required of clients when set, over TLS with MQTT_TLS_CERT
+// and MQTT_TLS_KEY, and MQTT_TLS_CA to require client certificates
+func natsOptions() (embeddednats.Options, error) {
+	opts := embeddednats.Options{
+		MQTTAddr:     os.Getenv("MQTT_ADDR"),
+		MQTTUsername: os.Getenv("MQTT_USERNAME"),
+		MQTTPassword: os.Getenv("MQTT_PASSWORD"),
+	}
+	if opts.MQTTAddr != "" && os.Getenv("MQTT_TLS_CERT") != "" {
+		tlsConfig, err := loadTLSConfig(os.Getenv("MQTT_TLS_CERT"), os.Getenv("MQTT_TLS_KEY"), os.Getenv("MQTT_TLS_CA"))
+		if err != nil {
+			return opts, err
+		}
+		opts.MQTTTLS = tlsConfig
+	}
+	return opts, nil
+}
+
+// newSparkplugListener creates the Sparkplug B listener, reporting metrics whose names match
+// SPARKPLUG_ALARM_PATTERN as alarms and, with SPARKPLUG_ALL_DATA=true, all other telemetry too
+func newSparkplugListener(nc *nats.Conn) (*ingest.SparkplugListener, error) {
+	publisher, err := ingest.NewPublisher(nc)
+	if err != nil {
+		return nil, err
+	}
+	return ingest.NewSparkplugListener(ingest.SparkplugConfig{
+		AlarmPattern: os.Getenv("SPARKPLUG_ALARM_PATTERN"),
+		AllData:      os.Getenv("SPARKPLUG_ALL_DATA") == "true",
+	}, nc, publisher)
+}
+
+// loadTLSConfig builds a server TLS configuration from PEM files, verifying client
+// certificates against caFile when it is set
+func loadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("a TLS listener needs a certificate and key")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// parseProviders reads a fallback chain such as "OLLAMA:deepseek-r1:1.5b,OPEN_AI:gpt-4".
+// Each provider's key comes from API_KEY_<PROVIDER>, falling back to API_KEY.
+func parseProviders(spec string, timeout time.Duration) ([]agent.ProviderConfig, error) {
+	var providers []agent.ProviderConfig
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, model, ok := strings.Cut(item, ":")
+		if !ok || model == "" {
+			return nil, fmt.Errorf("entry %q must be PROVIDER:model", item)
+		}
+		name = strings.ToUpper(strings.TrimSpace(name))
+
+		apiKey := os.Getenv("API_KEY_" + name)
+		if apiKey == "" {
+			apiKey = os.Getenv("API_KEY")
+		}
+		providers = append(providers, agent.ProviderConfig{
+			Provider: name,
+			Model:    strings.TrimSpace(model),
+			APIKey:   apiKey,
+			Timeout:  timeout,
+		})
+	}
+	return providers, nil
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/agent"
+)
+
+// shift is one entry of the daily shift calendar, starting at hour:minute local time
+type shift struct {
+	name   string
+	hour   int
+	minute int
+}
+
+// parseShifts reads a shift calendar such as "Early=06:00,Late=14:00,Night=22:00". Each shift
+// runs until the next one starts; a shift without a name is named after its start time.
+func parseShifts(spec string) ([]shift, error) {
+	var shifts []shift
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, start, ok := strings.Cut(item, "=")
+		if !ok {
+			name, start = "", name
+		}
+		t, err := time.Parse("15:04", strings.TrimSpace(start))
+		if err != nil {
+			return nil, fmt.Errorf("entry %q must be [name=]HH:MM", item)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = t.Format("15:04")
+		}
+		minutes := t.Hour()*60 + t.Minute()
+		if seen[minutes] {
+			return nil, fmt.Errorf("two shifts start at %s", t.Format("15:04"))
+		}
+		seen[minutes] = true
+		shifts = append(shifts, shift{name: name, hour: t.Hour(), minute: t.Minute()})
+	}
+
+	sort.Slice(shifts, func(i, j int) bool {
+		return shifts[i].hour*60+shifts[i].minute < shifts[j].hour*60+shifts[j].minute
+	})
+	return shifts, nil
+}
+
+// nextShiftEnd finds the first shift change after now and the shift that ends there
+func nextShiftEnd(shifts []shift, now time.Time) (name string, start, end time.Time) {
+	type boundary struct {
+		at    time.Time
+		shift shift
+	}
+	var boundaries []boundary
+	for day := -1; day <= 1; day++ {
+		for _, s := range shifts {
+			at := time.Date(now.Year(), now.Month(), now.Day()+day, s.hour, s.minute, 0, 0, now.Location())
+			boundaries = append(boundaries, boundary{at: at, shift: s})
+		}
+	}
+
+	for i := 1; i < len(boundaries); i++ {
+		if boundaries[i].at.After(now) {
+			return boundaries[i-1].shift.name, boundaries[i-1].at, boundaries[i].at
+		}
+	}
+	// Unreachable: the calendar always has a boundary tomorrow
+	last := boundaries[len(boundaries)-1]
+	return last.shift.name, last.at, last.at.Add(24 * time.Hour)
+}
+
+// runShiftReports writes and publishes a report at the end of every shift until ctx is done
+func runShiftReports(ctx context.Context, svc *agent.Service, shifts []shift, dir string) {
+	var last time.Time
+	for {
+		now := time.Now()
+		if now.Before(last) {
+			now = last // never report the same shift twice should the timer fire early
+		}
+		name, start, end := nextShiftEnd(shifts, now)
+		last = end
+		log.Printf("Next shift report: %s shift, due %s", name, end.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(end))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		report, err := svc.ShiftReport(ctx, name, start, end)
+		if err != nil {
+			log.Printf("Error generating %s shift report: %v", name, err)
+			continue
+		}
+		path, err := report.Write(dir)
+		if err != nil {
+			log.Printf("Error writing %s shift report: %v", name, err)
+		} else {
+			log.Printf("Wrote %s shift report to %s", name, path)
+		}
+		if err := svc.PublishReport(report); err != nil {
+			log.Printf("Error publishing %s shift report: %v", name, err)
+		}
+	}
+}
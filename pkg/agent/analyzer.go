@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	swarmgo "github.com/prathyushnallamothu/swarmgo"
+	llm "github.com/prathyushnallamothu/swarmgo/llm"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// AnalysisRequest is a single prompt sent to an LLM backend
+type AnalysisRequest struct {
+	Instructions string // System instructions for the model
+	Prompt       string // User prompt describing the logs to analyze
+}
+
+// AnalysisResult is the answer produced by an LLM backend
+type AnalysisResult struct {
+	Content  string // Final answer text
+	Provider string // Provider that produced the answer
+	Model    string // Model that produced the answer
+}
+
+// Analyzer is the LLM backend the agent service depends on
+type Analyzer interface {
+	// Analyze runs a request through the model and returns its final answer
+	Analyze(ctx context.Context, req AnalysisRequest) (*AnalysisResult, error)
+	// Name identifies the backend in logs and dead-letter entries
+	Name() string
+}
+
+// SwarmAnalyzer is an Analyzer backed by a swarmgo provider
+type SwarmAnalyzer struct {
+	provider string
+	swarm    *swarmgo.Swarm
+	agent    *swarmgo.Agent
+}
+
+// NewSwarmAnalyzer creates an analyzer for one of the swarmgo LLM providers
+func NewSwarmAnalyzer(provider, model, apiKey, agentName string) (*SwarmAnalyzer, error) {
+	// Convert provider to uppercase for LLMProvider matching
+	provider = strings.ToUpper(provider)
+
+	// Validate provider-specific requirements
+	if provider != shared.ProviderOllama && apiKey == "" {
+		return nil, fmt.Errorf("API key is required for %s provider", provider)
+	}
+
+	// Create swarm instance with appropriate provider
+	var llmProvider llm.LLMProvider
+	switch provider {
+	case shared.ProviderOpenAI:
+		llmProvider = llm.LLMProvider(shared.ProviderOpenAI)
+	case shared.ProviderAzure:
+		llmProvider = llm.LLMProvider(shared.ProviderAzure)
+	case shared.ProviderAzureAD:
+		llmProvider = llm.LLMProvider(shared.ProviderAzureAD)
+	case shared.ProviderCloudflareAzure:
+		llmProvider = llm.LLMProvider(shared.ProviderCloudflareAzure)
+	case shared.ProviderGemini:
+		llmProvider = llm.LLMProvider(shared.ProviderGemini)
+	case shared.ProviderClaude:
+		llmProvider = llm.LLMProvider(shared.ProviderClaude)
+	case shared.ProviderOllama:
+		llmProvider = llm.LLMProvider(shared.ProviderOllama)
+	case shared.ProviderDeepSeek:
+		llmProvider = llm.LLMProvider(shared.ProviderDeepSeek)
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+
+	return &SwarmAnalyzer{
+		provider: provider,
+		swarm:    swarmgo.NewSwarm(apiKey, llmProvider),
+		agent: &swarmgo.Agent{
+			Name:  agentName,
+			Model: model,
+		},
+	}, nil
+}
+
+// Analyze implements Analyzer
+func (a *SwarmAnalyzer) Analyze(ctx context.Context, req AnalysisRequest) (*AnalysisResult, error) {
+	// Copy the agent so concurrent requests can carry their own instructions
+	agent := *a.agent
+	agent.Instructions = req.Instructions
+
+	messages := []llm.Message{
+		{Role: llm.RoleUser, Content: req.Prompt},
+	}
+
+	response, err := a.swarm.Run(ctx, &agent, messages, nil, "", false, false, 5, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Messages) == 0 {
+		return nil, fmt.Errorf("provider returned no messages")
+	}
+
+	return &AnalysisResult{
+		Content:  response.Messages[len(response.Messages)-1].Content,
+		Provider: a.provider,
+		Model:    agent.Model,
+	}, nil
+}
+
+// Name implements Analyzer
+func (a *SwarmAnalyzer) Name() string {
+	return a.provider
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/anomaly"
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// loadBaselines restores the log rate baselines learned by previous runs
+func (s *Service) loadBaselines() error {
+	baselines, err := db.GetAnomalyBaselines()
+	if err != nil {
+		return err
+	}
+	for _, b := range baselines {
+		var seasonal []anomaly.Season
+		if b.Seasonal != "" {
+			if err := json.Unmarshal([]byte(b.Seasonal), &seasonal); err != nil {
+				log.Printf("Error decoding seasonal baseline of %s/%s/%s: %v", b.Hostname, b.Service, b.Severity, err)
+			}
+		}
+		s.anomalies.Restore(anomaly.Baseline{
+			Key:         anomaly.Key{Hostname: b.Hostname, Service: b.Service, Severity: b.Severity},
+			Mean:        b.Mean,
+			Variance:    b.Variance,
+			Windows:     b.Windows,
+			Seasonal:    seasonal,
+			WindowStart: b.WindowStart,
+			Count:       b.Count,
+			LastSeen:    b.LastSeen,
+		})
+	}
+	return nil
+}
+
+// saveBaselines stores the current log rate baselines
+func (s *Service) saveBaselines() {
+	snapshot := s.anomalies.Snapshot()
+	baselines := make([]db.AnomalyBaseline, 0, len(snapshot))
+	for _, b := range snapshot {
+		seasonal, err := json.Marshal(b.Seasonal)
+		if err != nil {
+			log.Printf("Error encoding seasonal baseline: %v", err)
+			continue
+		}
+		baselines = append(baselines, db.AnomalyBaseline{
+			Hostname:    b.Hostname,
+			Service:     b.Service,
+			Severity:    b.Severity,
+			Mean:        b.Mean,
+			Variance:    b.Variance,
+			Windows:     b.Windows,
+			Seasonal:    string(seasonal),
+			WindowStart: b.WindowStart,
+			Count:       b.Count,
+			LastSeen:    b.LastSeen,
+		})
+	}
+	if err := db.SaveAnomalyBaselines(baselines); err != nil {
+		log.Printf("Error saving anomaly baselines: %v", err)
+	}
+}
+
+// observeRate counts the record's log against its source's baseline, publishes any anomaly it
+// raises and attaches a spike in progress to the prompt. Redeliveries are not counted again.
+func (s *Service) observeRate(rec *record) {
+	if rec.redelivered {
+		return
+	}
+
+	obs := s.anomalies.Observe(anomaly.Key{
+		Hostname: rec.log.Hostname,
+		Service:  rec.log.Service,
+		Severity: rec.log.Severity,
+	}, time.Now())
+
+	for _, e := range obs.Events {
+		s.publishAnomaly(e)
+	}
+	rec.anomalyRaised = len(obs.Events) > 0
+
+	var notes []string
+	for _, e := range obs.Events {
+		if e.Kind != anomaly.KindSpike {
+			notes = append(notes, e.Describe())
+		}
+	}
+	if obs.Active != nil {
+		notes = append(notes, obs.Active.Describe())
+	}
+	for _, note := range notes {
+		rec.sections = append(rec.sections, PromptSection{Title: "Anomaly", Body: note})
+	}
+}
+
+// watchAnomalies closes rate windows as time passes, reports sources that fell silent and
+// saves the baselines, until ctx is cancelled
+func (s *Service) watchAnomalies(ctx context.Context) {
+	defer s.wg.Done()
+	interval := s.config.AnomalyWindow / 5
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, e := range s.anomalies.Tick(now) {
+				s.publishAnomaly(e)
+			}
+			s.saveBaselines()
+		}
+	}
+}
+
+// publishAnomaly announces an anomaly on the anomaly subject
+func (s *Service) publishAnomaly(e anomaly.Event) {
+	log.Printf("Anomaly detected: %s", e.Describe())
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error marshaling anomaly: %v", err)
+		return
+	}
+	if err := s.nc.Publish(shared.AnomalySubjectName, data); err != nil {
+		log.Printf("Error publishing anomaly: %v", err)
+	}
+}
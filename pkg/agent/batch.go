@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"log"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ProcessBatch implements embeddednats.BatchProcessor. Logs collected within the batch window
+// are grouped by host and service and each group is handed to the worker pool as one job,
+// so a burst of related lines costs a single LLM call.
+func (s *Service) ProcessBatch(ctx context.Context, msgs []*nats.Msg) error {
+	var order []string
+	groups := make(map[string]*job)
+
+	for _, msg := range msgs {
+		rec, err := s.newRecord(msg)
+		if err != nil {
+			// Undecodable messages go through the single path so they are dead-lettered
+			s.jobs <- &job{msgs: []*nats.Msg{msg}}
+			continue
+		}
+		key := rec.log.Hostname + "/" + rec.log.Service
+		group, ok := groups[key]
+		if !ok {
+			group = &job{}
+			groups[key] = group
+			order = append(order, key)
+		}
+		group.msgs = append(group.msgs, msg)
+		group.recs = append(group.recs, rec)
+	}
+
+	for _, key := range order {
+		s.jobs <- groups[key]
+	}
+	return nil
+}
+
+// processGroup analyzes related logs in one LLM call and fans the per-entry analyses back out.
+// Logs whose analysis the pre-analysis stages supply are completed first and left out of the call.
+func (s *Service) processGroup(ctx context.Context, recs []*record) {
+	var pending []*record
+	for _, rec := range recs {
+		rec.msg.InProgress()
+		if s.prepare(rec) {
+			s.settle(rec.msg, s.complete(rec))
+			continue
+		}
+		pending = append(pending, rec)
+	}
+
+	switch len(pending) {
+	case 0:
+		return
+	case 1:
+		rec := pending[0]
+		err := s.analyzeRecord(ctx, rec)
+		if err == nil {
+			err = s.complete(rec)
+		}
+		s.settle(rec.msg, err)
+		return
+	}
+
+	first := pending[0].log
+	log.Printf("Processing batch of %d log messages from %s [%s]", len(pending), first.Hostname, first.Service)
+
+	logMsgs := make([]LogMessage, len(pending))
+	var sections []PromptSection
+	seen := make(map[PromptSection]bool)
+	for i, rec := range pending {
+		logMsgs[i] = rec.log
+		for _, section := range rec.sections {
+			if !seen[section] {
+				seen[section] = true
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	var structured []*StructuredAnalysis
+	prompt := s.prompts.BatchPrompt(BatchPromptData{
+		Hostname: first.Hostname,
+		Service:  first.Service,
+		Entries:  logMsgs,
+		Sections: sections,
+	})
+	instructions := s.prompts.Instructions(first, s.config.Instructions)
+
+	result, err := s.analyzeStructured(ctx, instructions, prompt, batchInstructions, func(text string) (err error) {
+		structured, err = parseBatch(text, len(logMsgs))
+		return err
+	})
+	if err != nil {
+		for _, rec := range pending {
+			s.settle(rec.msg, err)
+		}
+		return
+	}
+
+	for i, rec := range pending {
+		rec.result = result
+		if structured != nil {
+			rec.structured = structured[i]
+		}
+		s.settle(rec.msg, s.complete(rec))
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/tobalo/gogent/pkg/db"
+)
+
+// lookupCache fills rec from a recent analysis of a log with the same fingerprint and
+// reports whether one was found. Cache errors are logged and treated as misses.
+func (s *Service) lookupCache(rec *record) bool {
+	if s.config.CacheTTL <= 0 {
+		return false
+	}
+
+	cached, err := db.GetCachedAnalysis(rec.fingerprint, s.config.CacheTTL)
+	if err != nil {
+		log.Printf("Error reading analysis cache: %v", err)
+		return false
+	}
+	if cached == nil {
+		return false
+	}
+
+	hits, err := db.RecordCacheHit(rec.fingerprint)
+	if err != nil {
+		log.Printf("Error recording cache hit: %v", err)
+		hits = cached.Hits + 1
+	}
+
+	structured := &StructuredAnalysis{
+		Summary:    cached.Summary,
+		RootCause:  cached.RootCause,
+		Category:   cached.Category,
+		RiskScore:  cached.RiskScore,
+		Confidence: cached.Confidence,
+	}
+	if err := json.Unmarshal([]byte(cached.RecommendedActions), &structured.RecommendedActions); err != nil {
+		log.Printf("Error decoding cached recommended actions: %v", err)
+		return false
+	}
+
+	rec.result = &AnalysisResult{Content: cached.Analysis, Provider: cached.Provider}
+	rec.structured = structured
+	rec.reused = reusedCache
+	rec.cacheHits = hits
+	return true
+}
+
+// storeCache caches a freshly produced analysis. Unstructured answers are not cached so the
+// next matching log gets another chance at a valid one.
+func (s *Service) storeCache(rec *record, entry db.LogEntry) {
+	if s.config.CacheTTL <= 0 || rec.structured == nil {
+		return
+	}
+
+	err := db.PutCachedAnalysis(db.CachedAnalysis{
+		Fingerprint:        rec.fingerprint,
+		Analysis:           entry.Analysis,
+		Provider:           entry.Provider,
+		Summary:            entry.Summary,
+		RootCause:          entry.RootCause,
+		Category:           entry.Category,
+		RiskScore:          entry.RiskScore,
+		RecommendedActions: entry.RecommendedActions,
+		Confidence:         entry.Confidence,
+	})
+	if err != nil {
+		log.Printf("Error caching analysis: %v", err)
+	}
+}
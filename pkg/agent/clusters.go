@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tobalo/gogent/pkg/cluster"
+	"github.com/tobalo/gogent/pkg/db"
+)
+
+// loadClusters restores the clusters stored by previous runs
+func (s *Service) loadClusters() error {
+	clusters, err := db.GetLogClusters()
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		s.clusters.Restore(cluster.Cluster{
+			ID:                  c.ID,
+			Service:             c.Service,
+			Representative:      c.Representative,
+			Members:             c.Members,
+			RepresentativeLogID: c.RepresentativeLogID,
+		}, c.Hosts)
+	}
+	if len(clusters) > 0 {
+		log.Printf("Restored %d log clusters", len(clusters))
+	}
+	return nil
+}
+
+// assignCluster places the record's log in a cluster of near-duplicates and persists the
+// cluster. A redelivered log was counted on its first delivery, so it only looks its cluster up.
+func (s *Service) assignCluster(rec *record) {
+	doc := cluster.Document{
+		Service: rec.log.Service,
+		Host:    rec.log.Hostname,
+		Message: rec.log.Message,
+	}
+	found := false
+	if rec.redelivered {
+		rec.cluster, found = s.clusters.Lookup(doc)
+	}
+	if !found {
+		rec.cluster = s.clusters.Assign(doc)
+	}
+	if rec.cluster.ID == 0 {
+		return
+	}
+
+	c := rec.cluster
+	if !found {
+		if err := db.SaveLogCluster(c.ID, c.Service, c.Representative, c.Members); err != nil {
+			log.Printf("Error saving log cluster: %v", err)
+		}
+	}
+	if c.NewHost {
+		if err := db.AddClusterHost(c.ID, rec.log.Hostname); err != nil {
+			log.Printf("Error saving cluster host: %v", err)
+		}
+	}
+
+	if !c.New {
+		rec.sections = append(rec.sections, PromptSection{
+			Title: "Cluster",
+			Body: fmt.Sprintf("This is member %d of cluster %d on %d hosts, similar to: %s",
+				c.Members, c.ID, c.Hosts, c.Representative),
+		})
+	}
+}
+
+// reuseCluster fills rec from the analysis of its cluster's representative and reports whether
+// one was found
+func (s *Service) reuseCluster(rec *record) bool {
+	if !s.config.ClusterReuse || rec.cluster.ID == 0 || rec.cluster.New {
+		return false
+	}
+	return s.reuseLog(rec, rec.cluster.RepresentativeLogID, reusedCluster)
+}
+
+// storeClusterAnalysis makes a fresh structured analysis the one standing for its cluster
+func (s *Service) storeClusterAnalysis(rec *record, logID int64) {
+	if rec.cluster.ID == 0 || rec.structured == nil {
+		return
+	}
+	s.clusters.SetRepresentativeLog(rec.cluster.ID, logID)
+	if err := db.SetClusterRepresentativeLog(rec.cluster.ID, logID); err != nil {
+		log.Printf("Error storing cluster representative: %v", err)
+	}
+}
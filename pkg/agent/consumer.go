@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// Failure reasons recorded on dead-lettered messages
+const (
+	reasonDecode        = "decode_failed"
+	reasonAnalysis      = "analysis_failed"
+	reasonStorage       = "storage_failed"
+	reasonMaxDeliveries = "max_deliveries_exceeded"
+)
+
+// processingError describes why a message failed and whether retrying can help
+type processingError struct {
+	reason    string
+	permanent bool
+	err       error
+}
+
+func (e *processingError) Error() string { return e.err.Error() }
+
+func (e *processingError) Unwrap() error { return e.err }
+
+// permanentFailure marks a message that can never be processed, so redelivery is pointless
+func permanentFailure(reason string, err error) error {
+	return &processingError{reason: reason, permanent: true, err: err}
+}
+
+// transientFailure marks a message that may succeed on redelivery
+func transientFailure(reason string, err error) error {
+	return &processingError{reason: reason, err: err}
+}
+
+// ensureConsumer creates the durable pull consumer or updates it to the current config. The
+// consumer has no subject filter: every subject of the stream carries logs, in one input
+// format or another.
+func (s *Service) ensureConsumer() error {
+	cfg := &nats.ConsumerConfig{
+		Durable:       shared.ConsumerName,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       s.config.AckWait,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		MaxDeliver:    s.config.MaxDeliver,
+		MaxAckPending: s.config.MaxInFlight,
+	}
+
+	_, err := s.js.ConsumerInfo(shared.StreamName, shared.ConsumerName)
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		if _, err := s.js.AddConsumer(shared.StreamName, cfg); err != nil {
+			return fmt.Errorf("failed to create consumer: %w", err)
+		}
+		log.Printf("Created consumer: %s", shared.ConsumerName)
+	case err != nil:
+		return fmt.Errorf("failed to look up consumer: %w", err)
+	default:
+		if _, err := s.js.UpdateConsumer(shared.StreamName, cfg); err != nil {
+			return fmt.Errorf("failed to update consumer: %w", err)
+		}
+	}
+	return nil
+}
+
+// consume fetches messages from the durable consumer into a bounded worker pool until the
+// context is cancelled. Only as many messages as there are free in-flight slots are pulled,
+// so a slow LLM leaves the backlog waiting in the stream instead of in memory.
+func (s *Service) consume(ctx context.Context, sub *nats.Subscription) {
+	defer s.wg.Done()
+
+	slots := make(chan struct{}, s.config.MaxInFlight)
+	s.jobs = make(chan *job, s.config.MaxInFlight)
+
+	var workers sync.WaitGroup
+	for i := 0; i < s.config.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range s.jobs {
+				switch {
+				case ctx.Err() != nil:
+					// Shutting down: hand the messages back for immediate redelivery
+					for _, msg := range job.msgs {
+						msg.Nak()
+					}
+				case job.recs == nil:
+					s.process(ctx, job.msgs[0])
+				default:
+					s.processGroup(ctx, job.recs)
+				}
+				for range job.msgs {
+					<-slots
+				}
+			}
+		}()
+	}
+
+	// In batch mode messages pass through the queue, which regroups them before they reach the workers
+	if s.queue != nil {
+		s.queue.Start(ctx)
+	}
+	defer func() {
+		if s.queue != nil {
+			s.queue.Stop()
+		}
+		close(s.jobs)
+		workers.Wait()
+	}()
+
+	for {
+		// Block until at least one slot frees up, then claim any others that are idle
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		batch := 1
+	claim:
+		for batch < s.config.MaxInFlight {
+			select {
+			case slots <- struct{}{}:
+				batch++
+			default:
+				break claim
+			}
+		}
+
+		msgs, err := sub.Fetch(batch, nats.MaxWait(5*time.Second))
+		if err != nil && !errors.Is(err, nats.ErrTimeout) && ctx.Err() == nil {
+			log.Printf("Error fetching messages: %v", err)
+			time.Sleep(time.Second)
+		}
+
+		// Release the slots this fetch did not fill
+		for i := len(msgs); i < batch; i++ {
+			<-slots
+		}
+		for _, msg := range msgs {
+			if s.queue != nil {
+				s.queue.Add(msg)
+			} else {
+				s.jobs <- &job{msgs: []*nats.Msg{msg}}
+			}
+		}
+	}
+}
+
+// process handles a message and settles it with the server
+func (s *Service) process(ctx context.Context, msg *nats.Msg) {
+	// Reset the redelivery timer now that the message has left the local queue
+	msg.InProgress()
+
+	s.settle(msg, s.handleMessage(ctx, msg))
+}
+
+// settle acks a processed message, or schedules its redelivery or dead-lettering on failure
+func (s *Service) settle(msg *nats.Msg, err error) {
+	if err == nil {
+		if err := msg.Ack(); err != nil {
+			log.Printf("Error acking message: %v", err)
+		}
+		return
+	}
+
+	attempt := uint64(1)
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		attempt = meta.NumDelivered
+	}
+
+	perr := &processingError{reason: reasonAnalysis, err: err}
+	errors.As(err, &perr)
+
+	if !perr.permanent && attempt < uint64(s.config.MaxDeliver) {
+		log.Printf("Error processing message (attempt %d/%d), scheduling redelivery: %v",
+			attempt, s.config.MaxDeliver, err)
+		msg.NakWithDelay(nakDelay(attempt))
+		return
+	}
+
+	log.Printf("Dead-lettering message after %d attempt(s): %v", attempt, err)
+	if err := s.deadLetter(msg, perr, attempt); err != nil {
+		// Leave the message unacked so it stays in the stream for the max deliveries advisory
+		log.Printf("Error dead-lettering message: %v", err)
+		return
+	}
+	msg.Term()
+}
+
+// nakDelay grows the redelivery delay linearly with the attempt count, capped at a minute
+func nakDelay(attempt uint64) time.Duration {
+	delay := time.Duration(attempt) * shared.NakDelay
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// Input formats of published logs. FormatJSON, the LogMessage JSON, is assumed when a message
+// names no other.
+const (
+	FormatJSON     = "json"
+	FormatRaw      = "raw"
+	FormatCEF      = "cef"
+	FormatLEEF     = "leef"
+	FormatGELF     = "gelf"
+	FormatLogfmt   = "logfmt"
+	FormatWinEvent = "winevent"
+)
+
+// Decoder converts the payload of a message in one input format into a log message
+type Decoder func(data []byte) (LogMessage, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		FormatJSON:     decodeJSON,
+		FormatRaw:      decodeRaw,
+		FormatCEF:      decodeCEF,
+		FormatLEEF:     decodeLEEF,
+		FormatGELF:     decodeGELF,
+		FormatLogfmt:   decodeLogfmt,
+		FormatWinEvent: decodeWinEvent,
+	}
+)
+
+// RegisterDecoder adds the decoder of an input format, replacing any decoder of that name
+func RegisterDecoder(format string, decoder Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[strings.ToLower(format)] = decoder
+}
+
+// MessageFormat returns the input format of a message: its Gogent-Format header, else the
+// last token of an agent.technical.support.<format> subject, else FormatJSON
+func MessageFormat(msg *nats.Msg) string {
+	if format := msg.Header.Get(shared.FormatHeader); format != "" {
+		return strings.ToLower(format)
+	}
+	if suffix, ok := strings.CutPrefix(msg.Subject, shared.SubjectName+"."); ok && suffix != "" {
+		return strings.ToLower(suffix[strings.LastIndexByte(suffix, '.')+1:])
+	}
+	return FormatJSON
+}
+
+// decodeLogMessage parses the log carried by a message with the decoder of its format and
+// returns it with the format
+func decodeLogMessage(msg *nats.Msg) (LogMessage, string, error) {
+	format := MessageFormat(msg)
+	decodersMu.RLock()
+	decoder, ok := decoders[format]
+	decodersMu.RUnlock()
+	if !ok {
+		return LogMessage{}, format, permanentFailure(reasonDecode, fmt.Errorf("unsupported log format %q", format))
+	}
+
+	logMsg, err := decoder(msg.Data)
+	if err != nil {
+		return logMsg, format, permanentFailure(reasonDecode, fmt.Errorf("failed to decode %s message: %w", format, err))
+	}
+	if format == FormatJSON {
+		return logMsg, format, nil
+	}
+
+	// Other formats may leave out fields the pipeline relies on
+	if strings.TrimSpace(logMsg.Message) == "" {
+		return logMsg, format, permanentFailure(reasonDecode, fmt.Errorf("%s message has no text", format))
+	}
+	if logMsg.Timestamp == "" {
+		received := time.Now()
+		if meta, err := msg.Metadata(); err == nil {
+			received = meta.Timestamp
+		}
+		logMsg.Timestamp = received.UTC().Format(time.RFC3339Nano)
+	}
+	if logMsg.Hostname == "" {
+		logMsg.Hostname = "unknown"
+	}
+	if logMsg.Service == "" {
+		logMsg.Service = "unknown"
+	}
+	if logMsg.Severity == "" {
+		logMsg.Severity = "INFO"
+	}
+	if logMsg.Context == nil {
+		logMsg.Context = make(map[string]interface{})
+	}
+	return logMsg, format, nil
+}
+
+// decodeJSON parses the native LogMessage JSON
+func decodeJSON(data []byte) (LogMessage, error) {
+	var logMsg LogMessage
+	if err := json.Unmarshal(data, &logMsg); err != nil {
+		return logMsg, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return logMsg, nil
+}
+
+// decodeRaw takes the whole payload as the message text
+func decodeRaw(data []byte) (LogMessage, error) {
+	return LogMessage{Message: strings.TrimSpace(strings.ToValidUTF8(string(data), string(utf8.RuneError)))}, nil
+}
+
+// syslogSeverities names the syslog severities 0 to 7 the way the pipeline spells them
+var syslogSeverities = []string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARN", "NOTICE", "INFO", "DEBUG"}
+
+// SyslogSeverity names a syslog severity level, 0 (emergency) to 7 (debug)
+func SyslogSeverity(level int) string {
+	if level < 0 || level >= len(syslogSeverities) {
+		return "INFO"
+	}
+	return syslogSeverities[level]
+}
+
+// scaledSeverity names a 0 to 10 severity as used by CEF and LEEF
+func scaledSeverity(value string) string {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		switch strings.ToLower(value) {
+		case "medium":
+			return "WARN"
+		case "high":
+			return "ERROR"
+		case "very-high":
+			return "CRITICAL"
+		}
+		return "INFO"
+	}
+	switch {
+	case n >= 9:
+		return "CRITICAL"
+	case n >= 7:
+		return "ERROR"
+	case n >= 4:
+		return "WARN"
+	}
+	return "INFO"
+}
+
+// parseEventTime reads the timestamps found in security event fields: Unix milliseconds,
+// RFC 3339 or the "Jan 02 2006 15:04:05" family
+func parseEventTime(value string) (time.Time, bool) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "Jan 02 2006 15:04:05.000", "Jan 02 2006 15:04:05", "Jan 2 2006 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cefExtensionKey finds the keys of a CEF extension; escaped equals signs in values are
+// preceded by a backslash and so never match
+var cefExtensionKey = regexp.MustCompile(`(?:^|\s)([\w.\[\]-]+)=`)
+
+// decodeCEF parses an ArcSight Common Event Format event,
+// "CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension",
+// optionally behind a syslog header
+func decodeCEF(data []byte) (LogMessage, error) {
+	prefix, line, err := cutEventHeader(string(data), "CEF:")
+	if err != nil {
+		return LogMessage{}, err
+	}
+	fields, extension, err := splitEventHeader(line, 7)
+	if err != nil {
+		return LogMessage{}, fmt.Errorf("invalid CEF header: %w", err)
+	}
+	ext := parseCEFExtension(extension)
+
+	logMsg := LogMessage{
+		Hostname: prefixHost(prefix),
+		Severity: scaledSeverity(fields[6]),
+		Service:  fields[2],
+		Message:  eventMessage(fields[5], ext["msg"]),
+		Context: map[string]interface{}{
+			"cef_version":    fields[0],
+			"device_vendor":  fields[1],
+			"device_product": fields[2],
+			"device_version": fields[3],
+			"signature_id":   fields[4],
+			"severity":       fields[6],
+		},
+	}
+	if host := firstNonEmpty(ext["dvchost"], ext["dvc"]); host != "" {
+		logMsg.Hostname = host
+	}
+	if t, ok := parseEventTime(ext["rt"]); ok {
+		logMsg.Timestamp = t.UTC().Format(time.RFC3339Nano)
+	}
+	if len(ext) > 0 {
+		logMsg.Context["extension"] = ext
+	}
+	if prefix != "" {
+		logMsg.Context["syslog_header"] = prefix
+	}
+	return logMsg, nil
+}
+
+// decodeLEEF parses an IBM QRadar Log Event Extended Format event,
+// "LEEF:Version|Vendor|Product|Version|EventID|[Delimiter|]Attributes", optionally behind a
+// syslog header. LEEF 1.0 attributes are tab separated; LEEF 2.0 names its delimiter.
+func decodeLEEF(data []byte) (LogMessage, error) {
+	prefix, line, err := cutEventHeader(string(data), "LEEF:")
+	if err != nil {
+		return LogMessage{}, err
+	}
+	fields, attributes, err := splitEventHeader(line, 5)
+	if err != nil {
+		return LogMessage{}, fmt.Errorf("invalid LEEF header: %w", err)
+	}
+
+	delimiter := "\t"
+	if strings.HasPrefix(fields[0], "2") {
+		field, rest, ok := strings.Cut(attributes, "|")
+		if !ok {
+			return LogMessage{}, fmt.Errorf("invalid LEEF header: missing delimiter field")
+		}
+		attributes = rest
+		if field != "" {
+			if delimiter, err = leefDelimiter(field); err != nil {
+				return LogMessage{}, err
+			}
+		}
+	}
+
+	attrs := make(map[string]string)
+	for _, pair := range strings.Split(attributes, delimiter) {
+		if key, value, ok := strings.Cut(pair, "="); ok && key != "" {
+			attrs[strings.TrimSpace(key)] = value
+		}
+	}
+
+	logMsg := LogMessage{
+		Hostname: firstNonEmpty(prefixHost(prefix), attrs["identHostName"]),
+		Severity: scaledSeverity(attrs["sev"]),
+		Service:  fields[2],
+		Message:  eventMessage(fields[4], attrs["msg"]),
+		Context: map[string]interface{}{
+			"leef_version":    fields[0],
+			"vendor":          fields[1],
+			"product":         fields[2],
+			"product_version": fields[3],
+			"event_id":        fields[4],
+		},
+	}
+	if t, ok := parseEventTime(attrs["devTime"]); ok {
+		logMsg.Timestamp = t.UTC().Format(time.RFC3339Nano)
+	}
+	if len(attrs) > 0 {
+		logMsg.Context["attributes"] = attrs
+	}
+	if prefix != "" {
+		logMsg.Context["syslog_header"] = prefix
+	}
+	return logMsg, nil
+}
+
+// cutEventHeader splits an event into the syslog header before its marker and the fields
+// after it
+func cutEventHeader(event, marker string) (string, string, error) {
+	event = strings.TrimSpace(event)
+	i := strings.Index(event, marker)
+	if i < 0 {
+		return "", "", fmt.Errorf("no %s header", strings.TrimSuffix(marker, ":"))
+	}
+	return strings.TrimSpace(event[:i]), event[i+len(marker):], nil
+}
+
+// splitEventHeader reads n pipe-terminated header fields, in which \| and \\ are escapes, and
+// returns them with the rest of the event
+func splitEventHeader(line string, n int) ([]string, string, error) {
+	fields := make([]string, 0, n)
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && (line[i+1] == '|' || line[i+1] == '\\'):
+			i++
+			b.WriteByte(line[i])
+		case c == '|':
+			fields = append(fields, b.String())
+			b.Reset()
+			if len(fields) == n {
+				return fields, line[i+1:], nil
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	// The last header field may end the event when there are no attributes
+	if len(fields) == n-1 {
+		return append(fields, b.String()), "", nil
+	}
+	return nil, "", fmt.Errorf("want %d fields, got %d", n, len(fields))
+}
+
+// parseCEFExtension reads space-separated key=value pairs whose values may contain spaces
+func parseCEFExtension(extension string) map[string]string {
+	ext := make(map[string]string)
+	matches := cefExtensionKey.FindAllStringSubmatchIndex(extension, -1)
+	for i, m := range matches {
+		end := len(extension)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		key := extension[m[2]:m[3]]
+		ext[key] = unescapeCEF(strings.TrimSpace(extension[m[1]:end]))
+	}
+	return ext
+}
+
+// unescapeCEF resolves the escapes allowed in CEF extension values
+func unescapeCEF(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\=`, "=", `\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(value)
+}
+
+// leefDelimiter reads a LEEF 2.0 delimiter, a character or its hex code as xHH or 0xHH
+func leefDelimiter(field string) (string, error) {
+	if len(field) == 1 {
+		return field, nil
+	}
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(field), "0"), "x")
+	code, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil || !strings.Contains(strings.ToLower(field), "x") {
+		return "", fmt.Errorf("invalid LEEF delimiter %q", field)
+	}
+	return string(rune(code)), nil
+}
+
+// prefixHost returns the hostname that ends a syslog header, if any
+func prefixHost(prefix string) string {
+	fields := strings.Fields(prefix)
+	if len(fields) == 0 {
+		return ""
+	}
+	host := fields[len(fields)-1]
+	if host == "-" || strings.ContainsAny(host, "<>:") {
+		return ""
+	}
+	return host
+}
+
+// eventMessage combines an event's name with its free-text message
+func eventMessage(name, msg string) string {
+	switch {
+	case msg == "":
+		return name
+	case name == "":
+		return msg
+	}
+	return name + ": " + msg
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
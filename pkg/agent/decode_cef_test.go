@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCEF(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want LogMessage
+	}{
+		{
+			// ArcSight CEF implementation standard, the event behind a syslog header
+			name: "syslog header",
+			data: "Sep 19 08:26:10 host CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232",
+			want: LogMessage{
+				Hostname: "host",
+				Severity: "CRITICAL",
+				Service:  "threatmanager",
+				Message:  "worm successfully stopped",
+				Context: map[string]interface{}{
+					"cef_version": "0", "device_vendor": "Security", "device_product": "threatmanager",
+					"device_version": "1.0", "signature_id": "100", "severity": "10",
+					"extension":     map[string]string{"src": "10.0.0.1", "dst": "2.1.2.2", "spt": "1232"},
+					"syslog_header": "Sep 19 08:26:10 host",
+				},
+			},
+		},
+		{
+			// The escaping examples of the standard
+			name: "escapes",
+			data: `CEF:0|security|threatmanager|1.0|100|detected a \| in message|10|src=10.0.0.1 act=blocked a \= dst=1.1.1.1`,
+			want: LogMessage{
+				Severity: "CRITICAL",
+				Service:  "threatmanager",
+				Message:  "detected a | in message",
+				Context: map[string]interface{}{
+					"cef_version": "0", "device_vendor": "security", "device_product": "threatmanager",
+					"device_version": "1.0", "signature_id": "100", "severity": "10",
+					"extension": map[string]string{"src": "10.0.0.1", "act": "blocked a =", "dst": "1.1.1.1"},
+				},
+			},
+		},
+		{
+			name: "message, device host and receipt time",
+			data: `CEF:1|Fortinet|FortiGate|7.2|0419016384|ips|High|rt=1664522400000 dvchost=fw-01 msg=Blocked C:\\temp\\x.exe\nby policy 7`,
+			want: LogMessage{
+				Timestamp: "2022-09-30T07:20:00Z",
+				Hostname:  "fw-01",
+				Severity:  "ERROR",
+				Service:   "FortiGate",
+				Message:   "ips: Blocked C:\\temp\\x.exe\nby policy 7",
+				Context: map[string]interface{}{
+					"cef_version": "1", "device_vendor": "Fortinet", "device_product": "FortiGate",
+					"device_version": "7.2", "signature_id": "0419016384", "severity": "High",
+					"extension": map[string]string{"rt": "1664522400000", "dvchost": "fw-01", "msg": "Blocked C:\\temp\\x.exe\nby policy 7"},
+				},
+			},
+		},
+		{
+			name: "no extension",
+			data: "<134>1 2026-10-17T08:00:00Z - CEF:0|Acme|Gateway|2|7|Config saved|3",
+			want: LogMessage{
+				Severity: "INFO",
+				Service:  "Gateway",
+				Message:  "Config saved",
+				Context: map[string]interface{}{
+					"cef_version": "0", "device_vendor": "Acme", "device_product": "Gateway",
+					"device_version": "2", "signature_id": "7", "severity": "3",
+					"syslog_header": "<134>1 2026-10-17T08:00:00Z -",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCEF([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeCEF() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCEF() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLEEF(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want LogMessage
+	}{
+		{
+			// QRadar LEEF 1.0 documentation example
+			name: "leef 1.0",
+			data: "LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5\tcat=anomaly\tsrcPort=81\tdstPort=21\tusrName=joe.black",
+			want: LogMessage{
+				Severity: "WARN",
+				Service:  "MSExchange",
+				Message:  "15345",
+				Context: map[string]interface{}{
+					"leef_version": "1.0", "vendor": "Microsoft", "product": "MSExchange",
+					"product_version": "4.0 SP1", "event_id": "15345",
+					"attributes": map[string]string{
+						"src": "192.0.2.0", "dst": "172.50.123.1", "sev": "5", "cat": "anomaly",
+						"srcPort": "81", "dstPort": "21", "usrName": "joe.black",
+					},
+				},
+			},
+		},
+		{
+			// QRadar LEEF 2.0 documentation example, with a caret delimiter
+			name: "leef 2.0 character delimiter",
+			data: "Jan 18 11:07:53 192.0.2.1 LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5^srcPort=81^dstPort=21",
+			want: LogMessage{
+				Hostname: "192.0.2.1",
+				Severity: "WARN",
+				Service:  "StealthWatch",
+				Message:  "41",
+				Context: map[string]interface{}{
+					"leef_version": "2.0", "vendor": "Lancope", "product": "StealthWatch",
+					"product_version": "1.0", "event_id": "41",
+					"attributes":    map[string]string{"src": "10.0.1.8", "dst": "10.0.0.5", "sev": "5", "srcPort": "81", "dstPort": "21"},
+					"syslog_header": "Jan 18 11:07:53 192.0.2.1",
+				},
+			},
+		},
+		{
+			name: "leef 2.0 hex delimiter",
+			data: "LEEF:2.0|Acme|Historian|3.1|WriteFailed|0x7C|sev=8|msg=No space left|identHostName=hist-01|devTime=Oct 17 2026 08:00:00",
+			want: LogMessage{
+				Timestamp: "2026-10-17T08:00:00Z",
+				Hostname:  "hist-01",
+				Severity:  "ERROR",
+				Service:   "Historian",
+				Message:   "WriteFailed: No space left",
+				Context: map[string]interface{}{
+					"leef_version": "2.0", "vendor": "Acme", "product": "Historian",
+					"product_version": "3.1", "event_id": "WriteFailed",
+					"attributes": map[string]string{
+						"sev": "8", "msg": "No space left", "identHostName": "hist-01", "devTime": "Oct 17 2026 08:00:00",
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeLEEF([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeLEEF() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeLEEF() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCEFErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode Decoder
+		data   string
+	}{
+		{"cef without header", decodeCEF, "Sep 19 08:26:10 host worm stopped"},
+		{"cef short header", decodeCEF, "CEF:0|Security|threatmanager|1.0"},
+		{"leef without header", decodeLEEF, "src=10.0.1.8\tdst=10.0.0.5"},
+		{"leef 2.0 without delimiter field", decodeLEEF, "LEEF:2.0|Lancope|StealthWatch|1.0|41|"},
+		{"leef 2.0 invalid delimiter", decodeLEEF, "LEEF:2.0|Lancope|StealthWatch|1.0|41|caret|src=10.0.1.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.decode([]byte(tt.data)); err == nil {
+				t.Errorf("decoded %q as %#v", tt.data, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// gelfMessage is a Graylog Extended Log Format message
+type gelfMessage struct {
+	Host         string   `json:"host"`
+	ShortMessage string   `json:"short_message"`
+	FullMessage  string   `json:"full_message"`
+	Timestamp    *float64 `json:"timestamp"` // Unix seconds
+	Level        *int     `json:"level"`     // Syslog severity
+	Facility     string   `json:"facility"`  // Deprecated, still sent by older clients
+}
+
+// gelfServiceFields are the additional fields senders commonly name the application in
+var gelfServiceFields = []string{"_service", "_application_name", "_app", "_appname"}
+
+// decodeGELF parses a GELF message, plain or gzip or zlib compressed as sent over UDP.
+// Additional fields go into Context without their leading underscore.
+func decodeGELF(data []byte) (LogMessage, error) {
+	data, err := inflateGELF(data)
+	if err != nil {
+		return LogMessage{}, err
+	}
+
+	var gelf gelfMessage
+	if err := json.Unmarshal(data, &gelf); err != nil {
+		return LogMessage{}, fmt.Errorf("invalid GELF JSON: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return LogMessage{}, fmt.Errorf("invalid GELF JSON: %w", err)
+	}
+
+	logMsg := LogMessage{
+		Hostname: gelf.Host,
+		Service:  gelf.Facility,
+		Message:  gelf.ShortMessage,
+		Context:  make(map[string]interface{}),
+	}
+	if logMsg.Message == "" {
+		logMsg.Message = gelf.FullMessage
+	} else if gelf.FullMessage != "" {
+		logMsg.Context["full_message"] = gelf.FullMessage
+	}
+	if gelf.Level != nil {
+		logMsg.Severity = SyslogSeverity(*gelf.Level)
+	}
+	if gelf.Timestamp != nil {
+		sec := int64(*gelf.Timestamp)
+		logMsg.Timestamp = time.Unix(sec, int64((*gelf.Timestamp-float64(sec))*1e9)).UTC().Format(time.RFC3339Nano)
+	}
+	for _, key := range gelfServiceFields {
+		if service, ok := fields[key].(string); ok && service != "" {
+			logMsg.Service = service
+			break
+		}
+	}
+	if gelf.Facility != "" {
+		logMsg.Context["facility"] = gelf.Facility
+	}
+	for key, value := range fields {
+		if name, ok := strings.CutPrefix(key, "_"); ok && name != "id" {
+			logMsg.Context[name] = value
+		}
+	}
+	return logMsg, nil
+}
+
+// inflateGELF decompresses a gzip or zlib compressed message
+func inflateGELF(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) > 2 && data[0] == 0x78 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed GELF message: %w", err)
+	}
+	defer r.Close()
+	inflated, err := io.ReadAll(io.LimitReader(r, shared.GELFMaxMessage+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed GELF message: %w", err)
+	}
+	if len(inflated) > shared.GELFMaxMessage {
+		return nil, fmt.Errorf("GELF message larger than %d bytes", shared.GELFMaxMessage)
+	}
+	return inflated, nil
+}
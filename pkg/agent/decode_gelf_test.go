@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// gelfExample is the example message of the GELF specification
+const gelfExample = `{
+  "version": "1.1",
+  "host": "example.org",
+  "short_message": "A short message that helps you identify what is going on",
+  "full_message": "Backtrace here\n\nmore stuff",
+  "timestamp": 1385053862.3072,
+  "level": 1,
+  "_user_id": 9001,
+  "_some_info": "foo",
+  "_some_env_var": "bar"
+}`
+
+// gelfExampleLog is gelfExample decoded
+var gelfExampleLog = LogMessage{
+	Timestamp: "2013-11-21T17:11:02.307199954Z",
+	Hostname:  "example.org",
+	Severity:  "ALERT",
+	Message:   "A short message that helps you identify what is going on",
+	Context: map[string]interface{}{
+		"full_message": "Backtrace here\n\nmore stuff",
+		"user_id":      float64(9001),
+		"some_info":    "foo",
+		"some_env_var": "bar",
+	},
+}
+
+func TestDecodeGELF(t *testing.T) {
+	var gzipped, zlibbed bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte(gelfExample))
+	gz.Close()
+	zw := zlib.NewWriter(&zlibbed)
+	zw.Write([]byte(gelfExample))
+	zw.Close()
+
+	tests := []struct {
+		name string
+		data []byte
+		want LogMessage
+	}{
+		{"specification example", []byte(gelfExample), gelfExampleLog},
+		{"gzip", gzipped.Bytes(), gelfExampleLog},
+		{"zlib", zlibbed.Bytes(), gelfExampleLog},
+		{
+			name: "service field and facility",
+			data: []byte(`{"version":"1.1","host":"plc-01","short_message":"Belt stopped","level":4,"facility":"conveyor","_service":"belt-ctl","_id":"ignored"}`),
+			want: LogMessage{
+				Hostname: "plc-01",
+				Severity: "WARN",
+				Service:  "belt-ctl",
+				Message:  "Belt stopped",
+				Context:  map[string]interface{}{"facility": "conveyor", "service": "belt-ctl"},
+			},
+		},
+		{
+			name: "full message only",
+			data: []byte(`{"version":"1.1","host":"plc-01","full_message":"Line one\nline two","facility":"historian"}`),
+			want: LogMessage{
+				Hostname: "plc-01",
+				Service:  "historian",
+				Message:  "Line one\nline two",
+				Context:  map[string]interface{}{"facility": "historian"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeGELF(tt.data)
+			if err != nil {
+				t.Fatalf("decodeGELF() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeGELF() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeGELFErrors(t *testing.T) {
+	var bomb bytes.Buffer
+	gz := gzip.NewWriter(&bomb)
+	gz.Write([]byte(`{"short_message":"` + strings.Repeat("a", 2<<20) + `"}`))
+	gz.Close()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not json", []byte("Belt stopped")},
+		{"truncated gzip", bomb.Bytes()[:20]},
+		{"larger than the limit once inflated", bomb.Bytes()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeGELF(tt.data); err == nil {
+				t.Errorf("decodeGELF() = %#v", got)
+			}
+		})
+	}
+}
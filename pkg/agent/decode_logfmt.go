@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodeLogfmt parses a logfmt line such as `time=2024-05-01T10:00:00Z level=warn msg="disk
+// almost full" host=plc-gw-01`. Well-known keys fill the log fields and the rest go into
+// Context; keys without a value are recorded as true.
+func decodeLogfmt(data []byte) (LogMessage, error) {
+	fields, err := parseLogfmt(strings.TrimSpace(string(data)))
+	if err != nil {
+		return LogMessage{}, err
+	}
+
+	logMsg := LogMessage{Context: make(map[string]interface{})}
+	for _, f := range fields {
+		switch f.key {
+		case "msg", "message":
+			logMsg.Message = f.value
+		case "level", "lvl", "severity":
+			logMsg.Severity = strings.ToUpper(f.value)
+		case "host", "hostname":
+			logMsg.Hostname = f.value
+		case "service", "app", "component":
+			logMsg.Service = f.value
+		case "time", "ts", "timestamp":
+			if t, err := time.Parse(time.RFC3339Nano, f.value); err == nil {
+				logMsg.Timestamp = t.UTC().Format(time.RFC3339Nano)
+			} else {
+				logMsg.Context[f.key] = f.value
+			}
+		default:
+			if f.bare {
+				logMsg.Context[f.key] = true
+			} else {
+				logMsg.Context[f.key] = f.value
+			}
+		}
+	}
+	return logMsg, nil
+}
+
+// logfmtField is one key=value pair of a logfmt line
+type logfmtField struct {
+	key   string
+	value string
+	bare  bool // The key had no value
+}
+
+// parseLogfmt splits a logfmt line into its pairs, unquoting quoted values
+func parseLogfmt(line string) ([]logfmtField, error) {
+	var fields []logfmtField
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields, nil
+		}
+
+		end := strings.IndexAny(line, "= \t")
+		if end < 0 {
+			end = len(line)
+		}
+		key := line[:end]
+		if key == "" {
+			return nil, fmt.Errorf("invalid logfmt: value without a key at %q", truncate(line, 20))
+		}
+		line = line[end:]
+		if !strings.HasPrefix(line, "=") {
+			fields = append(fields, logfmtField{key: key, bare: true})
+			continue
+		}
+		line = line[1:]
+
+		if !strings.HasPrefix(line, `"`) {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, logfmtField{key: key, value: line[:end]})
+			line = line[end:]
+			continue
+		}
+
+		quoted, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logfmt: unterminated value of %q", key)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logfmt value of %q: %w", key, err)
+		}
+		fields = append(fields, logfmtField{key: key, value: value})
+		line = line[len(quoted):]
+	}
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeLogfmt(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want LogMessage
+	}{
+		{
+			name: "well-known keys",
+			data: `time=2024-05-01T10:00:00+02:00 level=warn msg="disk almost full" host=plc-gw-01 service=historian`,
+			want: LogMessage{
+				Timestamp: "2024-05-01T08:00:00Z",
+				Hostname:  "plc-gw-01",
+				Severity:  "WARN",
+				Service:   "historian",
+				Message:   "disk almost full",
+				Context:   map[string]interface{}{},
+			},
+		},
+		{
+			name: "aliases and extra keys",
+			data: "ts=2024-05-01T10:00:00.25Z lvl=error app=conveyor hostname=plc-01 message=stopped belt=3 speed=0.0",
+			want: LogMessage{
+				Timestamp: "2024-05-01T10:00:00.25Z",
+				Hostname:  "plc-01",
+				Severity:  "ERROR",
+				Service:   "conveyor",
+				Message:   "stopped",
+				Context:   map[string]interface{}{"belt": "3", "speed": "0.0"},
+			},
+		},
+		{
+			name: "bare keys, empty and escaped values",
+			data: "level=info  msg=\"said \\\"hi\\\"\\tthen left\" retry dry_run= component=auth\t",
+			want: LogMessage{
+				Severity: "INFO",
+				Service:  "auth",
+				Message:  "said \"hi\"\tthen left",
+				Context:  map[string]interface{}{"retry": true, "dry_run": ""},
+			},
+		},
+		{
+			name: "unparsable time stays in context",
+			data: "time=yesterday msg=late",
+			want: LogMessage{
+				Message: "late",
+				Context: map[string]interface{}{"time": "yesterday"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeLogfmt([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeLogfmt() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeLogfmt() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLogfmtErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"value without a key", `level=warn ="orphan"`},
+		{"unterminated value", `level=warn msg="disk almost full`},
+		{"invalid escape", `msg="bad \q escape"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeLogfmt([]byte(tt.data)); err == nil {
+				t.Errorf("decodeLogfmt(%q) = %#v", tt.data, got)
+			}
+		})
+	}
+}
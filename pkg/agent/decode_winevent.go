@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// winEvent is a Windows event as rendered to XML by the Event Log API, wevtutil or Windows
+// Event Forwarding
+type winEvent struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		} `xml:"Provider"`
+		EventID     string `xml:"EventID"`
+		Level       string `xml:"Level"`
+		Task        string `xml:"Task"`
+		Opcode      string `xml:"Opcode"`
+		Keywords    string `xml:"Keywords"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		EventRecordID string `xml:"EventRecordID"`
+		Execution     struct {
+			ProcessID string `xml:"ProcessID,attr"`
+			ThreadID  string `xml:"ThreadID,attr"`
+		} `xml:"Execution"`
+		Channel  string `xml:"Channel"`
+		Computer string `xml:"Computer"`
+		Security struct {
+			UserID string `xml:"UserID,attr"`
+		} `xml:"Security"`
+	} `xml:"System"`
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+	UserData struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"UserData"`
+	RenderingInfo struct {
+		Message string `xml:"Message"`
+	} `xml:"RenderingInfo"`
+}
+
+// winEventLevels names the standard Windows event levels; level 0, LogAlways, is informational
+var winEventLevels = map[string]string{
+	"0": "INFO", "1": "CRITICAL", "2": "ERROR", "3": "WARN", "4": "INFO", "5": "DEBUG",
+}
+
+// winAuditFailure is the keyword bit Windows sets on failed security audits, which are
+// logged at level 0
+const winAuditFailure = 0x10000000000000
+
+// decodeWinEvent parses a single Windows event in its XML rendering. The rendered message is
+// used when the sender included RenderingInfo; otherwise the message names the event and
+// lists its data.
+func decodeWinEvent(data []byte) (LogMessage, error) {
+	var event winEvent
+	if err := xml.Unmarshal(data, &event); err != nil {
+		return LogMessage{}, fmt.Errorf("invalid Windows event XML: %w", err)
+	}
+	sys := event.System
+	if sys.EventID == "" {
+		return LogMessage{}, fmt.Errorf("Windows event has no EventID")
+	}
+
+	eventData := make(map[string]interface{})
+	var pairs []string
+	for i, d := range event.EventData.Data {
+		name := d.Name
+		if name == "" {
+			name = fmt.Sprintf("Data%d", i)
+		}
+		value := strings.TrimSpace(d.Value)
+		eventData[name] = value
+		pairs = append(pairs, name+"="+value)
+	}
+
+	logMsg := LogMessage{
+		Hostname: sys.Computer,
+		Severity: winEventLevels[strings.TrimSpace(sys.Level)],
+		Service:  sys.Provider.Name,
+		Message:  strings.TrimSpace(event.RenderingInfo.Message),
+		Context: map[string]interface{}{
+			"event_id": strings.TrimSpace(sys.EventID),
+			"channel":  sys.Channel,
+			"level":    sys.Level,
+		},
+	}
+	if logMsg.Message == "" {
+		logMsg.Message = fmt.Sprintf("Event %s from %s", strings.TrimSpace(sys.EventID), sys.Provider.Name)
+		if len(pairs) > 0 {
+			logMsg.Message += ": " + strings.Join(pairs, " ")
+		}
+	}
+	if keywords, err := strconv.ParseUint(strings.TrimPrefix(sys.Keywords, "0x"), 16, 64); err == nil && keywords&winAuditFailure != 0 {
+		logMsg.Severity = "WARN"
+		logMsg.Context["audit_failure"] = true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, sys.TimeCreated.SystemTime); err == nil {
+		logMsg.Timestamp = t.UTC().Format(time.RFC3339Nano)
+	}
+
+	optional := map[string]string{
+		"task":       sys.Task,
+		"opcode":     sys.Opcode,
+		"keywords":   sys.Keywords,
+		"record_id":  sys.EventRecordID,
+		"process_id": sys.Execution.ProcessID,
+		"thread_id":  sys.Execution.ThreadID,
+		"user_id":    sys.Security.UserID,
+	}
+	for key, value := range optional {
+		if value != "" {
+			logMsg.Context[key] = value
+		}
+	}
+	if len(eventData) > 0 {
+		logMsg.Context["event_data"] = eventData
+	}
+	if inner := strings.TrimSpace(event.UserData.Inner); inner != "" {
+		logMsg.Context["user_data"] = inner
+	}
+	return logMsg, nil
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+// winLogonFailure is a failed logon audit as rendered by wevtutil, without RenderingInfo
+const winLogonFailure = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Microsoft-Windows-Security-Auditing" Guid="{54849625-5478-4994-A5BA-3E3B0328C30D}"/>
+    <EventID>4625</EventID>
+    <Version>0</Version>
+    <Level>0</Level>
+    <Task>12544</Task>
+    <Opcode>0</Opcode>
+    <Keywords>0x8010000000000000</Keywords>
+    <TimeCreated SystemTime="2026-10-17T08:00:00.1234567Z"/>
+    <EventRecordID>90210</EventRecordID>
+    <Execution ProcessID="684" ThreadID="1804"/>
+    <Channel>Security</Channel>
+    <Computer>hmi-01.plant.local</Computer>
+    <Security/>
+  </System>
+  <EventData>
+    <Data Name="TargetUserName">operator</Data>
+    <Data Name="LogonType">10</Data>
+    <Data Name="IpAddress">192.0.2.40</Data>
+  </EventData>
+</Event>`
+
+// winServiceStopped is a System channel event forwarded with its rendered message
+const winServiceStopped = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Service Control Manager"/>
+    <EventID Qualifiers="49152">7034</EventID>
+    <Level>2</Level>
+    <Keywords>0x8080000000000000</Keywords>
+    <TimeCreated SystemTime="2026-10-17T08:05:00Z"/>
+    <Channel>System</Channel>
+    <Computer>hmi-01.plant.local</Computer>
+    <Security UserID="S-1-5-18"/>
+  </System>
+  <EventData>
+    <Data>OPC UA Server</Data>
+    <Data>1</Data>
+  </EventData>
+  <RenderingInfo Culture="en-US">
+    <Message>The OPC UA Server service terminated unexpectedly.  It has done this 1 time(s).</Message>
+  </RenderingInfo>
+</Event>`
+
+// winUserData is an event carrying UserData instead of EventData
+const winUserData = `<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System>
+    <Provider Name="Microsoft-Windows-Eventlog"/>
+    <EventID>1102</EventID>
+    <Level>4</Level>
+    <Channel>Security</Channel>
+    <Computer>hmi-02</Computer>
+  </System>
+  <UserData><LogFileCleared><SubjectUserName>admin</SubjectUserName></LogFileCleared></UserData>
+</Event>`
+
+func TestDecodeWinEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want LogMessage
+	}{
+		{
+			name: "failed audit without rendering",
+			data: winLogonFailure,
+			want: LogMessage{
+				Timestamp: "2026-10-17T08:00:00.1234567Z",
+				Hostname:  "hmi-01.plant.local",
+				Severity:  "WARN",
+				Service:   "Microsoft-Windows-Security-Auditing",
+				Message:   "Event 4625 from Microsoft-Windows-Security-Auditing: TargetUserName=operator LogonType=10 IpAddress=192.0.2.40",
+				Context: map[string]interface{}{
+					"event_id": "4625", "channel": "Security", "level": "0", "audit_failure": true,
+					"task": "12544", "opcode": "0", "keywords": "0x8010000000000000", "record_id": "90210",
+					"process_id": "684", "thread_id": "1804",
+					"event_data": map[string]interface{}{"TargetUserName": "operator", "LogonType": "10", "IpAddress": "192.0.2.40"},
+				},
+			},
+		},
+		{
+			name: "rendered message and unnamed data",
+			data: winServiceStopped,
+			want: LogMessage{
+				Timestamp: "2026-10-17T08:05:00Z",
+				Hostname:  "hmi-01.plant.local",
+				Severity:  "ERROR",
+				Service:   "Service Control Manager",
+				Message:   "The OPC UA Server service terminated unexpectedly.  It has done this 1 time(s).",
+				Context: map[string]interface{}{
+					"event_id": "7034", "channel": "System", "level": "2",
+					"keywords": "0x8080000000000000", "user_id": "S-1-5-18",
+					"event_data": map[string]interface{}{"Data0": "OPC UA Server", "Data1": "1"},
+				},
+			},
+		},
+		{
+			name: "user data",
+			data: winUserData,
+			want: LogMessage{
+				Hostname: "hmi-02",
+				Severity: "INFO",
+				Service:  "Microsoft-Windows-Eventlog",
+				Message:  "Event 1102 from Microsoft-Windows-Eventlog",
+				Context: map[string]interface{}{
+					"event_id": "1102", "channel": "Security", "level": "4",
+					"user_data": "<LogFileCleared><SubjectUserName>admin</SubjectUserName></LogFileCleared>",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeWinEvent([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeWinEvent() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeWinEvent() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeWinEventErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not xml", "Event 4625 from Security"},
+		{"no event id", `<Event><System><Provider Name="Service Control Manager"/></System></Event>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decodeWinEvent([]byte(tt.data)); err == nil {
+				t.Errorf("decodeWinEvent() = %#v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// DLQEntry is the record published to the dead-letter stream for a failed log
+type DLQEntry struct {
+	Subject   string      `json:"subject"`
+	Payload   []byte      `json:"payload"`
+	Header    nats.Header `json:"header,omitempty"`
+	Reason    string      `json:"reason"`
+	Error     string      `json:"error"`
+	Provider  string      `json:"provider"` // Providers that failed the analysis, comma separated; empty for other failures
+	Attempts  uint64      `json:"attempts"`
+	StreamSeq uint64      `json:"stream_seq"`
+	FailedAt  time.Time   `json:"failed_at"`
+}
+
+// DLQMessage is a dead-letter entry together with its sequence in the DLQ stream
+type DLQMessage struct {
+	Seq   uint64
+	Entry DLQEntry
+}
+
+// maxDeliveriesAdvisory is the payload of the JetStream max deliveries advisory
+type maxDeliveriesAdvisory struct {
+	Stream     string `json:"stream"`
+	Consumer   string `json:"consumer"`
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries uint64 `json:"deliveries"`
+}
+
+// deadLetter publishes the original message and failure details to the DLQ stream
+func (s *Service) deadLetter(msg *nats.Msg, perr *processingError, attempts uint64) error {
+	entry := DLQEntry{
+		Subject:  msg.Subject,
+		Payload:  msg.Data,
+		Header:   msg.Header,
+		Reason:   perr.reason,
+		Error:    perr.Error(),
+		Provider: s.failedProviders(perr),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		entry.StreamSeq = meta.Sequence.Stream
+	}
+	return s.publishDLQ(entry)
+}
+
+// failedProviders names the providers behind an analysis failure: those the fallback chain
+// called, or the analyzer itself when it is not a chain
+func (s *Service) failedProviders(perr *processingError) string {
+	if perr.reason != reasonAnalysis {
+		return ""
+	}
+	var chainErr *chainError
+	if errors.As(perr, &chainErr) {
+		return strings.Join(chainErr.failed, ",")
+	}
+	return s.analyzer.Name()
+}
+
+func (s *Service) publishDLQ(entry DLQEntry, opts ...nats.PubOpt) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DLQ entry: %w", err)
+	}
+	if _, err := s.js.Publish(shared.DLQSubjectName, data, opts...); err != nil {
+		return fmt.Errorf("failed to publish DLQ entry: %w", err)
+	}
+	return nil
+}
+
+// handleMaxDeliveries dead-letters messages the server gave up on without a verdict from the agent
+func (s *Service) handleMaxDeliveries(msg *nats.Msg) {
+	var advisory maxDeliveriesAdvisory
+	if err := json.Unmarshal(msg.Data, &advisory); err != nil {
+		log.Printf("Error unmarshaling max deliveries advisory: %v", err)
+		return
+	}
+
+	raw, err := s.js.GetMsg(advisory.Stream, advisory.StreamSeq)
+	if err != nil {
+		log.Printf("Error loading exhausted message %d: %v", advisory.StreamSeq, err)
+		return
+	}
+
+	entry := DLQEntry{
+		Subject:   raw.Subject,
+		Payload:   raw.Data,
+		Header:    raw.Header,
+		Reason:    reasonMaxDeliveries,
+		Error:     fmt.Sprintf("not acknowledged after %d deliveries", advisory.Deliveries),
+		Attempts:  advisory.Deliveries,
+		StreamSeq: advisory.StreamSeq,
+		FailedAt:  time.Now().UTC(),
+	}
+	// The message ID lets the DLQ stream drop a second copy should the advisory be handled twice
+	msgID := fmt.Sprintf("max-deliveries-%s-%d", advisory.Stream, advisory.StreamSeq)
+	if err := s.publishDLQ(entry, nats.MsgId(msgID)); err != nil {
+		log.Printf("Error dead-lettering exhausted message %d: %v", advisory.StreamSeq, err)
+		return
+	}
+	log.Printf("Dead-lettered message %d after %d deliveries", advisory.StreamSeq, advisory.Deliveries)
+}
+
+// ListDLQ returns up to limit entries from the dead-letter stream, oldest first
+func ListDLQ(js nats.JetStreamContext, limit int) ([]DLQMessage, error) {
+	info, err := js.StreamInfo(shared.DLQStreamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DLQ stream info: %w", err)
+	}
+
+	var entries []DLQMessage
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq && info.State.Msgs > 0; seq++ {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		entry, err := GetDLQEntry(js, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, DLQMessage{Seq: seq, Entry: *entry})
+	}
+	return entries, nil
+}
+
+// GetDLQEntry loads a single dead-letter entry by its DLQ stream sequence
+func GetDLQEntry(js nats.JetStreamContext, seq uint64) (*DLQEntry, error) {
+	raw, err := js.GetMsg(shared.DLQStreamName, seq)
+	if err != nil {
+		return nil, err
+	}
+	var entry DLQEntry
+	if err := json.Unmarshal(raw.Data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DLQ entry %d: %w", seq, err)
+	}
+	return &entry, nil
+}
+
+// RedriveDLQ republishes a dead-lettered log to its original subject and removes it from the DLQ
+func RedriveDLQ(js nats.JetStreamContext, seq uint64) error {
+	entry, err := GetDLQEntry(js, seq)
+	if err != nil {
+		return fmt.Errorf("failed to load DLQ entry %d: %w", seq, err)
+	}
+
+	subject := entry.Subject
+	if subject == "" {
+		subject = shared.SubjectName
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = entry.Payload
+	for key, values := range entry.Header {
+		// Server-managed headers such as Nats-Msg-Id would make the republish a duplicate
+		if strings.HasPrefix(key, "Nats-") {
+			continue
+		}
+		for _, value := range values {
+			msg.Header.Add(key, value)
+		}
+	}
+
+	if _, err := js.PublishMsg(msg); err != nil {
+		return fmt.Errorf("failed to republish DLQ entry %d: %w", seq, err)
+	}
+	if err := js.DeleteMsg(shared.DLQStreamName, seq); err != nil {
+		return fmt.Errorf("failed to remove DLQ entry %d: %w", seq, err)
+	}
+	return nil
+}
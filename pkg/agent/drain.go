@@ -0,0 +1,334 @@
+package agent
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// drainMaxChildren caps the children of a prefix node; further tokens share a wildcard child
+const drainMaxChildren = 100
+
+// Template match outcomes
+const (
+	templateNew     = "new"     // First log of a new template
+	templateChanged = "changed" // Template was generalized to admit the log
+	templateKnown   = "known"   // Log matched an existing template unchanged
+)
+
+// LogTemplate is a message pattern mined from the log stream, with variable tokens as "<*>"
+type LogTemplate struct {
+	ID            int64
+	Service       string // Templates are mined separately per service
+	Tokens        []string
+	Count         int64
+	AnalysisLogID int64 // Log whose analysis is reused for the template, zero if none
+}
+
+// String returns the template text
+func (t *LogTemplate) String() string {
+	return strings.Join(t.Tokens, " ")
+}
+
+// drainNode is a node of the Drain prefix tree
+type drainNode struct {
+	parent    *drainNode // Nil for the root of a service and token count
+	key       string     // Key of the node in its parent's children, or in Drain.root
+	children  map[string]*drainNode
+	templates []*LogTemplate
+}
+
+func newDrainNode(parent *drainNode, key string) *drainNode {
+	return &drainNode{parent: parent, key: key, children: make(map[string]*drainNode)}
+}
+
+// drainEntry locates a template in the tree and in the least recently seen order
+type drainEntry struct {
+	template *LogTemplate
+	leaf     *drainNode
+	elem     *list.Element
+}
+
+// Drain is an online log template miner following He et al., "Drain: An Online Log Parsing
+// Approach with Fixed Depth Tree". Logs are routed by service, token count and their leading
+// tokens to a small set of candidate templates, and join the most similar one if it shares at
+// least similarity of its tokens; otherwise they start a new template. Beyond limit templates,
+// the least recently seen one is forgotten.
+type Drain struct {
+	mu         sync.Mutex
+	depth      int
+	similarity float64
+	limit      int
+	root       map[string]*drainNode // Keyed by service and token count
+	byID       map[int64]*drainEntry
+	lru        *list.List // Templates, most recently seen first
+	nextID     int64
+}
+
+// NewDrain creates a miner with the given tree depth (at least 3), similarity threshold and
+// template limit, unlimited when zero
+func NewDrain(depth int, similarity float64, limit int) *Drain {
+	if depth < 3 {
+		depth = 3
+	}
+	return &Drain{
+		depth:      depth,
+		similarity: similarity,
+		limit:      limit,
+		root:       make(map[string]*drainNode),
+		byID:       make(map[int64]*drainEntry),
+		lru:        list.New(),
+		nextID:     1,
+	}
+}
+
+// Restore adds a previously mined template, e.g. one loaded from the database, as the most
+// recently seen one
+func (d *Drain) Restore(t *LogTemplate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t.ID >= d.nextID {
+		d.nextID = t.ID + 1
+	}
+	d.add(t, d.leaf(t.Service, t.Tokens))
+}
+
+// add files a template under its leaf as the most recently seen one, then forgets the least
+// recently seen templates over the limit. The caller must hold d.mu.
+func (d *Drain) add(t *LogTemplate, leaf *drainNode) {
+	leaf.templates = append(leaf.templates, t)
+	d.byID[t.ID] = &drainEntry{template: t, leaf: leaf, elem: d.lru.PushFront(t.ID)}
+	for d.limit > 0 && d.lru.Len() > d.limit {
+		d.evict(d.lru.Back().Value.(int64))
+	}
+}
+
+// evict forgets a template and prunes the tree nodes left empty. The caller must hold d.mu.
+func (d *Drain) evict(id int64) {
+	e := d.byID[id]
+	delete(d.byID, id)
+	d.lru.Remove(e.elem)
+
+	node := e.leaf
+	for i, t := range node.templates {
+		if t == e.template {
+			node.templates = append(node.templates[:i], node.templates[i+1:]...)
+			break
+		}
+	}
+	for len(node.templates) == 0 && len(node.children) == 0 {
+		if node.parent == nil {
+			delete(d.root, node.key)
+			return
+		}
+		delete(node.parent.children, node.key)
+		node = node.parent
+	}
+}
+
+// Match assigns a service's message to a template, creating or generalizing one as needed. It
+// returns a copy of the template, the message tokens at its wildcard positions and the match outcome.
+func (d *Drain) Match(service, message string) (LogTemplate, []string, string) {
+	tokens, original := tokenize(message)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	best, bestSim := d.find(service, tokens)
+
+	status := templateKnown
+	if best == nil || bestSim < d.similarity {
+		best = &LogTemplate{ID: d.nextID, Service: service, Tokens: append([]string(nil), tokens...)}
+		d.nextID++
+		d.add(best, d.leaf(service, tokens))
+		status = templateNew
+	} else {
+		d.lru.MoveToFront(d.byID[best.ID].elem)
+		for i, token := range tokens {
+			if best.Tokens[i] != token && best.Tokens[i] != maskToken {
+				best.Tokens[i] = maskToken
+				status = templateChanged
+			}
+		}
+	}
+	best.Count++
+
+	return copyTemplate(best), templateParams(best, original), status
+}
+
+// Lookup finds the template a service's message matches without counting the message or
+// generalizing the template, for messages Match has already seen. It reports false when no
+// template is similar enough; the outcome is changed when the template would have to be
+// generalized to admit the message.
+func (d *Drain) Lookup(service, message string) (LogTemplate, []string, string, bool) {
+	tokens, original := tokenize(message)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	best, bestSim := d.find(service, tokens)
+	if best == nil || bestSim < d.similarity {
+		return LogTemplate{}, nil, "", false
+	}
+	status := templateKnown
+	for i, token := range tokens {
+		if best.Tokens[i] != token && best.Tokens[i] != maskToken {
+			status = templateChanged
+		}
+	}
+	return copyTemplate(best), templateParams(best, original), status, true
+}
+
+// find returns the template most similar to tokens and its similarity. Templates generalized at
+// a prefix position sit under the wildcard child, so when the leaf of the concrete tokens holds
+// no template similar enough, the leaves reached through wildcard children are searched too.
+// The caller must hold d.mu.
+func (d *Drain) find(service string, tokens []string) (*LogTemplate, float64) {
+	best, bestSim, bestParams := (*LogTemplate)(nil), -1.0, -1
+	for i, leaf := range d.leaves(service, tokens) {
+		if i > 0 && best != nil && bestSim >= d.similarity {
+			break
+		}
+		for _, t := range leaf.templates {
+			sim, params := templateSimilarity(t.Tokens, tokens)
+			if sim > bestSim || (sim == bestSim && params > bestParams) {
+				best, bestSim, bestParams = t, sim, params
+			}
+		}
+	}
+	return best, bestSim
+}
+
+// copyTemplate returns a copy of t the caller may keep outside d.mu
+func copyTemplate(t *LogTemplate) LogTemplate {
+	c := *t
+	c.Tokens = append([]string(nil), t.Tokens...)
+	return c
+}
+
+// tokenize splits a message into its normalized tokens and, at the same positions, the message
+// fields they were normalized from. Each field is normalized on its own, so a token always
+// lines up with its field however the message is spaced.
+func tokenize(message string) (tokens, original []string) {
+	original = strings.Fields(message)
+	tokens = make([]string, len(original))
+	for i, field := range original {
+		tokens[i] = normalizeMessage(field)
+	}
+	return tokens, original
+}
+
+// templateParams returns the message fields at the template's wildcard positions, given the
+// fields tokenize returned alongside the tokens matched to it
+func templateParams(t *LogTemplate, original []string) []string {
+	var params []string
+	for i, token := range t.Tokens {
+		if strings.Contains(token, maskToken) {
+			params = append(params, original[i])
+		}
+	}
+	return params
+}
+
+// SetAnalysis records the log whose analysis is reused for a template
+func (d *Drain) SetAnalysis(id, logID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.byID[id]; ok {
+		e.template.AnalysisLogID = logID
+	}
+}
+
+// ClearAnalysis stops reusing a template's analysis if it is the one of logID, or whatever it
+// is when logID is zero, and reports whether it did
+func (d *Drain) ClearAnalysis(id, logID int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.byID[id]
+	if !ok || e.template.AnalysisLogID == 0 || (logID != 0 && e.template.AnalysisLogID != logID) {
+		return false
+	}
+	e.template.AnalysisLogID = 0
+	return true
+}
+
+// leaf finds or creates the leaf for a token sequence. The caller must hold d.mu.
+func (d *Drain) leaf(service string, tokens []string) *drainNode {
+	key := fmt.Sprintf("%s/%d", service, len(tokens))
+	node, ok := d.root[key]
+	if !ok {
+		node = newDrainNode(nil, key)
+		d.root[key] = node
+	}
+
+	for i := 0; i < d.depth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		if strings.Contains(key, maskToken) {
+			key = maskToken
+		}
+		child, ok := node.children[key]
+		if !ok {
+			if len(node.children) >= drainMaxChildren {
+				key = maskToken
+				child = node.children[key]
+			}
+			if child == nil {
+				child = newDrainNode(node, key)
+				node.children[key] = child
+			}
+		}
+		node = child
+	}
+	return node
+}
+
+// leaves returns the existing leaves a token sequence can reach, taking at every prefix
+// position either the token's own child or the wildcard child. The leaf of the concrete tokens,
+// the one leaf routes to, comes first. The caller must hold d.mu.
+func (d *Drain) leaves(service string, tokens []string) []*drainNode {
+	node, ok := d.root[fmt.Sprintf("%s/%d", service, len(tokens))]
+	if !ok {
+		return nil
+	}
+	var leaves []*drainNode
+	var walk func(node *drainNode, i int)
+	walk = func(node *drainNode, i int) {
+		if i >= d.depth-2 || i >= len(tokens) {
+			leaves = append(leaves, node)
+			return
+		}
+		key := tokens[i]
+		if strings.Contains(key, maskToken) {
+			key = maskToken
+		}
+		if child, ok := node.children[key]; ok {
+			walk(child, i+1)
+		}
+		if child, ok := node.children[maskToken]; ok && key != maskToken {
+			walk(child, i+1)
+		}
+	}
+	walk(node, 0)
+	return leaves
+}
+
+// templateSimilarity returns the share of template tokens equal to the message tokens and the
+// number of wildcards in the template
+func templateSimilarity(template, tokens []string) (float64, int) {
+	if len(template) == 0 {
+		return 1, 0
+	}
+	same, params := 0, 0
+	for i, t := range template {
+		if t == maskToken {
+			params++
+			continue
+		}
+		if t == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template)), params
+}
@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDrainMatch(t *testing.T) {
+	type step struct {
+		service string
+		message string
+		want    string   // Template after the match
+		params  []string // Message tokens at the template's wildcards
+		status  string
+		id      int64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "numbers are masked before mining",
+			steps: []step{
+				{"historian", "Connection to 10.0.0.5:5432 lost after 30 retries", "Connection to <*> lost after <*> retries", []string{"10.0.0.5:5432", "30"}, templateNew, 1},
+				{"historian", "Connection to 10.0.0.9:5432 lost after 2 retries", "Connection to <*> lost after <*> retries", []string{"10.0.0.9:5432", "2"}, templateKnown, 1},
+			},
+		},
+		{
+			name: "differing tokens generalize the template",
+			steps: []step{
+				{"conveyor", "Belt stopped by operator alice", "Belt stopped by operator alice", nil, templateNew, 1},
+				{"conveyor", "Belt stopped by operator bob", "Belt stopped by operator <*>", []string{"bob"}, templateChanged, 1},
+				{"conveyor", "Belt stopped by operator carol", "Belt stopped by operator <*>", []string{"carol"}, templateKnown, 1},
+			},
+		},
+		{
+			name: "dissimilar messages start new templates",
+			steps: []step{
+				{"conveyor", "Belt stopped by operator alice", "Belt stopped by operator alice", nil, templateNew, 1},
+				{"conveyor", "Belt started after maintenance window closed", "Belt started after maintenance window closed", nil, templateNew, 2},
+			},
+		},
+		{
+			name: "token counts are mined separately",
+			steps: []step{
+				{"conveyor", "Belt stopped", "Belt stopped", nil, templateNew, 1},
+				{"conveyor", "Belt stopped again", "Belt stopped again", nil, templateNew, 2},
+			},
+		},
+		{
+			name: "services are mined separately",
+			steps: []step{
+				{"conveyor", "Sensor offline", "Sensor offline", nil, templateNew, 1},
+				{"historian", "Sensor offline", "Sensor offline", nil, templateNew, 2},
+			},
+		},
+		{
+			name: "parameters are the original fields",
+			steps: []step{
+				{"batch", "Job\u00a0id=0x1f3a9c failed after 3.5s on host-07", "Job id=<*> failed after <*>s on host-<*>", []string{"id=0x1f3a9c", "3.5s", "host-07"}, templateNew, 1},
+			},
+		},
+		{
+			name: "whitespace runs keep parameters aligned",
+			steps: []step{
+				{"plc", "Valve  7\topened at 40%", "Valve <*> opened at <*>%", []string{"7", "40%"}, templateNew, 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDrain(4, 0.5, 0)
+			for i, s := range tt.steps {
+				template, params, status := d.Match(s.service, s.message)
+				if got := template.String(); got != s.want {
+					t.Errorf("step %d: template = %q, want %q", i, got, s.want)
+				}
+				if !reflect.DeepEqual(params, s.params) {
+					t.Errorf("step %d: params = %q, want %q", i, params, s.params)
+				}
+				if status != s.status {
+					t.Errorf("step %d: status = %s, want %s", i, status, s.status)
+				}
+				if template.ID != s.id {
+					t.Errorf("step %d: template ID = %d, want %d", i, template.ID, s.id)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		message  string
+		tokens   []string
+		original []string
+	}{
+		{"Belt stopped", []string{"Belt", "stopped"}, []string{"Belt", "stopped"}},
+		{"  Valve  7\topened ", []string{"Valve", "<*>", "opened"}, []string{"Valve", "7", "opened"}},
+		{"Job\u00a0id=0x1f3a9c from 10.0.0.5:5432", []string{"Job", "id=<*>", "from", "<*>"}, []string{"Job", "id=0x1f3a9c", "from", "10.0.0.5:5432"}},
+		{"Request 123e4567-e89b-12d3-a456-426614174000 took 12ms", []string{"Request", "<*>", "took", "<*>ms"}, []string{"Request", "123e4567-e89b-12d3-a456-426614174000", "took", "12ms"}},
+		{"", []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		tokens, original := tokenize(tt.message)
+		if !reflect.DeepEqual(tokens, tt.tokens) || !reflect.DeepEqual(original, tt.original) {
+			t.Errorf("tokenize(%q) = %q, %q, want %q, %q", tt.message, tokens, original, tt.tokens, tt.original)
+		}
+	}
+}
+
+func TestDrainLookup(t *testing.T) {
+	d := NewDrain(4, 0.5, 0)
+	d.Match("conveyor", "Belt stopped by operator alice")
+	d.Match("conveyor", "Belt stopped by operator bob")
+
+	tests := []struct {
+		name    string
+		message string
+		found   bool
+		status  string
+		params  []string
+	}{
+		{"known", "Belt stopped by operator carol", true, templateKnown, []string{"carol"}},
+		{"would change", "Belt stopped by supervisor carol", true, templateChanged, []string{"carol"}},
+		{"unknown", "Sensor reading out of range", false, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, params, status, found := d.Lookup("conveyor", tt.message)
+			if found != tt.found || status != tt.status || !reflect.DeepEqual(params, tt.params) {
+				t.Errorf("Lookup(%q) = %q, %q, %s, %v", tt.message, template.String(), params, status, found)
+			}
+		})
+	}
+
+	// Lookup neither counts nor generalizes
+	template, _, _, _ := d.Lookup("conveyor", "Belt stopped by supervisor carol")
+	if template.Count != 2 || template.String() != "Belt stopped by operator <*>" {
+		t.Errorf("template after lookups = %q seen %d times", template.String(), template.Count)
+	}
+}
+
+func TestDrainRestore(t *testing.T) {
+	d := NewDrain(4, 0.5, 0)
+	d.Restore(&LogTemplate{ID: 7, Service: "conveyor", Tokens: []string{"Belt", "stopped", "by", "operator", "<*>"}, Count: 40, AnalysisLogID: 12})
+
+	template, params, status := d.Match("conveyor", "Belt stopped by operator dave")
+	if template.ID != 7 || template.Count != 41 || template.AnalysisLogID != 12 || status != templateKnown {
+		t.Errorf("Match() after Restore = %+v, %s", template, status)
+	}
+	if !reflect.DeepEqual(params, []string{"dave"}) {
+		t.Errorf("params = %q", params)
+	}
+	if template, _, _ := d.Match("conveyor", "Sensor offline"); template.ID != 8 {
+		t.Errorf("new template ID = %d, want 8", template.ID)
+	}
+
+	d.SetAnalysis(7, 13)
+	if template, _, _ := d.Match("conveyor", "Belt stopped by operator erin"); template.AnalysisLogID != 13 {
+		t.Errorf("AnalysisLogID = %d, want 13", template.AnalysisLogID)
+	}
+	if d.ClearAnalysis(7, 12) {
+		t.Error("ClearAnalysis() cleared another log's analysis")
+	}
+	if !d.ClearAnalysis(7, 13) {
+		t.Error("ClearAnalysis() kept the template's analysis")
+	}
+	if template, _, _ := d.Match("conveyor", "Belt stopped by operator erin"); template.AnalysisLogID != 0 {
+		t.Errorf("AnalysisLogID = %d after ClearAnalysis", template.AnalysisLogID)
+	}
+
+	// A template generalized at a prefix position is found from any token there
+	d.Restore(&LogTemplate{ID: 9, Service: "auth", Tokens: []string{"<*>", "logged", "in", "from", "console"}, Count: 3})
+	template, params, status = d.Match("auth", "frank logged in from console")
+	if template.ID != 9 || status != templateKnown || !reflect.DeepEqual(params, []string{"frank"}) {
+		t.Errorf("Match() of a prefix wildcard = %+v, %q, %s", template, params, status)
+	}
+}
+
+func TestDrainLimit(t *testing.T) {
+	d := NewDrain(4, 0.5, 2)
+	d.Restore(&LogTemplate{ID: 1, Service: "conveyor", Tokens: []string{"Belt", "stopped", "by", "operator", "<*>"}})
+	d.Restore(&LogTemplate{ID: 2, Service: "conveyor", Tokens: []string{"Sensor", "offline"}, AnalysisLogID: 7})
+
+	// Seeing the older template makes the newer one the least recently seen
+	if template, _, _ := d.Match("conveyor", "Belt stopped by operator alice"); template.ID != 1 {
+		t.Fatalf("Match() = template %d, want 1", template.ID)
+	}
+	if template, _, status := d.Match("historian", "Archive rotated"); template.ID != 3 || status != templateNew {
+		t.Fatalf("Match() = template %d %s, want new template 3", template.ID, status)
+	}
+
+	tests := []struct {
+		service string
+		message string
+		id      int64
+		found   bool
+	}{
+		{"conveyor", "Belt stopped by operator bob", 1, true},
+		{"historian", "Archive rotated", 3, true},
+		{"conveyor", "Sensor offline", 0, false},
+	}
+	for _, tt := range tests {
+		template, _, _, found := d.Lookup(tt.service, tt.message)
+		if found != tt.found || template.ID != tt.id {
+			t.Errorf("Lookup(%q) = template %d, %v, want %d, %v", tt.message, template.ID, found, tt.id, tt.found)
+		}
+	}
+	if _, ok := d.root["conveyor/2"]; ok {
+		t.Error("tree nodes of the forgotten template were kept")
+	}
+	if d.ClearAnalysis(2, 0) {
+		t.Error("ClearAnalysis() found the forgotten template")
+	}
+
+	// A forgotten template's logs start a new one
+	if template, _, status := d.Match("conveyor", "Sensor offline"); template.ID != 4 || status != templateNew {
+		t.Errorf("Match() = template %d %s, want new template 4", template.ID, status)
+	}
+}
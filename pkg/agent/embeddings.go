@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// embedRecord returns the embedding of the record's message, computing it at most once
+func (s *Service) embedRecord(rec *record) ([]float32, error) {
+	if rec.embedding != nil {
+		return rec.embedding, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shared.EmbedTimeout)
+	defer cancel()
+	vector, err := s.config.Embedder.Embed(ctx, rec.log.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed log: %w", err)
+	}
+	rec.embedding = vector
+	return vector, nil
+}
+
+// storeEmbedding adds a stored log to the vector index
+func (s *Service) storeEmbedding(rec *record, logID int64) {
+	if s.config.Embedder == nil {
+		return
+	}
+
+	vector, err := s.embedRecord(rec)
+	if err != nil {
+		log.Printf("Error embedding log %d: %v", logID, err)
+		return
+	}
+	if err := db.PutLogEmbedding(logID, s.config.Embedder.Model(), vector); err != nil {
+		log.Printf("Error storing log embedding: %v", err)
+	}
+}
+
+// nearestAnalyzedLogs returns up to limit past logs closest to the record's embedding that carry
+// an analysis or resolution worth showing the model, skipping reused analyses as the full-text
+// search does
+func (s *Service) nearestAnalyzedLogs(rec *record, limit int) ([]db.LogEntry, error) {
+	vector, err := s.embedRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := db.NearestLogs(s.config.Embedder.Model(), vector, limit*shared.HistoryOversample)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []db.LogEntry
+	for _, m := range matches {
+		entry, err := db.GetLogEntry(m.LogID)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil || (entry.Summary == "" && entry.Resolution == "") || (entry.Cached && entry.Resolution == "") {
+			continue
+		}
+		entries = append(entries, *entry)
+		if len(entries) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
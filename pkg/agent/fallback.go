@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProviderConfig is one entry in the provider fallback chain
+type ProviderConfig struct {
+	Provider string        // LLM provider (ollama, openai, azure, etc.)
+	Model    string        // Model name for the provider
+	APIKey   string        // Optional: required for non-Ollama providers
+	Timeout  time.Duration // Per-attempt timeout; defaults to shared.AnalysisTimeout
+}
+
+// breakerState is the state of a provider circuit breaker
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops calling a provider after repeated failures and lets a single
+// probe through once the cooldown has passed
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+}
+
+// allow reports whether a call may go through, moving an expired open breaker to half-open
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// A probe is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// success closes the breaker
+func (b *circuitBreaker) success() (recovered bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	recovered = b.state != breakerClosed
+	b.state = breakerClosed
+	b.failures = 0
+	return recovered
+}
+
+// abort returns a half-open breaker to open without counting the call, so the next one probes again
+func (b *circuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+// failure records a failed call and reports whether it tripped the breaker, whether the
+// failed call was a half-open probe and how many consecutive calls have now failed
+func (b *circuitBreaker) failure() (tripped, probe bool, failures int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	probe = b.state == breakerHalfOpen
+	if probe || b.failures >= b.threshold {
+		tripped = b.state != breakerOpen
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+	return tripped, probe, b.failures
+}
+
+// chainEntry is an analyzer guarded by its own circuit breaker
+type chainEntry struct {
+	analyzer Analyzer
+	timeout  time.Duration
+	breaker  *circuitBreaker
+}
+
+// chainError is returned when no provider in a fallback chain produced an analysis
+type chainError struct {
+	failed []string // Providers called that failed, in chain order; those with an open circuit were skipped
+	errs   []string
+}
+
+func (e *chainError) Error() string {
+	return "all providers failed: " + strings.Join(e.errs, "; ")
+}
+
+// FallbackAnalyzer tries an ordered list of analyzers, failing over on error or timeout
+// and skipping providers whose circuit breaker is open
+type FallbackAnalyzer struct {
+	entries []*chainEntry
+}
+
+// NewFallbackAnalyzer creates a fallback chain over analyzers in priority order. Each
+// analyzer trips after threshold consecutive failures and is probed again after cooldown.
+func NewFallbackAnalyzer(analyzers []Analyzer, timeouts []time.Duration, threshold int, cooldown time.Duration) *FallbackAnalyzer {
+	f := &FallbackAnalyzer{}
+	for i, a := range analyzers {
+		f.entries = append(f.entries, &chainEntry{
+			analyzer: a,
+			timeout:  timeouts[i],
+			breaker:  &circuitBreaker{threshold: threshold, cooldown: cooldown},
+		})
+	}
+	return f
+}
+
+// Analyze implements Analyzer
+func (f *FallbackAnalyzer) Analyze(ctx context.Context, req AnalysisRequest) (*AnalysisResult, error) {
+	chainErr := &chainError{}
+	for _, e := range f.entries {
+		name := e.analyzer.Name()
+		if !e.breaker.allow() {
+			chainErr.errs = append(chainErr.errs, fmt.Sprintf("%s: circuit open", name))
+			continue
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, e.timeout)
+		result, err := e.analyzer.Analyze(attemptCtx, req)
+		cancel()
+
+		if err == nil {
+			if e.breaker.success() {
+				log.Printf("Provider %s recovered, closing circuit", name)
+			}
+			return result, nil
+		}
+
+		// The caller gave up, so the provider is not to blame
+		if ctx.Err() != nil {
+			e.breaker.abort()
+			return nil, ctx.Err()
+		}
+
+		if tripped, probe, failures := e.breaker.failure(); tripped && probe {
+			log.Printf("Provider %s probe failed, reopening circuit for %s", name, e.breaker.cooldown)
+		} else if tripped {
+			log.Printf("Provider %s failed %d times, opening circuit for %s", name, failures, e.breaker.cooldown)
+		}
+		log.Printf("Provider %s failed, trying next provider: %v", name, err)
+		chainErr.failed = append(chainErr.failed, name)
+		chainErr.errs = append(chainErr.errs, fmt.Sprintf("%s: %v", name, err))
+	}
+	return nil, chainErr
+}
+
+// Name implements Analyzer
+func (f *FallbackAnalyzer) Name() string {
+	names := make([]string, len(f.entries))
+	for i, e := range f.entries {
+		names[i] = e.analyzer.Name()
+	}
+	return strings.Join(names, ">")
+}
@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// FeedbackRequest is an operator's feedback on the analysis of a stored log, sent to the
+// feedback subject
+type FeedbackRequest struct {
+	LogID      int64  `json:"log_id"`
+	Rating     int    `json:"rating,omitempty"`     // 1 (wrong) to 5 (spot on), zero if not rated
+	Correction string `json:"correction,omitempty"` // What the analysis should have said
+	Resolution string `json:"resolution,omitempty"` // What actually fixed the problem
+	Author     string `json:"author,omitempty"`
+}
+
+// FeedbackQuery asks the feedback list subject for stored feedback
+type FeedbackQuery struct {
+	LogID int64 `json:"log_id,omitempty"` // Only feedback on this log, all logs if zero
+	Limit int   `json:"limit,omitempty"`
+}
+
+// FeedbackReply answers a feedback request or query
+type FeedbackReply struct {
+	ID        int64         `json:"id,omitempty"`        // Stored feedback, for requests
+	Withdrawn bool          `json:"withdrawn,omitempty"` // The rejected analysis is no longer reused
+	Feedback  []db.Feedback `json:"feedback,omitempty"`  // Stored feedback, for queries
+	Error     string        `json:"error,omitempty"`
+}
+
+// subscribeFeedback answers feedback requests and queries
+func (s *Service) subscribeFeedback() error {
+	if _, err := s.nc.Subscribe(shared.FeedbackSubjectName, s.handleFeedback); err != nil {
+		return fmt.Errorf("failed to subscribe to feedback: %w", err)
+	}
+	if _, err := s.nc.Subscribe(shared.FeedbackListSubjectName, s.handleFeedbackQuery); err != nil {
+		return fmt.Errorf("failed to subscribe to feedback queries: %w", err)
+	}
+	return nil
+}
+
+// handleFeedback stores an operator's feedback. A poor rating or a correction rejects the
+// analysis, so it is no longer reused for later logs.
+func (s *Service) handleFeedback(msg *nats.Msg) {
+	var req FeedbackRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		respondFeedback(msg, FeedbackReply{Error: fmt.Sprintf("invalid feedback: %v", err)})
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondFeedback(msg, FeedbackReply{Error: err.Error()})
+		return
+	}
+
+	id, err := db.AddFeedback(db.Feedback{
+		LogID:      req.LogID,
+		Rating:     req.Rating,
+		Correction: req.Correction,
+		Resolution: req.Resolution,
+		Author:     req.Author,
+	})
+	if err != nil {
+		log.Printf("Error storing feedback: %v", err)
+		respondFeedback(msg, FeedbackReply{Error: err.Error()})
+		return
+	}
+
+	reply := FeedbackReply{ID: id}
+	if (req.Rating > 0 && req.Rating <= shared.FeedbackPoorRating) || req.Correction != "" {
+		reply.Withdrawn = s.withdrawAnalysis(req.LogID)
+	}
+	log.Printf("Stored feedback %d on log %d (rating %d)", id, req.LogID, req.Rating)
+	respondFeedback(msg, reply)
+}
+
+// validate checks a feedback request before it is stored
+func (r FeedbackRequest) validate() error {
+	if r.LogID <= 0 {
+		return fmt.Errorf("log_id is required")
+	}
+	if r.Rating < 0 || r.Rating > 5 {
+		return fmt.Errorf("rating must be between 1 and 5")
+	}
+	if r.Rating == 0 && r.Correction == "" && r.Resolution == "" {
+		return fmt.Errorf("feedback needs a rating, correction or resolution")
+	}
+	return nil
+}
+
+// withdrawAnalysis stops a rejected analysis from being reused through the cache, the log's
+// template or its cluster, and reports whether it was in use anywhere. A log whose analysis
+// was itself reused withdraws whatever analysis its template and cluster currently reuse.
+func (s *Service) withdrawAnalysis(logID int64) bool {
+	entry, err := db.GetLogEntry(logID)
+	if err != nil || entry == nil {
+		log.Printf("Error reading log %d to withdraw its analysis: %v", logID, err)
+		return false
+	}
+
+	source := entry.ID
+	if entry.Cached {
+		source = 0
+	}
+
+	withdrawn := false
+	if entry.Fingerprint != "" {
+		deleted, err := db.DeleteCachedAnalysis(entry.Fingerprint)
+		if err != nil {
+			log.Printf("Error withdrawing cached analysis: %v", err)
+		}
+		withdrawn = deleted
+	}
+	if entry.TemplateID != 0 && s.drain.ClearAnalysis(entry.TemplateID, source) {
+		if err := db.SetTemplateAnalysis(entry.TemplateID, 0); err != nil {
+			log.Printf("Error withdrawing template analysis: %v", err)
+		}
+		withdrawn = true
+	}
+	if entry.ClusterID != 0 && s.clusters.ClearRepresentativeLog(entry.ClusterID, source) {
+		if err := db.SetClusterRepresentativeLog(entry.ClusterID, 0); err != nil {
+			log.Printf("Error withdrawing cluster analysis: %v", err)
+		}
+		withdrawn = true
+	}
+	return withdrawn
+}
+
+// handleFeedbackQuery answers a query for stored feedback
+func (s *Service) handleFeedbackQuery(msg *nats.Msg) {
+	var query FeedbackQuery
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &query); err != nil {
+			respondFeedback(msg, FeedbackReply{Error: fmt.Sprintf("invalid feedback query: %v", err)})
+			return
+		}
+	}
+	if query.Limit <= 0 {
+		query.Limit = shared.FeedbackLimit
+	}
+
+	feedback, err := db.GetFeedback(query.LogID, query.Limit)
+	if err != nil {
+		respondFeedback(msg, FeedbackReply{Error: err.Error()})
+		return
+	}
+	respondFeedback(msg, FeedbackReply{Feedback: feedback})
+}
+
+// respondFeedback answers a feedback request if the sender is waiting for a reply
+func respondFeedback(msg *nats.Msg, reply FeedbackReply) {
+	if msg.Reply == "" {
+		return
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		log.Printf("Error marshaling feedback reply: %v", err)
+		return
+	}
+	if err := msg.Respond(data); err != nil {
+		log.Printf("Error responding to feedback request: %v", err)
+	}
+}
+
+// SubmitFeedback sends feedback on a stored log's analysis to the agent
+func SubmitFeedback(nc *nats.Conn, req FeedbackRequest) (*FeedbackReply, error) {
+	return requestFeedback(nc, shared.FeedbackSubjectName, req)
+}
+
+// ListFeedback retrieves stored feedback from the agent, newest first
+func ListFeedback(nc *nats.Conn, query FeedbackQuery) ([]db.Feedback, error) {
+	reply, err := requestFeedback(nc, shared.FeedbackListSubjectName, query)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Feedback, nil
+}
+
+// requestFeedback sends a request to a feedback subject and decodes the reply
+func requestFeedback(nc *nats.Conn, subject string, req interface{}) (*FeedbackReply, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal feedback request: %w", err)
+	}
+	msg, err := nc.Request(subject, data, shared.FeedbackTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("feedback request failed: %w", err)
+	}
+
+	var reply FeedbackReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal feedback reply: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("%s", reply.Error)
+	}
+	return &reply, nil
+}
+
+// feedbackNote summarizes the operator feedback on a past log for a prompt, or returns "" if
+// there is none
+func feedbackNote(logID int64) string {
+	feedback, err := db.GetFeedback(logID, shared.FeedbackLimit)
+	if err != nil {
+		log.Printf("Error reading feedback on log %d: %v", logID, err)
+		return ""
+	}
+
+	var rating int
+	var correction string
+	for _, f := range feedback {
+		if rating == 0 {
+			rating = f.Rating
+		}
+		if correction == "" {
+			correction = f.Correction
+		}
+	}
+	switch {
+	case rating > 0 && correction != "":
+		return fmt.Sprintf("Operators rated this analysis %d/5 and corrected it: %s", rating, correction)
+	case correction != "":
+		return fmt.Sprintf("Operators corrected this analysis: %s", correction)
+	case rating > 0:
+		return fmt.Sprintf("Operators rated this analysis %d/5", rating)
+	}
+	return ""
+}
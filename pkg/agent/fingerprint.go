@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// maskToken replaces the variable parts of a log message
+const maskToken = "<*>"
+
+var (
+	uuidPattern   = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	ipPattern     = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	hexPattern    = regexp.MustCompile(`\b(?:0[xX][0-9a-fA-F]+|[0-9a-fA-F]{6,})\b`)
+	numberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+	spacePattern  = regexp.MustCompile(`\s+`)
+)
+
+// normalizeMessage masks the parts of a log message that change between otherwise
+// identical events: UUIDs, IP addresses, hex identifiers and numbers
+func normalizeMessage(message string) string {
+	message = uuidPattern.ReplaceAllString(message, maskToken)
+	message = ipPattern.ReplaceAllString(message, maskToken)
+	message = hexPattern.ReplaceAllStringFunc(message, func(s string) string {
+		// Plain words such as "deadbeef" or "facade" are left alone unless they carry a digit
+		if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") || strings.ContainsAny(s, "0123456789") {
+			return maskToken
+		}
+		return s
+	})
+	message = numberPattern.ReplaceAllString(message, maskToken)
+	return strings.TrimSpace(spacePattern.ReplaceAllString(message, " "))
+}
+
+// Fingerprint identifies logs that differ only in timestamps, counters and identifiers.
+// The hostname is only part of the fingerprint when includeHost is set.
+func Fingerprint(logMsg LogMessage, includeHost bool) string {
+	parts := []string{
+		strings.ToLower(logMsg.Service),
+		strings.ToUpper(logMsg.Severity),
+		normalizeMessage(logMsg.Message),
+	}
+	if includeHost {
+		parts = append(parts, strings.ToLower(logMsg.Hostname))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
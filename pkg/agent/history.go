@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/tobalo/gogent/pkg/cluster"
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// historyTerms returns the distinct search terms of a message, skipping the short words that
+// match nearly every log
+func historyTerms(message string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range cluster.Tokenize(message) {
+		if len(t) < 3 || seen[t] {
+			continue
+		}
+		seen[t] = true
+		terms = append(terms, t)
+		if len(terms) == shared.HistoryTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// similarLogs finds the past logs most similar to the record's, by embedding when an embedder
+// is configured and by full-text search otherwise or when embedding fails
+func (s *Service) similarLogs(rec *record) ([]db.LogEntry, error) {
+	if s.config.Embedder != nil {
+		entries, err := s.nearestAnalyzedLogs(rec, s.config.HistoryResults)
+		if err == nil {
+			return entries, nil
+		}
+		log.Printf("Error searching past logs by embedding, falling back to full-text search: %v", err)
+	}
+	return db.SearchLogEntries(historyTerms(rec.log.Message), s.config.HistoryResults)
+}
+
+// addHistory adds the most similar past logs, their analyses and any resolution an operator
+// recorded for them to the record's prompt, so the model can build on what was learned before
+func (s *Service) addHistory(rec *record) {
+	if s.config.HistoryResults <= 0 {
+		return
+	}
+
+	entries, err := s.similarLogs(rec)
+	if err != nil {
+		log.Printf("Error searching past logs: %v", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d. %s %s [%s] %s: %s", i+1, e.Timestamp, e.Hostname, e.Severity, e.Service, e.Message)
+		if e.Summary != "" {
+			fmt.Fprintf(&b, "\n   Analysis: %s", e.Summary)
+		}
+		if e.RootCause != "" {
+			fmt.Fprintf(&b, "\n   Root cause: %s", e.RootCause)
+		}
+		if note := feedbackNote(e.ID); note != "" {
+			fmt.Fprintf(&b, "\n   %s", note)
+		}
+		if e.Resolution != "" {
+			fmt.Fprintf(&b, "\n   Resolved by: %s", e.Resolution)
+		}
+		rec.history = append(rec.history, e.ID)
+	}
+	rec.sections = append(rec.sections, PromptSection{
+		Title: "Similar Past Logs",
+		Body:  "Refer to these when they share a cause with this log, e.g. by naming a fix that worked before.\n" + b.String(),
+	})
+}
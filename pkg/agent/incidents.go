@@ -0,0 +1,471 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// Incident lifecycle events published on the incident subject
+const (
+	incidentOpened     = "opened"
+	incidentUpdated    = "updated"
+	incidentSummarized = "summarized"
+	incidentClosed     = "closed"
+)
+
+// incidentSeverities are the severities that can open or join an incident
+var incidentSeverities = map[string]bool{
+	"WARN": true, "WARNING": true, "ERROR": true, "ERR": true,
+	"CRITICAL": true, "CRIT": true, "ALERT": true, "EMERGENCY": true, "EMERG": true, "FATAL": true,
+}
+
+// openIncident is the in-memory state of an open incident
+type openIncident struct {
+	id           int64
+	title        string
+	service      string
+	hostGroup    string
+	clusters     map[int64]bool
+	groups       map[string]bool // Keyed by groupKey
+	entries      int
+	lastActivity time.Time
+	summarizedAt int  // Entries when the last summary was requested
+	queued       bool // A summary is waiting for the summarizer
+	final        bool // The queued summary is the final one
+}
+
+// Match ranks of a log against an open incident, a shared cluster being the stronger evidence
+const (
+	matchNone = iota
+	matchGroup
+	matchCluster
+)
+
+// match ranks how a log from the cluster and service host group belongs to the incident
+func (inc *openIncident) match(clusterID int64, key string) int {
+	switch {
+	case clusterID != 0 && inc.clusters[clusterID]:
+		return matchCluster
+	case inc.groups[key]:
+		return matchGroup
+	}
+	return matchNone
+}
+
+// groupKey identifies the logs of a service on a host group, so that unrelated services sharing
+// hosts do not correlate
+func groupKey(service, group string) string {
+	return service + "@" + group
+}
+
+// pendingLog is a correlated log that has not opened an incident yet
+type pendingLog struct {
+	id      int64
+	at      time.Time
+	title   string
+	service string
+	cluster int64
+	group   string
+}
+
+// incidentTracker correlates stored logs into incidents
+type incidentTracker struct {
+	mu        sync.Mutex
+	open      map[int64]*openIncident
+	pending   map[string][]pendingLog // Keyed by shared cluster or service host group
+	hostGroup *regexp.Regexp
+	queue     []*openIncident // Incidents waiting for a summary, oldest request first
+	wake      chan struct{}   // Signals the summarizer that the queue is not empty
+}
+
+func newIncidentTracker(hostGroupPattern string) (*incidentTracker, error) {
+	re, err := regexp.Compile(hostGroupPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host group pattern: %w", err)
+	}
+	return &incidentTracker{
+		open:      make(map[int64]*openIncident),
+		pending:   make(map[string][]pendingLog),
+		hostGroup: re,
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+// group returns the host group of a hostname: the pattern's first submatch, or the hostname
+// itself when the pattern does not match
+func (t *incidentTracker) group(hostname string) string {
+	if m := t.hostGroup.FindStringSubmatch(hostname); len(m) > 1 && m[1] != "" {
+		return m[1]
+	}
+	return hostname
+}
+
+// loadIncidents restores the incidents left open by previous runs
+func (s *Service) loadIncidents() error {
+	incidents, err := db.GetIncidents(db.IncidentOpen, 1000)
+	if err != nil {
+		return err
+	}
+	for _, inc := range incidents {
+		entries, err := db.GetIncidentLogs(inc.ID, 1000)
+		if err != nil {
+			return err
+		}
+		state := &openIncident{
+			id:           inc.ID,
+			title:        inc.Title,
+			hostGroup:    inc.HostGroup,
+			clusters:     make(map[int64]bool),
+			groups:       make(map[string]bool),
+			entries:      inc.Entries,
+			lastActivity: inc.LastActivity,
+			summarizedAt: inc.Entries,
+		}
+		for _, e := range entries {
+			state.service = e.Service
+			state.groups[groupKey(e.Service, s.incidents.group(e.Hostname))] = true
+			if e.ClusterID != 0 {
+				state.clusters[e.ClusterID] = true
+			}
+		}
+		s.incidents.open[inc.ID] = state
+	}
+	if len(incidents) > 0 {
+		log.Printf("Restored %d open incidents", len(incidents))
+	}
+	return nil
+}
+
+// correlate attaches a stored log to the open incident sharing its cluster or, failing that, its
+// service and host group, or opens an incident once IncidentMinLogs such logs arrived within
+// IncidentWindow. When several incidents match, the most recently active one is chosen. It
+// returns the incident ID, or zero if the log is not part of an incident.
+func (s *Service) correlate(rec *record, logID int64) int64 {
+	if !incidentSeverities[strings.ToUpper(rec.log.Severity)] {
+		return 0
+	}
+
+	t := s.incidents
+	now := time.Now()
+	p := pendingLog{
+		id:      logID,
+		at:      now,
+		service: rec.log.Service,
+		cluster: rec.cluster.ID,
+		group:   t.group(rec.log.Hostname),
+	}
+	p.title = fmt.Sprintf("%s on %s: %s", p.service, p.group, truncate(rec.log.Message, 80))
+	if rec.structured != nil {
+		p.title = fmt.Sprintf("%s on %s: %s", p.service, p.group, truncate(rec.structured.Summary, 80))
+	}
+
+	key := groupKey(p.service, p.group)
+
+	t.mu.Lock()
+	if best := t.find(p.cluster, key); best != nil {
+		best.entries++
+		best.lastActivity = now
+		best.groups[key] = true
+		if p.cluster != 0 {
+			best.clusters[p.cluster] = true
+		}
+		t.mu.Unlock()
+		return s.attachToIncident(best, logID)
+	}
+	defer t.mu.Unlock()
+
+	keys := []string{"group:" + key}
+	if p.cluster != 0 {
+		keys = append(keys, fmt.Sprintf("cluster:%d", p.cluster))
+	}
+	for _, key := range keys {
+		t.pending[key] = append(t.prune(key, now, s.config.IncidentWindow), p)
+		if len(t.pending[key]) >= s.config.IncidentMinLogs {
+			return s.openIncident(t.pending[key], now)
+		}
+	}
+	return 0
+}
+
+// find returns the open incident a log from the cluster and service host group belongs to: one
+// sharing its cluster before one sharing its group, then the most recently active. The caller
+// must hold t.mu.
+func (t *incidentTracker) find(clusterID int64, key string) *openIncident {
+	var best *openIncident
+	bestRank := matchNone
+	for _, inc := range t.open {
+		rank := inc.match(clusterID, key)
+		if rank == matchNone || rank < bestRank {
+			continue
+		}
+		if best != nil && rank == bestRank && !inc.activeAfter(best) {
+			continue
+		}
+		best, bestRank = inc, rank
+	}
+	return best
+}
+
+// activeAfter reports whether the incident was active after other, the older incident winning
+// ties so that the choice does not depend on map order
+func (inc *openIncident) activeAfter(other *openIncident) bool {
+	if !inc.lastActivity.Equal(other.lastActivity) {
+		return inc.lastActivity.After(other.lastActivity)
+	}
+	return inc.id < other.id
+}
+
+// attachToIncident stores a log as part of an open incident, outside the tracker's lock, and
+// queues a rolling summary once the incident has doubled in size since the last one
+func (s *Service) attachToIncident(inc *openIncident, logID int64) int64 {
+	if err := db.AttachToIncident(inc.id, []int64{logID}); err != nil {
+		log.Printf("Error attaching log to incident %d: %v", inc.id, err)
+		return 0
+	}
+	s.publishIncident(incidentUpdated, inc.id)
+
+	t := s.incidents
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Summaries roll as the incident doubles in size, bounding the LLM calls per incident
+	if inc.entries >= 2*inc.summarizedAt {
+		s.summarizeIncident(inc, false)
+	}
+	return inc.id
+}
+
+// openIncident opens an incident from correlated pending logs. The caller must hold t.mu.
+func (s *Service) openIncident(logs []pendingLog, now time.Time) int64 {
+	t := s.incidents
+	first := logs[0]
+	inc := &openIncident{
+		title:        first.title,
+		service:      first.service,
+		hostGroup:    first.group,
+		clusters:     make(map[int64]bool),
+		groups:       make(map[string]bool),
+		entries:      len(logs),
+		lastActivity: now,
+	}
+	ids := make(map[int64]bool)
+	var logIDs []int64
+	for _, p := range logs {
+		ids[p.id] = true
+		logIDs = append(logIDs, p.id)
+		inc.groups[groupKey(p.service, p.group)] = true
+		if p.cluster != 0 {
+			inc.clusters[p.cluster] = true
+		}
+	}
+
+	id, err := db.CreateIncident(inc.title, inc.hostGroup, logIDs)
+	if err != nil {
+		log.Printf("Error opening incident: %v", err)
+		return 0
+	}
+	inc.id = id
+	t.open[id] = inc
+
+	// The logs now belong to the incident, so they must not open another one
+	for key, pending := range t.pending {
+		kept := pending[:0]
+		for _, p := range pending {
+			if !ids[p.id] {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.pending, key)
+		} else {
+			t.pending[key] = kept
+		}
+	}
+
+	log.Printf("Opened incident %d with %d logs: %s", id, len(logIDs), inc.title)
+	s.publishIncident(incidentOpened, id)
+	s.summarizeIncident(inc, false)
+	return id
+}
+
+// prune returns the pending logs of a key that are still within window. The caller must hold t.mu.
+func (t *incidentTracker) prune(key string, now time.Time, window time.Duration) []pendingLog {
+	pending := t.pending[key]
+	i := 0
+	for i < len(pending) && now.Sub(pending[i].at) > window {
+		i++
+	}
+	return pending[i:]
+}
+
+// summarizeIncident queues an incident for a rolling summary by the summarizer. An incident
+// already waiting is summarized once, finally if either request was final. The caller must hold
+// the tracker's lock.
+func (s *Service) summarizeIncident(inc *openIncident, final bool) {
+	t := s.incidents
+	inc.summarizedAt = inc.entries
+	inc.final = inc.final || final
+	if inc.queued {
+		return
+	}
+	inc.queued = true
+	t.queue = append(t.queue, inc)
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// summarizeIncidents writes the queued incident summaries one at a time, so they add at most
+// one LLM call to those of the workers, until ctx is cancelled
+func (s *Service) summarizeIncidents(ctx context.Context) {
+	defer s.wg.Done()
+	t := s.incidents
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.wake:
+		}
+
+		for ctx.Err() == nil {
+			t.mu.Lock()
+			if len(t.queue) == 0 {
+				t.mu.Unlock()
+				break
+			}
+			inc := t.queue[0]
+			t.queue = t.queue[1:]
+			inc.queued = false
+			id, service, final := inc.id, inc.service, inc.final
+			inc.final = false
+			t.mu.Unlock()
+
+			s.writeIncidentSummary(ctx, id, service, final)
+		}
+	}
+}
+
+// writeIncidentSummary asks the LLM for an incident's summary and stores and announces it
+func (s *Service) writeIncidentSummary(ctx context.Context, id int64, service string, final bool) {
+	incident, err := db.GetIncident(id)
+	if err != nil || incident == nil {
+		log.Printf("Error reading incident %d: %v", id, err)
+		return
+	}
+	entries, err := db.GetIncidentLogs(id, shared.IncidentPromptEntries)
+	if err != nil {
+		log.Printf("Error reading incident %d logs: %v", id, err)
+		return
+	}
+
+	prompt := s.prompts.IncidentPrompt(service, IncidentPromptData{
+		Title:     incident.Title,
+		HostGroup: incident.HostGroup,
+		OpenedAt:  incident.OpenedAt.Format(time.RFC3339),
+		Count:     incident.Entries,
+		Summary:   incident.Summary,
+		Entries:   entries,
+	})
+	if final {
+		prompt += "\n\nThe incident has just closed after a quiet period; write the final summary."
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, shared.IncidentSummaryTimeout)
+	defer cancel()
+	result, err := s.analyze(ctx, s.config.Instructions, prompt)
+	if err != nil {
+		log.Printf("Error summarizing incident %d: %v", id, err)
+		return
+	}
+	summary := strings.TrimSpace(thinkBlock.ReplaceAllString(result.Content, ""))
+	if err := db.UpdateIncidentSummary(id, summary); err != nil {
+		log.Printf("Error storing incident %d summary: %v", id, err)
+		return
+	}
+	s.publishIncident(incidentSummarized, id)
+}
+
+// watchIncidents closes incidents that have been quiet for IncidentQuiet, until ctx is cancelled
+func (s *Service) watchIncidents(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(shared.IncidentCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.closeQuietIncidents(now)
+		}
+	}
+}
+
+// closeQuietIncidents closes the incidents without activity for IncidentQuiet and forgets pending
+// logs older than IncidentWindow
+func (s *Service) closeQuietIncidents(now time.Time) {
+	t := s.incidents
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.pending {
+		if kept := t.prune(key, now, s.config.IncidentWindow); len(kept) > 0 {
+			t.pending[key] = kept
+		} else {
+			delete(t.pending, key)
+		}
+	}
+
+	for id, inc := range t.open {
+		if now.Sub(inc.lastActivity) < s.config.IncidentQuiet {
+			continue
+		}
+		if err := db.CloseIncident(id); err != nil {
+			log.Printf("Error closing incident %d: %v", id, err)
+			continue
+		}
+		delete(t.open, id)
+		log.Printf("Closed incident %d after %s without activity", id, s.config.IncidentQuiet)
+		s.publishIncident(incidentClosed, id)
+		s.summarizeIncident(inc, true)
+	}
+}
+
+// publishIncident announces an incident lifecycle event on the incident subject
+func (s *Service) publishIncident(event string, id int64) {
+	incident, err := db.GetIncident(id)
+	if err != nil || incident == nil {
+		log.Printf("Error reading incident %d: %v", id, err)
+		return
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"event":         event,
+		"id":            incident.ID,
+		"title":         incident.Title,
+		"status":        incident.Status,
+		"host_group":    incident.HostGroup,
+		"summary":       incident.Summary,
+		"entries":       incident.Entries,
+		"max_risk":      incident.MaxRisk,
+		"opened_at":     incident.OpenedAt,
+		"last_activity": incident.LastActivity,
+		"closed_at":     incident.ClosedAt,
+	})
+	if err != nil {
+		log.Printf("Error marshaling incident: %v", err)
+		return
+	}
+	if err := s.nc.Publish(shared.IncidentSubjectName, data); err != nil {
+		log.Printf("Error publishing incident: %v", err)
+	}
+}
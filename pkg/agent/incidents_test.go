@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIncidentTrackerFind(t *testing.T) {
+	now := time.Now()
+	incident := func(id int64, cluster int64, key string, idle time.Duration) *openIncident {
+		return &openIncident{
+			id:           id,
+			clusters:     map[int64]bool{cluster: true},
+			groups:       map[string]bool{key: true},
+			lastActivity: now.Add(-idle),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		open    []*openIncident
+		cluster int64
+		key     string
+		want    int64
+	}{
+		{
+			name:    "no match",
+			open:    []*openIncident{incident(1, 5, "historian@plant-a", 0)},
+			cluster: 6,
+			key:     "historian@plant-b",
+			want:    0,
+		},
+		{
+			name: "cluster before group",
+			open: []*openIncident{
+				incident(1, 5, "historian@plant-a", 0),
+				incident(2, 6, "historian@plant-b", time.Hour),
+			},
+			cluster: 6,
+			key:     "historian@plant-a",
+			want:    2,
+		},
+		{
+			name: "most recently active",
+			open: []*openIncident{
+				incident(1, 5, "historian@plant-a", time.Hour),
+				incident(2, 6, "historian@plant-a", time.Minute),
+				incident(3, 7, "historian@plant-a", 2*time.Hour),
+			},
+			cluster: 8,
+			key:     "historian@plant-a",
+			want:    2,
+		},
+		{
+			name: "oldest incident breaks ties",
+			open: []*openIncident{
+				incident(4, 5, "historian@plant-a", time.Minute),
+				incident(3, 6, "historian@plant-a", time.Minute),
+				incident(9, 7, "historian@plant-a", time.Minute),
+			},
+			cluster: 8,
+			key:     "historian@plant-a",
+			want:    3,
+		},
+		{
+			name:    "services sharing a host group do not match",
+			open:    []*openIncident{incident(1, 5, "historian@plant-a", 0)},
+			cluster: 6,
+			key:     "conveyor@plant-a",
+			want:    0,
+		},
+		{
+			name:    "no cluster",
+			open:    []*openIncident{incident(1, 0, "historian@plant-a", 0)},
+			cluster: 0,
+			key:     "historian@plant-b",
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Map order varies between runs, so repeat to catch a choice depending on it
+			for i := 0; i < 20; i++ {
+				tracker := &incidentTracker{open: make(map[int64]*openIncident)}
+				for _, inc := range tt.open {
+					tracker.open[inc.id] = inc
+				}
+				var got int64
+				if inc := tracker.find(tt.cluster, tt.key); inc != nil {
+					got = inc.id
+				}
+				if got != tt.want {
+					t.Fatalf("find(%d, %q) = %d, want %d", tt.cluster, tt.key, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// mockBatchEntry matches the per-entry headings of a batch prompt
+var mockBatchEntry = regexp.MustCompile(`(?m)^Entry \d+:$`)
+
+// MockStep is one scripted reply from the mock analyzer
+type MockStep struct {
+	Response string        // Content returned when Err is nil
+	Err      error         // Error returned instead of a response
+	Latency  time.Duration // Delay before replying; honours context cancellation
+}
+
+// MockAnalyzer is a deterministic in-process Analyzer for tests and offline runs.
+// It replays its script in order, wrapping around at the end; with no script it
+// answers every prompt with a stable digest of the prompt.
+type MockAnalyzer struct {
+	mu       sync.Mutex
+	steps    []MockStep
+	next     int
+	requests []AnalysisRequest
+}
+
+// NewMockAnalyzer creates a mock analyzer that replays the given steps
+func NewMockAnalyzer(steps ...MockStep) *MockAnalyzer {
+	return &MockAnalyzer{steps: steps}
+}
+
+// mockScriptStep is the JSON form of a MockStep
+type mockScriptStep struct {
+	Response string `json:"response"`
+	Error    string `json:"error"`
+	Latency  string `json:"latency"`
+}
+
+// LoadMockScript reads mock steps from a JSON file such as
+// [{"response": "disk full"}, {"error": "provider unavailable", "latency": "2s"}]
+func LoadMockScript(path string) ([]MockStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock script: %w", err)
+	}
+
+	var script []mockScriptStep
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("failed to parse mock script: %w", err)
+	}
+
+	steps := make([]MockStep, 0, len(script))
+	for i, s := range script {
+		step := MockStep{Response: s.Response}
+		if s.Error != "" {
+			step.Err = errors.New(s.Error)
+		}
+		if s.Latency != "" {
+			if step.Latency, err = time.ParseDuration(s.Latency); err != nil {
+				return nil, fmt.Errorf("invalid latency in mock script step %d: %w", i, err)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Analyze implements Analyzer
+func (m *MockAnalyzer) Analyze(ctx context.Context, req AnalysisRequest) (*AnalysisResult, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, req)
+	step := MockStep{Response: mockDigest(req.Prompt)}
+	if len(m.steps) > 0 {
+		step = m.steps[m.next%len(m.steps)]
+		m.next++
+	}
+	m.mu.Unlock()
+
+	if step.Latency > 0 {
+		select {
+		case <-time.After(step.Latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if step.Err != nil {
+		return nil, step.Err
+	}
+
+	return &AnalysisResult{
+		Content:  step.Response,
+		Provider: shared.ProviderMock,
+		Model:    "mock",
+	}, nil
+}
+
+// Name implements Analyzer
+func (m *MockAnalyzer) Name() string {
+	return shared.ProviderMock
+}
+
+// Requests returns every request the mock has received, in order
+func (m *MockAnalyzer) Requests() []AnalysisRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]AnalysisRequest(nil), m.requests...)
+}
+
+// mockDigest produces a stable placeholder analysis for a prompt. It answers in the JSON
+// shape the agent requests, with one entry per "Entry N:" line for batch prompts.
+func mockDigest(prompt string) string {
+	h := fnv.New32a()
+	h.Write([]byte(prompt))
+	analysis := StructuredAnalysis{
+		Summary:            fmt.Sprintf("Mock analysis %08x of a %d byte prompt", h.Sum32(), len(prompt)),
+		RootCause:          "Mock root cause",
+		Category:           "other",
+		RiskScore:          int(h.Sum32() % 101),
+		RecommendedActions: []string{"No action, this is a mock analysis"},
+		Confidence:         0.5,
+	}
+
+	var data []byte
+	if entries := mockBatchEntry.FindAllString(prompt, -1); len(entries) > 0 {
+		batch := map[string]interface{}{"batch_summary": "Mock batch summary"}
+		var items []map[string]interface{}
+		for i := range entries {
+			items = append(items, map[string]interface{}{
+				"entry":               i + 1,
+				"summary":             analysis.Summary,
+				"root_cause":          analysis.RootCause,
+				"category":            analysis.Category,
+				"risk_score":          analysis.RiskScore,
+				"recommended_actions": analysis.RecommendedActions,
+				"confidence":          analysis.Confidence,
+			})
+		}
+		batch["entries"] = items
+		data, _ = json.Marshal(batch)
+	} else {
+		data, _ = json.Marshal(analysis)
+	}
+	return string(data)
+}
@@ -0,0 +1,391 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/db"
+)
+
+// Template kinds
+const (
+	promptKind       = "prompt"       // User prompt for a single log
+	batchKind        = "batch"        // User prompt for a batch of related logs
+	instructionsKind = "instructions" // System instructions for the model
+	incidentKind     = "incident"     // Prompt for an incident's rolling summary
+	reportKind       = "report"       // Prompt for a shift report's executive summary
+)
+
+// PromptSection is extra context attached to a prompt by the analysis pipeline
+type PromptSection struct {
+	Title string
+	Body  string
+}
+
+// PromptData is the data available to single-log prompt and instruction templates
+type PromptData struct {
+	LogMessage
+	Sections []PromptSection
+}
+
+// BatchPromptData is the data available to batch prompt templates
+type BatchPromptData struct {
+	Hostname string
+	Service  string
+	Entries  []LogMessage
+	Sections []PromptSection
+}
+
+// IncidentPromptData is the data available to incident summary templates
+type IncidentPromptData struct {
+	Title     string
+	HostGroup string
+	OpenedAt  string
+	Count     int           // Log entries attached to the incident
+	Summary   string        // Previous summary, empty for the first one
+	Entries   []db.LogEntry // Most recent entries, newest first
+}
+
+// ReportPromptData is the data available to shift report templates
+type ReportPromptData struct {
+	Shift     string
+	Start     string
+	End       string
+	Total     int
+	Groups    []db.LogCount // Log counts per service and severity, busiest first
+	Incidents []db.Incident // Incidents open during the shift, most severe first
+	TopLogs   []db.LogEntry // Highest-risk analyzed logs of the shift
+}
+
+// builtinTemplates are used when no file or KV template overrides them
+var builtinTemplates = map[string]string{
+	"default." + promptKind: `Analyze this technical log entry and provide insights:
+Timestamp: {{.Timestamp}}
+Host: {{.Hostname}}
+Severity: {{.Severity}}
+Service: {{.Service}}
+Message: {{.Message}}
+Additional Context: {{.Context}}
+{{- range .Sections}}
+
+{{.Title}}:
+{{.Body}}
+{{- end}}`,
+
+	"default." + batchKind: `Analyze these {{len .Entries}} related technical log entries from {{.Service}} on {{.Hostname}}.
+Describe what the entries have in common and the likely shared cause, then give insights for every entry.
+{{range $i, $e := .Entries}}
+Entry {{inc $i}}:
+Timestamp: {{$e.Timestamp}}
+Severity: {{$e.Severity}}
+Message: {{$e.Message}}
+Additional Context: {{$e.Context}}
+{{end}}
+{{- range .Sections}}
+{{.Title}}:
+{{.Body}}
+{{end}}`,
+
+	"default." + incidentKind: `Summarize the ongoing incident "{{.Title}}" for the operators on shift.
+It was opened at {{.OpenedAt}} and has {{.Count}} related log entries{{if .HostGroup}} from host group {{.HostGroup}}{{end}}. The most recent are:
+{{range .Entries}}
+- {{.Timestamp}} {{.Hostname}} [{{.Severity}}] {{.Service}}: {{.Message}}{{if .Summary}} (analysis: {{.Summary}}){{end}}
+{{- end}}
+{{if .Summary}}
+Previous summary:
+{{.Summary}}
+{{end}}
+In one short paragraph of plain text, describe what is happening, the most likely common cause, how the incident has developed and what the operators should do next.`,
+
+	"default." + reportKind: `Write the executive summary of the {{.Shift}} shift handover report for the plant supervisors.
+The shift ran from {{.Start}} to {{.End}} and {{.Total}} log entries were analyzed.
+
+Log entries by service and severity:
+{{range .Groups}}
+- {{.Service}} [{{.Severity}}]: {{.Count}} entries from {{.Hosts}} hosts, highest risk {{.MaxRisk}}
+{{- else}}
+- none
+{{- end}}
+
+Incidents during the shift:
+{{range .Incidents}}
+- #{{.ID}} {{.Title}} ({{.Status}}, {{.Entries}} entries, highest risk {{.MaxRisk}}){{if .Summary}}: {{.Summary}}{{end}}
+{{- else}}
+- none
+{{- end}}
+
+Highest-risk entries:
+{{range .TopLogs}}
+- {{.Timestamp}} {{.Hostname}} [{{.Severity}}] {{.Service}}: {{.Message}} (risk {{.RiskScore}}{{if .Summary}}, {{.Summary}}{{end}})
+{{- else}}
+- none
+{{- end}}
+
+In two or three short paragraphs of plain text, say how the shift went, what needs the incoming shift's attention first and which problems are still open.`,
+}
+
+// templateFuncs are available to every prompt template
+var templateFuncs = template.FuncMap{
+	"inc":   func(i int) int { return i + 1 },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// PromptLibrary holds the prompt and instruction templates. Templates are keyed
+// "<scope>.<kind>" where scope is "default", "service.<name>" or "severity.<LEVEL>",
+// and are looked up most specific first: service, then severity, then default.
+// Templates stored in the NATS KV bucket take precedence over files, which take
+// precedence over the built-in defaults.
+type PromptLibrary struct {
+	mu      sync.RWMutex
+	builtin map[string]*template.Template
+	files   map[string]*template.Template
+	kv      map[string]*template.Template
+}
+
+// NewPromptLibrary creates a library holding only the built-in templates
+func NewPromptLibrary() *PromptLibrary {
+	lib := &PromptLibrary{
+		builtin: make(map[string]*template.Template),
+		files:   make(map[string]*template.Template),
+		kv:      make(map[string]*template.Template),
+	}
+	for key, text := range builtinTemplates {
+		lib.builtin[key] = template.Must(parseTemplate(key, text))
+	}
+	return lib
+}
+
+func parseTemplate(key, text string) (*template.Template, error) {
+	return template.New(key).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// lookup finds the most specific template of a kind for a log
+func (l *PromptLibrary) lookup(kind, service, severity string) *template.Template {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	keys := []string{
+		"service." + service + "." + kind,
+		"severity." + strings.ToUpper(severity) + "." + kind,
+		"default." + kind,
+	}
+	for _, key := range keys {
+		for _, layer := range []map[string]*template.Template{l.kv, l.files, l.builtin} {
+			if t, ok := layer[key]; ok {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// render executes the most specific template of a kind, falling back to the built-in
+// default when an override fails so a broken edit never stops analysis
+func (l *PromptLibrary) render(kind, service, severity string, data interface{}) (string, bool) {
+	t := l.lookup(kind, service, severity)
+	if t == nil {
+		return "", false
+	}
+
+	var b strings.Builder
+	err := t.Execute(&b, data)
+	if err == nil {
+		return b.String(), true
+	}
+	log.Printf("Error rendering prompt template %s: %v", t.Name(), err)
+
+	builtin, ok := l.builtin["default."+kind]
+	if !ok || builtin == t {
+		return "", false
+	}
+	b.Reset()
+	if err := builtin.Execute(&b, data); err != nil {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// Prompt renders the user prompt for a single log
+func (l *PromptLibrary) Prompt(data PromptData) string {
+	prompt, _ := l.render(promptKind, data.Service, data.Severity, data)
+	return prompt
+}
+
+// BatchPrompt renders the user prompt for a batch of related logs
+func (l *PromptLibrary) BatchPrompt(data BatchPromptData) string {
+	severity := ""
+	if len(data.Entries) > 0 {
+		severity = data.Entries[0].Severity
+	}
+	prompt, _ := l.render(batchKind, data.Service, severity, data)
+	return prompt
+}
+
+// Instructions renders the system instructions for a log, or returns fallback when no
+// instructions template applies
+func (l *PromptLibrary) Instructions(logMsg LogMessage, fallback string) string {
+	if instructions, ok := l.render(instructionsKind, logMsg.Service, logMsg.Severity, PromptData{LogMessage: logMsg}); ok {
+		return instructions
+	}
+	return fallback
+}
+
+// IncidentPrompt renders the prompt for an incident's rolling summary
+func (l *PromptLibrary) IncidentPrompt(service string, data IncidentPromptData) string {
+	prompt, _ := l.render(incidentKind, service, "", data)
+	return prompt
+}
+
+// ReportPrompt renders the prompt for a shift report's executive summary
+func (l *PromptLibrary) ReportPrompt(data ReportPromptData) string {
+	prompt, _ := l.render(reportKind, "", "", data)
+	return prompt
+}
+
+// templateKey turns a template file path relative to the prompt directory into its key,
+// e.g. "service/nginx.prompt.tmpl" becomes "service.nginx.prompt"
+func templateKey(rel string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(filepath.ToSlash(rel), ".tmpl"), "/", ".")
+}
+
+// LoadDir replaces the file templates with the *.tmpl files under dir. If any file fails
+// to parse the previous file templates are kept.
+func (l *PromptLibrary) LoadDir(dir string) error {
+	templates := make(map[string]*template.Template)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key := templateKey(rel)
+		t, err := parseTemplate(key, string(text))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		templates[key] = t
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.files = templates
+	l.mu.Unlock()
+	return nil
+}
+
+// dirFingerprint summarizes the names, sizes and modification times of the templates under dir
+func dirFingerprint(dir string) string {
+	var parts []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()))
+		}
+		return nil
+	})
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
+
+// WatchDir reloads the templates under dir whenever a file is added, changed or removed,
+// polling every interval until ctx is cancelled. Call LoadDir first for the initial load.
+func (l *PromptLibrary) WatchDir(ctx context.Context, dir string, interval time.Duration) {
+	last := dirFingerprint(dir)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := dirFingerprint(dir)
+			if current == last {
+				continue
+			}
+			last = current
+			if err := l.LoadDir(dir); err != nil {
+				log.Printf("Error reloading prompt templates from %s, keeping previous: %v", dir, err)
+				continue
+			}
+			log.Printf("Reloaded prompt templates from %s", dir)
+		}
+	}
+}
+
+// WatchKV keeps the KV templates in sync with a NATS key-value bucket whose keys follow
+// the template key format, e.g. "service.nginx.prompt"
+func (l *PromptLibrary) WatchKV(ctx context.Context, kv nats.KeyValue) error {
+	watcher, err := kv.WatchAll(nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to watch prompt bucket: %w", err)
+	}
+
+	go func() {
+		defer watcher.Stop()
+		for entry := range watcher.Updates() {
+			// A nil entry marks the end of the initial values
+			if entry == nil {
+				continue
+			}
+			key := entry.Key()
+			switch entry.Operation() {
+			case nats.KeyValueDelete, nats.KeyValuePurge:
+				l.mu.Lock()
+				delete(l.kv, key)
+				l.mu.Unlock()
+				log.Printf("Removed prompt template %s from bucket %s", key, kv.Bucket())
+			default:
+				t, err := parseTemplate(key, string(entry.Value()))
+				if err != nil {
+					log.Printf("Error parsing prompt template %s from bucket %s, keeping previous: %v", key, kv.Bucket(), err)
+					continue
+				}
+				l.mu.Lock()
+				l.kv[key] = t
+				l.mu.Unlock()
+				log.Printf("Loaded prompt template %s from bucket %s", key, kv.Bucket())
+			}
+		}
+	}()
+	return nil
+}
+
+// promptBucket returns the KV bucket holding prompt templates, creating it if needed
+func promptBucket(js nats.JetStreamContext, bucket string) (nats.KeyValue, error) {
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Gogent prompt and instruction templates",
+			History:     5,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open prompt bucket %s: %w", bucket, err)
+	}
+	return kv, nil
+}
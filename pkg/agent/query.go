@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// LogQuery asks the log query subject for stored log entries. Empty fields match everything.
+type LogQuery struct {
+	From       string `json:"from,omitempty"` // RFC 3339, entries stored at or after
+	To         string `json:"to,omitempty"`   // RFC 3339, entries stored before
+	Hostname   string `json:"hostname,omitempty"`
+	Service    string `json:"service,omitempty"`
+	Severity   string `json:"severity,omitempty"`
+	Text       string `json:"text,omitempty"` // Words that must all appear in the message, summary, root cause or resolution
+	IncidentID int64  `json:"incident_id,omitempty"`
+	Order      string `json:"order,omitempty"`  // "desc" (newest first, the default) or "asc"
+	Cursor     string `json:"cursor,omitempty"` // NextCursor of the previous page
+	Limit      int    `json:"limit,omitempty"`
+}
+
+// LogQueryReply is one page of stored log entries
+type LogQueryReply struct {
+	Entries    []db.LogEntry `json:"entries"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// startQueryService registers the log query endpoint as a NATS micro service, so it shows up
+// in `nats micro list` with its request statistics
+func (s *Service) startQueryService() error {
+	svc, err := micro.AddService(s.nc, micro.Config{
+		Name:        shared.QueryServiceName,
+		Version:     shared.QueryServiceVersion,
+		Description: "Stored logs and their analyses",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add query service: %w", err)
+	}
+	if err := svc.AddEndpoint("query", micro.HandlerFunc(handleLogQuery),
+		micro.WithEndpointSubject(shared.LogQuerySubjectName)); err != nil {
+		svc.Stop()
+		return fmt.Errorf("failed to add log query endpoint: %w", err)
+	}
+	s.queries = svc
+	return nil
+}
+
+// handleLogQuery answers a query for stored log entries
+func handleLogQuery(req micro.Request) {
+	var query LogQuery
+	if len(req.Data()) > 0 {
+		if err := json.Unmarshal(req.Data(), &query); err != nil {
+			req.Error("400", fmt.Sprintf("invalid log query: %v", err), nil)
+			return
+		}
+	}
+	filter, err := query.Filter()
+	if err != nil {
+		req.Error("400", err.Error(), nil)
+		return
+	}
+
+	entries, next, err := db.QueryLogEntries(filter)
+	if err != nil {
+		log.Printf("Error querying logs: %v", err)
+		req.Error("500", err.Error(), nil)
+		return
+	}
+
+	reply := LogQueryReply{Entries: entries}
+	if reply.Entries == nil {
+		reply.Entries = []db.LogEntry{}
+	}
+	if next != 0 {
+		reply.NextCursor = strconv.FormatInt(next, 10)
+	}
+	if err := req.RespondJSON(reply); err != nil {
+		log.Printf("Error responding to log query: %v", err)
+	}
+}
+
+// Filter validates a query and converts it to a database filter
+func (q LogQuery) Filter() (db.LogFilter, error) {
+	f := db.LogFilter{
+		Hostname:   q.Hostname,
+		Service:    q.Service,
+		Severity:   q.Severity,
+		Text:       q.Text,
+		IncidentID: q.IncidentID,
+		Limit:      q.Limit,
+	}
+
+	var err error
+	if q.From != "" {
+		if f.From, err = time.Parse(time.RFC3339, q.From); err != nil {
+			return f, fmt.Errorf("invalid from %q, want RFC 3339", q.From)
+		}
+	}
+	if q.To != "" {
+		if f.To, err = time.Parse(time.RFC3339, q.To); err != nil {
+			return f, fmt.Errorf("invalid to %q, want RFC 3339", q.To)
+		}
+	}
+
+	switch strings.ToLower(q.Order) {
+	case "", "desc":
+	case "asc":
+		f.Ascending = true
+	default:
+		return f, fmt.Errorf("invalid order %q, want asc or desc", q.Order)
+	}
+
+	if q.Cursor != "" {
+		if f.After, err = strconv.ParseInt(q.Cursor, 10, 64); err != nil || f.After <= 0 {
+			return f, fmt.Errorf("invalid cursor %q", q.Cursor)
+		}
+	}
+
+	switch {
+	case f.Limit < 0:
+		return f, fmt.Errorf("limit must not be negative")
+	case f.Limit == 0:
+		f.Limit = shared.QueryLimit
+	case f.Limit > shared.QueryMaxLimit:
+		f.Limit = shared.QueryMaxLimit
+	}
+	return f, nil
+}
+
+// EntryReply shapes a stored log entry like the reply to its analysis. Details that are not
+// stored, such as the template text or the similar logs, are left empty.
+func EntryReply(e db.LogEntry) AnalysisReply {
+	reply := AnalysisReply{
+		LogID: e.ID,
+		OriginalMessage: LogMessage{
+			Timestamp: e.Timestamp,
+			Hostname:  e.Hostname,
+			Severity:  e.Severity,
+			Service:   e.Service,
+			Message:   e.Message,
+		},
+		Format:      e.Format,
+		RawPayload:  e.RawPayload,
+		Analysis:    e.Analysis,
+		Provider:    e.Provider,
+		Fingerprint: e.Fingerprint,
+		Cached:      e.Cached,
+		TemplateID:  e.TemplateID,
+		ClusterID:   e.ClusterID,
+		IncidentID:  e.IncidentID,
+	}
+	if e.Context != "" {
+		if err := json.Unmarshal([]byte(e.Context), &reply.OriginalMessage.Context); err != nil {
+			log.Printf("Error decoding context of log %d: %v", e.ID, err)
+		}
+	}
+	if e.Summary != "" {
+		reply.Structured = &StructuredAnalysis{
+			Summary:    e.Summary,
+			RootCause:  e.RootCause,
+			Category:   e.Category,
+			RiskScore:  e.RiskScore,
+			Confidence: e.Confidence,
+		}
+		if e.RecommendedActions != "" {
+			if err := json.Unmarshal([]byte(e.RecommendedActions), &reply.Structured.RecommendedActions); err != nil {
+				log.Printf("Error decoding recommended actions of log %d: %v", e.ID, err)
+			}
+		}
+	}
+	return reply
+}
+
+// QueryLogs retrieves a page of stored log entries from the agent
+func QueryLogs(nc *nats.Conn, query LogQuery) (*LogQueryReply, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log query: %w", err)
+	}
+	msg, err := nc.Request(shared.LogQuerySubjectName, data, shared.QueryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("log query failed: %w", err)
+	}
+	if desc := msg.Header.Get(micro.ErrorHeader); desc != "" {
+		return nil, fmt.Errorf("%s", desc)
+	}
+
+	var reply LogQueryReply
+	if err := json.Unmarshal(msg.Data, &reply); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal log query reply: %w", err)
+	}
+	return &reply, nil
+}
@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// ShiftReport is the handover summary of one shift
+type ShiftReport struct {
+	Shift       string        `json:"shift"`
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Total       int           `json:"total"`
+	Reused      int           `json:"reused"`    // Entries whose analysis was reused instead of requested
+	Groups      []db.LogCount `json:"groups"`    // Per service and severity, busiest first
+	Incidents   []db.Incident `json:"incidents"` // Open during the shift, most severe first
+	TopLogs     []ReportLog   `json:"top_logs"`  // Highest-risk analyzed entries
+	Summary     string        `json:"summary"`   // LLM executive summary, empty if it failed
+	Provider    string        `json:"provider,omitempty"`
+}
+
+// ReportLog is a log entry listed in a shift report
+type ReportLog struct {
+	ID         int64  `json:"id"`
+	Timestamp  string `json:"timestamp"`
+	Hostname   string `json:"hostname"`
+	Service    string `json:"service"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Summary    string `json:"summary"`
+	RootCause  string `json:"root_cause"`
+	RiskScore  int    `json:"risk_score"`
+	IncidentID int64  `json:"incident_id,omitempty"`
+}
+
+// ShiftReport builds the report of the logs stored in [start, end) and asks the LLM for its
+// executive summary. A failed summary is logged and leaves the rest of the report intact, so
+// a handover is never lost to an unavailable provider.
+func (s *Service) ShiftReport(ctx context.Context, shift string, start, end time.Time) (*ShiftReport, error) {
+	groups, err := db.GetLogCounts(start, end)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := db.GetIncidentsBetween(start, end)
+	if err != nil {
+		return nil, err
+	}
+	topLogs, err := db.GetTopRiskLogs(start, end, shared.ReportTopLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ShiftReport{
+		Shift:     shift,
+		Start:     start,
+		End:       end,
+		Groups:    groups,
+		Incidents: incidents,
+	}
+	for _, g := range groups {
+		report.Total += g.Count
+		report.Reused += g.Reused
+	}
+	for _, e := range topLogs {
+		report.TopLogs = append(report.TopLogs, ReportLog{
+			ID:         e.ID,
+			Timestamp:  e.Timestamp,
+			Hostname:   e.Hostname,
+			Service:    e.Service,
+			Severity:   e.Severity,
+			Message:    e.Message,
+			Summary:    e.Summary,
+			RootCause:  e.RootCause,
+			RiskScore:  e.RiskScore,
+			IncidentID: e.IncidentID,
+		})
+	}
+
+	prompt := s.prompts.ReportPrompt(ReportPromptData{
+		Shift:     shift,
+		Start:     start.Format(time.RFC3339),
+		End:       end.Format(time.RFC3339),
+		Total:     report.Total,
+		Groups:    groups,
+		Incidents: incidents,
+		TopLogs:   topLogs,
+	})
+	ctx, cancel := context.WithTimeout(ctx, shared.ReportSummaryTimeout)
+	defer cancel()
+	if result, err := s.analyze(ctx, s.config.Instructions, prompt); err != nil {
+		log.Printf("Error summarizing %s shift report: %v", shift, err)
+	} else {
+		report.Summary = strings.TrimSpace(thinkBlock.ReplaceAllString(result.Content, ""))
+		report.Provider = result.Provider
+	}
+
+	report.GeneratedAt = time.Now()
+	return report, nil
+}
+
+// PublishReport announces a shift report on the report subject
+func (s *Service) PublishReport(report *ShiftReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := s.nc.Publish(shared.ReportSubjectName, data); err != nil {
+		return fmt.Errorf("failed to publish report: %w", err)
+	}
+	return nil
+}
+
+// reportSlug keeps shift names safe for file names
+var reportSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Write saves the report to dir as Markdown and JSON, e.g. 2025-02-01-0600-early.md and
+// 2025-02-01-0600-early.json, and returns the path of the Markdown file
+func (r *ShiftReport) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	name := r.Start.Format("2006-01-02-1504")
+	if slug := strings.Trim(reportSlug.ReplaceAllString(strings.ToLower(r.Shift), "-"), "-"); slug != "" {
+		name += "-" + slug
+	}
+	base := filepath.Join(dir, name)
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(base+".json", data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := os.WriteFile(base+".md", []byte(r.Markdown()), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return base + ".md", nil
+}
+
+// Markdown renders the report for people
+func (r *ShiftReport) Markdown() string {
+	const stamp = "2006-01-02 15:04 MST"
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s shift report\n\n", r.Shift)
+	fmt.Fprintf(&b, "%s to %s, %d log entries (%d with reused analyses). Generated %s.\n\n",
+		r.Start.Format(stamp), r.End.Format(stamp), r.Total, r.Reused, r.GeneratedAt.Format(stamp))
+
+	b.WriteString("## Summary\n\n")
+	if r.Summary != "" {
+		b.WriteString(r.Summary + "\n\n")
+	} else {
+		b.WriteString("_No summary could be generated; see the sections below._\n\n")
+	}
+
+	b.WriteString("## Logs by service and severity\n\n")
+	if len(r.Groups) == 0 {
+		b.WriteString("No logs were stored during the shift.\n\n")
+	} else {
+		b.WriteString("| Service | Severity | Entries | Reused | Hosts | Incidents | Max risk | Avg risk |\n")
+		b.WriteString("|---|---|---:|---:|---:|---:|---:|---:|\n")
+		for _, g := range r.Groups {
+			fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %d | %d | %.0f |\n",
+				cell(g.Service), cell(g.Severity), g.Count, g.Reused, g.Hosts, g.Incidents, g.MaxRisk, g.AvgRisk)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Incidents\n\n")
+	if len(r.Incidents) == 0 {
+		b.WriteString("No incidents were open during the shift.\n\n")
+	}
+	for _, inc := range r.Incidents {
+		fmt.Fprintf(&b, "### #%d %s\n\n", inc.ID, inc.Title)
+		fmt.Fprintf(&b, "%s, %d entries, highest risk %d, opened %s", inc.Status, inc.Entries, inc.MaxRisk, inc.OpenedAt.Local().Format(stamp))
+		if inc.ClosedAt != nil {
+			fmt.Fprintf(&b, ", closed %s", inc.ClosedAt.Local().Format(stamp))
+		}
+		b.WriteString(".\n\n")
+		if inc.Summary != "" {
+			b.WriteString(inc.Summary + "\n\n")
+		}
+	}
+
+	b.WriteString("## Highest-risk entries\n\n")
+	if len(r.TopLogs) == 0 {
+		b.WriteString("No analyzed entries.\n")
+		return b.String()
+	}
+	b.WriteString("| Log | Time | Host | Service | Severity | Risk | Message | Analysis |\n")
+	b.WriteString("|---:|---|---|---|---|---:|---|---|\n")
+	for _, e := range r.TopLogs {
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %d | %s | %s |\n", e.ID, cell(e.Timestamp), cell(e.Hostname),
+			cell(e.Service), cell(e.Severity), e.RiskScore, cell(truncate(e.Message, 120)), cell(e.Summary))
+	}
+	return b.String()
+}
+
+// cell makes text safe for a Markdown table cell
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ").Replace(s)
+}
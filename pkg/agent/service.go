@@ -8,12 +8,17 @@ import (
 	"log"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nats-io/nats.go"
-	swarmgo "github.com/prathyushnallamothu/swarmgo"
-	llm "github.com/prathyushnallamothu/swarmgo/llm"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/tobalo/gogent/pkg/anomaly"
+	"github.com/tobalo/gogent/pkg/cluster"
 	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/embed"
+	"github.com/tobalo/gogent/pkg/embeddednats"
 	"github.com/tobalo/gogent/pkg/shared"
 )
 
@@ -24,18 +29,65 @@ type Config struct {
 	AgentName    string
 	Instructions string
 	Model        string
-	Provider     string // LLM provider (ollama, openai, azure, etc.)
-	DBPath       string // Path to SQLite database
+	Provider     string        // LLM provider (ollama, openai, azure, etc.)
+	DBPath       string        // Path to SQLite database
+	AckWait      time.Duration // How long JetStream waits for an ack before redelivering
+	MaxDeliver   int           // Attempts per message before it is dead-lettered
+	Workers      int           // Number of concurrent analysis workers
+	MaxInFlight  int           // Messages pulled from the stream but not yet acked
+	BatchSize    int           // Logs collected per batch; batching is disabled below 2
+	BatchDelay   time.Duration // How long to collect a batch before analyzing it
+	MockScript   string        // Optional JSON script replayed by the MOCK provider
+	Analyzer     Analyzer      // Optional: overrides the backend built from Provider
+
+	// Optional: ordered fallback chain replacing Provider, Model and APIKey
+	Providers        []ProviderConfig
+	BreakerThreshold int           // Consecutive failures before a provider's circuit opens
+	BreakerCooldown  time.Duration // How long a circuit stays open before a probe
+
+	PromptDir    string        // Optional: directory of *.tmpl prompt overrides
+	PromptBucket string        // Optional: NATS KV bucket of prompt overrides
+	PromptReload time.Duration // How often PromptDir is checked for changes
+
+	CacheTTL         time.Duration // How long analyses are reused for matching fingerprints; zero disables the cache
+	CacheIncludeHost bool          // Whether the hostname is part of the fingerprint
+
+	TemplateReuse      bool    // Reuse the analysis of a known log template instead of calling the LLM
+	TemplateSimilarity float64 // Share of tokens a log must share with a template to join it
+	TemplateLimit      int     // Templates kept in memory; the least recently seen is forgotten beyond it
+
+	ClusterReuse     bool    // Reuse the analysis of a cluster's representative for its members
+	ClusterThreshold float64 // TF-IDF cosine similarity a log needs to join a cluster
+	ClusterLimit     int     // Clusters kept in memory; the least recently joined is forgotten beyond it
+
+	AnomalyWindow    time.Duration // Width of the windows log rates are counted in
+	AnomalyThreshold float64       // Standard deviations above the baseline that make a spike
+
+	IncidentWindow   time.Duration // How close together correlated logs must arrive to open an incident
+	IncidentQuiet    time.Duration // How long an incident stays open without new logs
+	IncidentMinLogs  int           // Correlated logs needed to open an incident
+	HostGroupPattern string        // Regexp whose first group extracts a hostname's host group
+
+	HistoryResults int            // Similar past logs added to each prompt; zero disables retrieval
+	Embedder       embed.Embedder // Optional: embeds stored logs for vector search instead of full-text search
 }
 
 // Service manages the agent and its NATS connection
 type Service struct {
-	config Config
-	agent  *swarmgo.Agent
-	swarm  *swarmgo.Swarm
-	nc     *nats.Conn
-	js     nats.JetStreamContext
-	dbConn *sql.DB
+	config    Config
+	analyzer  Analyzer
+	prompts   *PromptLibrary
+	drain     *Drain
+	clusters  *cluster.Clusterer
+	anomalies *anomaly.Detector
+	incidents *incidentTracker
+	queries   micro.Service
+	nc        *nats.Conn
+	js        nats.JetStreamContext
+	dbConn    *sql.DB
+	queue     *embeddednats.MessageQueue
+	jobs      chan *job
+	wg        sync.WaitGroup
 }
 
 // LogMessage represents the structure of log messages received
@@ -48,6 +100,66 @@ type LogMessage struct {
 	Context   map[string]interface{} `json:"context"`
 }
 
+// AnalysisReply is the analysis of a log as sent to the publisher's reply subject and to the
+// analysis subject
+type AnalysisReply struct {
+	LogID           int64               `json:"log_id"`
+	OriginalMessage LogMessage          `json:"original_message"`
+	Format          string              `json:"format"`                // Input format the log was decoded from
+	RawPayload      []byte              `json:"raw_payload,omitempty"` // Payload of a non-JSON log, on stored logs only; base64 in JSON
+	Analysis        string              `json:"analysis"`
+	Provider        string              `json:"provider"`
+	Structured      *StructuredAnalysis `json:"structured"`
+	Fingerprint     string              `json:"fingerprint"`
+	Cached          bool                `json:"cached"`
+	ReusedFrom      string              `json:"reused_from"`
+	CacheHits       int                 `json:"cache_hits"`
+	TemplateID      int64               `json:"template_id"`
+	Template        string              `json:"template"`
+	TemplateStatus  string              `json:"template_status"`
+	ClusterID       int64               `json:"cluster_id"`
+	ClusterMembers  int64               `json:"cluster_members"`
+	ClusterHosts    int                 `json:"cluster_hosts"`
+	SimilarLogs     []int64             `json:"similar_logs"`
+	IncidentID      int64               `json:"incident_id"`
+	Timestamp       string              `json:"timestamp"`
+}
+
+// Sources of a reused analysis
+const (
+	reusedCache    = "cache"    // Same fingerprint analyzed within CacheTTL
+	reusedTemplate = "template" // Same unchanged log template analyzed before
+	reusedCluster  = "cluster"  // Representative of the near-duplicate cluster analyzed before
+)
+
+// job is a unit of work for the worker pool: a single message, or in batch mode a group of
+// related logs already decoded into records
+type job struct {
+	msgs []*nats.Msg
+	recs []*record // One per message of a batch group; nil for a single message
+}
+
+// record carries one log through analysis, storage and reply
+type record struct {
+	msg            *nats.Msg
+	log            LogMessage
+	format         string // Input format the log was decoded from
+	redelivered    bool   // JetStream delivered the message before, so it was already counted
+	fingerprint    string
+	template       LogTemplate
+	templateParams []string
+	templateStatus string
+	cluster        cluster.Assignment
+	anomalyRaised  bool            // The log raised a new anomaly, so its analysis is never reused
+	sections       []PromptSection // Extra prompt context from the pre-analysis stages
+	result         *AnalysisResult
+	structured     *StructuredAnalysis // nil when the model never produced valid JSON
+	reused         string              // Where a reused analysis came from, empty for fresh analyses
+	cacheHits      int
+	history        []int64   // Past logs added to the prompt as similar history
+	embedding      []float32 // Embedding of the message, computed on first use
+}
+
 // NewService creates a new agent service
 func NewService(cfg Config) (*Service, error) {
 	// Set defaults if not provided
@@ -57,17 +169,96 @@ func NewService(cfg Config) (*Service, error) {
 	if cfg.Model == "" {
 		cfg.Model = shared.AgentModel
 	}
+	if cfg.Instructions == "" {
+		cfg.Instructions = shared.AgentInstructions
+	}
 	if cfg.DBPath == "" {
 		cfg.DBPath = filepath.Join("data", "agent.db")
 	}
+	if cfg.AckWait <= 0 {
+		cfg.AckWait = shared.AckWait
+	}
+	if cfg.MaxDeliver <= 0 {
+		cfg.MaxDeliver = shared.MaxDeliver
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = shared.Workers
+	}
+	if cfg.MaxInFlight < cfg.Workers {
+		cfg.MaxInFlight = 2 * cfg.Workers
+	}
+	if cfg.BatchDelay <= 0 {
+		cfg.BatchDelay = shared.BatchDelay
+	}
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = []ProviderConfig{{Provider: cfg.Provider, Model: cfg.Model, APIKey: cfg.APIKey}}
+	}
+	for i := range cfg.Providers {
+		if cfg.Providers[i].Timeout <= 0 {
+			cfg.Providers[i].Timeout = shared.AnalysisTimeout
+		}
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = shared.BreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = shared.BreakerCooldown
+	}
+	if cfg.PromptReload <= 0 {
+		cfg.PromptReload = shared.PromptReload
+	}
+	if cfg.TemplateSimilarity <= 0 {
+		cfg.TemplateSimilarity = shared.TemplateSimilarity
+	}
+	if cfg.TemplateLimit <= 0 {
+		cfg.TemplateLimit = shared.TemplateLimit
+	}
+	if cfg.ClusterThreshold <= 0 {
+		cfg.ClusterThreshold = shared.ClusterThreshold
+	}
+	if cfg.ClusterLimit <= 0 {
+		cfg.ClusterLimit = shared.ClusterLimit
+	}
+	if cfg.AnomalyWindow <= 0 {
+		cfg.AnomalyWindow = shared.AnomalyWindow
+	}
+	if cfg.AnomalyThreshold <= 0 {
+		cfg.AnomalyThreshold = shared.AnomalyThreshold
+	}
+	if cfg.IncidentWindow <= 0 {
+		cfg.IncidentWindow = shared.IncidentWindow
+	}
+	if cfg.IncidentQuiet <= 0 {
+		cfg.IncidentQuiet = shared.IncidentQuiet
+	}
+	if cfg.IncidentMinLogs <= 0 {
+		cfg.IncidentMinLogs = shared.IncidentMinLogs
+	}
+	if cfg.HostGroupPattern == "" {
+		cfg.HostGroupPattern = shared.HostGroupPattern
+	}
+	incidents, err := newIncidentTracker(cfg.HostGroupPattern)
+	if err != nil {
+		return nil, err
+	}
 
-	// Convert provider to uppercase for LLMProvider matching
-	provider := strings.ToUpper(cfg.Provider)
-
-	// Validate provider-specific requirements
-	if provider != shared.ProviderOllama && cfg.APIKey == "" {
-		return nil, fmt.Errorf("API key is required for %s provider", provider)
+	// Build the LLM backends unless one was injected
+	var analyzers []Analyzer
+	var timeouts []time.Duration
+	if cfg.Analyzer != nil {
+		analyzers = append(analyzers, cfg.Analyzer)
+		timeouts = append(timeouts, shared.AnalysisTimeout)
+	} else {
+		for _, pc := range cfg.Providers {
+			a, err := newAnalyzer(cfg, pc)
+			if err != nil {
+				return nil, err
+			}
+			analyzers = append(analyzers, a)
+			timeouts = append(timeouts, pc.Timeout)
+		}
 	}
+	analyzer := NewFallbackAnalyzer(analyzers, timeouts, cfg.BreakerThreshold, cfg.BreakerCooldown)
 
 	// Initialize database
 	dbConn, err := db.InitDB(cfg.DBPath)
@@ -75,36 +266,6 @@ func NewService(cfg Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	// Create swarm instance with appropriate provider
-	var llmProvider llm.LLMProvider
-	switch provider {
-	case shared.ProviderOpenAI:
-		llmProvider = llm.LLMProvider(shared.ProviderOpenAI)
-	case shared.ProviderAzure:
-		llmProvider = llm.LLMProvider(shared.ProviderAzure)
-	case shared.ProviderAzureAD:
-		llmProvider = llm.LLMProvider(shared.ProviderAzureAD)
-	case shared.ProviderCloudflareAzure:
-		llmProvider = llm.LLMProvider(shared.ProviderCloudflareAzure)
-	case shared.ProviderGemini:
-		llmProvider = llm.LLMProvider(shared.ProviderGemini)
-	case shared.ProviderClaude:
-		llmProvider = llm.LLMProvider(shared.ProviderClaude)
-	case shared.ProviderOllama:
-		llmProvider = llm.LLMProvider(shared.ProviderOllama)
-	case shared.ProviderDeepSeek:
-		llmProvider = llm.LLMProvider(shared.ProviderDeepSeek)
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", provider)
-	}
-
-	swarm := swarmgo.NewSwarm(cfg.APIKey, llmProvider)
-	agent := &swarmgo.Agent{
-		Name:         cfg.AgentName,
-		Instructions: cfg.Instructions,
-		Model:        cfg.Model,
-	}
-
 	// Connect to NATS
 	nc, err := nats.Connect(cfg.NATSUrl)
 	if err != nil {
@@ -118,123 +279,374 @@ func NewService(cfg Config) (*Service, error) {
 		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
 	}
 
-	return &Service{
-		config: cfg,
-		agent:  agent,
-		swarm:  swarm,
-		nc:     nc,
-		js:     js,
-		dbConn: dbConn,
-	}, nil
+	s := &Service{
+		config:   cfg,
+		analyzer: analyzer,
+		prompts:  NewPromptLibrary(),
+		drain:    NewDrain(shared.TemplateDepth, cfg.TemplateSimilarity, cfg.TemplateLimit),
+		clusters: cluster.New(cluster.Config{
+			Bands:     shared.ClusterBands,
+			Rows:      shared.ClusterRows,
+			Threshold: cfg.ClusterThreshold,
+			Window:    shared.ClusterWindow,
+			Limit:     cfg.ClusterLimit,
+		}),
+		anomalies: anomaly.New(anomaly.Config{
+			Window:          cfg.AnomalyWindow,
+			Threshold:       cfg.AnomalyThreshold,
+			MinCount:        shared.AnomalyMinCount,
+			Warmup:          shared.AnomalyWarmup,
+			SilenceExpected: shared.AnomalySilenceExpected,
+		}),
+		incidents: incidents,
+		nc:        nc,
+		js:        js,
+		dbConn:    dbConn,
+	}
+
+	if err := s.loadTemplates(); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to load log templates: %w", err)
+	}
+	if err := s.loadClusters(); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to load log clusters: %w", err)
+	}
+	if err := s.loadBaselines(); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to load anomaly baselines: %w", err)
+	}
+	if err := s.loadIncidents(); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to load open incidents: %w", err)
+	}
+
+	if cfg.BatchSize > 1 {
+		s.queue = embeddednats.NewMessageQueue(embeddednats.QueueConfig{
+			QueueSize:    cfg.MaxInFlight,
+			BatchSize:    cfg.BatchSize,
+			ProcessDelay: cfg.BatchDelay,
+		}, s)
+	}
+
+	return s, nil
 }
 
-// Start begins listening for messages on the configured subject
+// Start begins consuming messages from the durable JetStream consumer
 func (s *Service) Start(ctx context.Context) error {
-	// Subscribe directly to the subject
-	sub, err := s.nc.Subscribe(shared.SubjectName, func(msg *nats.Msg) {
-		s.handleMessage(ctx, msg)
-	})
+	if err := s.ensureConsumer(); err != nil {
+		return err
+	}
+
+	// Bind to the durable consumer so processing resumes from the last ack after a restart
+	sub, err := s.js.PullSubscribe(shared.SubjectName, shared.ConsumerName,
+		nats.Bind(shared.StreamName, shared.ConsumerName))
 	if err != nil {
 		return fmt.Errorf("failed to subscribe: %w", err)
 	}
 
-	// Ensure subscription is properly cleaned up
-	go func() {
-		<-ctx.Done()
-		sub.Unsubscribe()
-	}()
+	// Load prompt overrides and keep them in sync with their sources
+	if s.config.PromptDir != "" {
+		if err := s.prompts.LoadDir(s.config.PromptDir); err != nil {
+			return fmt.Errorf("failed to load prompt templates: %w", err)
+		}
+		go s.prompts.WatchDir(ctx, s.config.PromptDir, s.config.PromptReload)
+	}
+	if s.config.PromptBucket != "" {
+		kv, err := promptBucket(s.js, s.config.PromptBucket)
+		if err != nil {
+			return err
+		}
+		if err := s.prompts.WatchKV(ctx, kv); err != nil {
+			return err
+		}
+	}
+
+	// Catch messages that ran out of deliveries without reaching a verdict, e.g. after a crash.
+	// Every instance sees the advisory, so they share a queue group to dead-letter it once.
+	advisory := fmt.Sprintf("%s.%s.%s", shared.MaxDeliveriesAdvisory, shared.StreamName, shared.ConsumerName)
+	if _, err := s.nc.QueueSubscribe(advisory, shared.ConsumerName, s.handleMaxDeliveries); err != nil {
+		return fmt.Errorf("failed to subscribe to max deliveries advisory: %w", err)
+	}
+
+	if err := s.subscribeFeedback(); err != nil {
+		return err
+	}
+	if err := s.startQueryService(); err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go s.watchAnomalies(ctx)
+	s.wg.Add(1)
+	go s.watchIncidents(ctx)
+	s.wg.Add(1)
+	go s.summarizeIncidents(ctx)
 
-	log.Printf("Agent service started with %s provider and %s model, listening on %s",
-		strings.ToUpper(s.config.Provider), s.config.Model, shared.SubjectName)
+	s.wg.Add(1)
+	go s.consume(ctx, sub)
+
+	log.Printf("Agent service started with %s provider chain, consuming %s from %s with %d workers",
+		s.analyzer.Name(), shared.ConsumerName, shared.StreamName, s.config.Workers)
 	return nil
 }
 
 // handleMessage processes a single message through the agent
-func (s *Service) handleMessage(ctx context.Context, msg *nats.Msg) {
-	var logMsg LogMessage
-	if err := json.Unmarshal(msg.Data, &logMsg); err != nil {
-		log.Printf("Error unmarshaling message: %v", err)
-		return
-	}
-
-	// Format the message for the agent
-	prompt := fmt.Sprintf(`Analyze this technical log entry and provide insights:
-Timestamp: %s
-Host: %s
-Severity: %s
-Service: %s
-Message: %s
-Additional Context: %v`,
-		logMsg.Timestamp,
-		logMsg.Hostname,
-		logMsg.Severity,
-		logMsg.Service,
-		logMsg.Message,
-		logMsg.Context,
-	)
-
-	messages := []llm.Message{
-		{Role: llm.RoleUser, Content: prompt},
-	}
-
-	log.Printf("Processing log message from %s [%s] %s", logMsg.Hostname, logMsg.Severity, logMsg.Message)
-
-	// Add timeout for agent processing
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	response, err := s.swarm.Run(ctx, s.agent, messages, nil, "", false, false, 5, true)
+func (s *Service) handleMessage(ctx context.Context, msg *nats.Msg) error {
+	rec, err := s.newRecord(msg)
 	if err != nil {
-		log.Printf("Error processing message: %v", err)
-		return
+		return err
+	}
+
+	if !s.prepare(rec) {
+		log.Printf("Processing log message from %s [%s] %s", rec.log.Hostname, rec.log.Severity, rec.log.Message)
+		if err := s.analyzeRecord(ctx, rec); err != nil {
+			return err
+		}
 	}
 
-	analysis := response.Messages[len(response.Messages)-1].Content
+	return s.complete(rec)
+}
+
+// newRecord decodes a message and fingerprints its log
+func (s *Service) newRecord(msg *nats.Msg) (*record, error) {
+	logMsg, format, err := decodeLogMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	rec := &record{
+		msg:         msg,
+		log:         logMsg,
+		format:      format,
+		fingerprint: Fingerprint(logMsg, s.config.CacheIncludeHost),
+	}
+	if meta, err := msg.Metadata(); err == nil && meta.NumDelivered > 1 {
+		rec.redelivered = true
+	}
+	return rec, nil
+}
+
+// prepare runs the pre-analysis stages on a record and reports whether they already supplied
+// its analysis, so the LLM call can be skipped. A log that raised an anomaly is always analyzed
+// afresh so the model sees the anomaly. Logs left for the LLM get similar past logs as context.
+func (s *Service) prepare(rec *record) bool {
+	s.mineTemplate(rec)
+	s.assignCluster(rec)
+	s.observeRate(rec)
+	if !rec.anomalyRaised && (s.lookupCache(rec) || s.reuseTemplate(rec) || s.reuseCluster(rec)) {
+		return true
+	}
+	s.addHistory(rec)
+	return false
+}
+
+// reuseLog fills rec from the structured analysis stored with an earlier log and reports
+// whether there was one
+func (s *Service) reuseLog(rec *record, logID int64, source string) bool {
+	if logID == 0 {
+		return false
+	}
+	entry, err := db.GetLogEntry(logID)
+	if err != nil {
+		log.Printf("Error reading %s analysis: %v", source, err)
+		return false
+	}
+	if entry == nil || entry.Summary == "" {
+		return false
+	}
+
+	structured := &StructuredAnalysis{
+		Summary:    entry.Summary,
+		RootCause:  entry.RootCause,
+		Category:   entry.Category,
+		RiskScore:  entry.RiskScore,
+		Confidence: entry.Confidence,
+	}
+	if err := json.Unmarshal([]byte(entry.RecommendedActions), &structured.RecommendedActions); err != nil {
+		log.Printf("Error decoding %s recommended actions: %v", source, err)
+		return false
+	}
+
+	rec.result = &AnalysisResult{Content: entry.Analysis, Provider: entry.Provider}
+	rec.structured = structured
+	rec.reused = source
+	return true
+}
+
+// analyzeRecord asks the provider chain for a structured analysis of a single log
+func (s *Service) analyzeRecord(ctx context.Context, rec *record) error {
+	prompt := s.prompts.Prompt(PromptData{LogMessage: rec.log, Sections: rec.sections})
+	instructions := s.prompts.Instructions(rec.log, s.config.Instructions)
+
+	result, err := s.analyzeStructured(ctx, instructions, prompt, structuredInstructions, func(text string) (err error) {
+		rec.structured, err = parseStructured(text)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	rec.result = result
+	return nil
+}
+
+// newAnalyzer builds the LLM backend for one provider in the chain
+func newAnalyzer(cfg Config, pc ProviderConfig) (Analyzer, error) {
+	if strings.ToUpper(pc.Provider) != shared.ProviderMock {
+		return NewSwarmAnalyzer(pc.Provider, pc.Model, pc.APIKey, cfg.AgentName)
+	}
+	if cfg.MockScript == "" {
+		return NewMockAnalyzer(), nil
+	}
+	steps, err := LoadMockScript(cfg.MockScript)
+	if err != nil {
+		return nil, err
+	}
+	return NewMockAnalyzer(steps...), nil
+}
+
+// analyze runs a prompt through the provider chain and returns its final answer
+func (s *Service) analyze(ctx context.Context, instructions, prompt string) (*AnalysisResult, error) {
+	result, err := s.analyzer.Analyze(ctx, AnalysisRequest{
+		Instructions: instructions,
+		Prompt:       prompt,
+	})
+	if err != nil {
+		return nil, transientFailure(reasonAnalysis, fmt.Errorf("failed to analyze message: %w", err))
+	}
+	return result, nil
+}
+
+// complete stores an analyzed log, caches a fresh structured analysis and sends the analysis
+// to the publisher if it asked for one
+func (s *Service) complete(rec *record) error {
+	logMsg, result, structured := rec.log, rec.result, rec.structured
 
 	// Store log in database
 	contextJSON, err := json.Marshal(logMsg.Context)
 	if err != nil {
-		log.Printf("Error marshaling context: %v", err)
-		return
+		return permanentFailure(reasonDecode, fmt.Errorf("failed to marshal context: %w", err))
 	}
 
 	logEntry := db.LogEntry{
-		Timestamp: logMsg.Timestamp,
-		Hostname:  logMsg.Hostname,
-		Severity:  logMsg.Severity,
-		Service:   logMsg.Service,
-		Message:   logMsg.Message,
-		Context:   string(contextJSON),
-		Analysis:  analysis,
+		Timestamp:   logMsg.Timestamp,
+		Hostname:    logMsg.Hostname,
+		Severity:    logMsg.Severity,
+		Service:     logMsg.Service,
+		Message:     logMsg.Message,
+		Context:     string(contextJSON),
+		Analysis:    result.Content,
+		Provider:    result.Provider,
+		Fingerprint: rec.fingerprint,
+		Cached:      rec.reused != "",
+		TemplateID:  rec.template.ID,
+		ClusterID:   rec.cluster.ID,
+		Format:      rec.format,
+	}
+	// Keep what other formats were decoded from byte for byte, as compressed GELF is binary;
+	// native JSON is stored field by field already
+	if rec.format != FormatJSON {
+		logEntry.RawPayload = rec.msg.Data
+	}
+	if len(rec.templateParams) > 0 {
+		paramsJSON, err := json.Marshal(rec.templateParams)
+		if err != nil {
+			return permanentFailure(reasonDecode, fmt.Errorf("failed to marshal template parameters: %w", err))
+		}
+		logEntry.TemplateParams = string(paramsJSON)
+	}
+	if structured != nil {
+		actionsJSON, err := json.Marshal(structured.RecommendedActions)
+		if err != nil {
+			return permanentFailure(reasonDecode, fmt.Errorf("failed to marshal recommended actions: %w", err))
+		}
+		logEntry.Summary = structured.Summary
+		logEntry.RootCause = structured.RootCause
+		logEntry.Category = structured.Category
+		logEntry.RiskScore = structured.RiskScore
+		logEntry.RecommendedActions = string(actionsJSON)
+		logEntry.Confidence = structured.Confidence
 	}
 
-	if err := db.InsertLogEntry(logEntry); err != nil {
-		log.Printf("Error storing log in database: %v", err)
+	id, err := db.InsertLogEntry(logEntry)
+	if err != nil {
+		return transientFailure(reasonStorage, fmt.Errorf("failed to store log in database: %w", err))
 	}
 
-	log.Printf("Analysis complete for %s: %s", logMsg.Service, analysis[:100]+"...")
+	if rec.reused == "" {
+		s.storeCache(rec, logEntry)
+		s.storeTemplateAnalysis(rec, id)
+		s.storeClusterAnalysis(rec, id)
+	}
+	s.storeEmbedding(rec, id)
+	incidentID := s.correlate(rec, id)
+
+	summary := result.Content
+	if structured != nil {
+		summary = structured.Summary
+	}
+	switch rec.reused {
+	case reusedCache:
+		log.Printf("Reused cached analysis for %s (hit %d): %s", logMsg.Service, rec.cacheHits, truncate(summary, 100))
+	case reusedTemplate:
+		log.Printf("Reused analysis of template %d for %s: %s", rec.template.ID, logMsg.Service, truncate(summary, 100))
+	case reusedCluster:
+		log.Printf("Reused analysis of cluster %d for %s (member %d on %d hosts): %s",
+			rec.cluster.ID, logMsg.Service, rec.cluster.Members, rec.cluster.Hosts, truncate(summary, 100))
+	default:
+		log.Printf("Analysis complete for %s by %s: %s", logMsg.Service, result.Provider, truncate(summary, 100))
+	}
 
 	// Prepare response
-	responseData, err := json.Marshal(map[string]interface{}{
-		"original_message": logMsg,
-		"analysis":         analysis,
-		"timestamp":        time.Now().Format(time.RFC3339),
+	responseData, err := json.Marshal(AnalysisReply{
+		LogID:           id,
+		OriginalMessage: logMsg,
+		Format:          rec.format,
+		Analysis:        result.Content,
+		Provider:        result.Provider,
+		Structured:      structured,
+		Fingerprint:     rec.fingerprint,
+		Cached:          rec.reused != "",
+		ReusedFrom:      rec.reused,
+		CacheHits:       rec.cacheHits,
+		TemplateID:      rec.template.ID,
+		Template:        rec.template.String(),
+		TemplateStatus:  rec.templateStatus,
+		ClusterID:       rec.cluster.ID,
+		ClusterMembers:  rec.cluster.Members,
+		ClusterHosts:    rec.cluster.Hosts,
+		SimilarLogs:     rec.history,
+		IncidentID:      incidentID,
+		Timestamp:       time.Now().Format(time.RFC3339),
 	})
 	if err != nil {
 		log.Printf("Error marshaling response: %v", err)
-		return
+		return nil
+	}
+
+	// Announce the analysis to live subscribers such as the HTTP event stream
+	if err := s.nc.Publish(shared.AnalysisSubjectName, responseData); err != nil {
+		log.Printf("Error publishing analysis: %v", err)
 	}
 
-	// Send response if reply subject is provided
-	if msg.Reply != "" {
-		if err := msg.Respond(responseData); err != nil {
+	// Send response if the publisher asked for one
+	if replyTo := rec.msg.Header.Get(shared.ReplyToHeader); replyTo != "" {
+		if err := s.nc.Publish(replyTo, responseData); err != nil {
 			log.Printf("Error sending response: %v", err)
 		}
 	}
+	return nil
 }
 
 // Stop gracefully shuts down the service
 func (s *Service) Stop() error {
+	// Let in-flight messages settle before the connection goes away
+	s.wg.Wait()
+	if s.dbConn != nil {
+		s.saveBaselines()
+	}
+	if s.queries != nil {
+		s.queries.Stop()
+	}
 	if s.nc != nil {
 		s.nc.Close()
 	}
@@ -243,3 +655,14 @@ func (s *Service) Stop() error {
 	}
 	return nil
 }
+
+// truncate shortens s to at most n bytes for logging, cutting on a rune boundary
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/embeddednats"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// freePort returns a TCP port nothing is listening on
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// startNATS runs the embedded server from a temporary working directory, where it keeps its
+// JetStream data
+func startNATS(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	port := freePort(t)
+	natsService, err := embeddednats.NewNatsService(port, embeddednats.Options{})
+	if err != nil {
+		t.Fatalf("failed to create NATS service: %v", err)
+	}
+	if err := natsService.Start(); err != nil {
+		t.Fatalf("failed to start NATS service: %v", err)
+	}
+	t.Cleanup(func() { natsService.Stop() })
+	return fmt.Sprintf("nats://127.0.0.1:%d", port)
+}
+
+// TestServiceAnalyzesAndDeadLetters runs logs from the NATS subject through the mock
+// analyzer into SQLite, and a log the analyzer keeps failing on into the DLQ. The db
+// package keeps one connection per process, so both paths share one service.
+func TestServiceAnalyzesAndDeadLetters(t *testing.T) {
+	url := startNATS(t)
+
+	answer := `{"summary": "Disk /var is full", "root_cause": "Log rotation stopped",
+		"category": "resource", "risk_score": 70, "recommended_actions": ["Rotate logs"], "confidence": 0.8}`
+	provider := errors.New("provider unavailable")
+	mock := NewMockAnalyzer(
+		MockStep{Response: answer, Latency: 200 * time.Millisecond},
+		MockStep{Err: provider},
+		MockStep{Err: provider},
+	)
+
+	svc, err := NewService(Config{
+		NATSUrl:    url,
+		DBPath:     filepath.Join(t.TempDir(), "agent.db"),
+		Provider:   "MOCK",
+		Analyzer:   mock,
+		MaxDeliver: 2,
+		Workers:    1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := svc.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("failed to start service: %v", err)
+	}
+	defer func() {
+		cancel()
+		svc.Stop()
+	}()
+
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("failed to get JetStream context: %v", err)
+	}
+
+	publish := func(logMsg LogMessage, replyTo string) {
+		t.Helper()
+		data, err := json.Marshal(logMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := nats.NewMsg(shared.SubjectName)
+		msg.Data = data
+		if replyTo != "" {
+			msg.Header.Set(shared.ReplyToHeader, replyTo)
+		}
+		if _, err := js.PublishMsg(msg); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	t.Run("analysis", func(t *testing.T) {
+		inbox := nats.NewInbox()
+		replies, err := nc.SubscribeSync(inbox)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer replies.Unsubscribe()
+
+		logMsg := LogMessage{
+			Timestamp: "2026-10-17T08:00:00Z",
+			Hostname:  "plc-01",
+			Severity:  "ERROR",
+			Service:   "historian",
+			Message:   "No space left on device writing /var/lib/historian/segment.dat",
+			Context:   map[string]interface{}{"line": "3"},
+		}
+		start := time.Now()
+		publish(logMsg, inbox)
+
+		msg, err := replies.NextMsg(30 * time.Second)
+		if err != nil {
+			t.Fatalf("no reply: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("reply after %v, before the analyzer's latency", elapsed)
+		}
+		var reply struct {
+			OriginalMessage LogMessage          `json:"original_message"`
+			Structured      *StructuredAnalysis `json:"structured"`
+		}
+		if err := json.Unmarshal(msg.Data, &reply); err != nil {
+			t.Fatalf("invalid reply: %v", err)
+		}
+		if reply.OriginalMessage.Message != logMsg.Message {
+			t.Errorf("reply is for %q", reply.OriginalMessage.Message)
+		}
+		if reply.Structured == nil || reply.Structured.Summary != "Disk /var is full" {
+			t.Fatalf("reply structured analysis = %+v", reply.Structured)
+		}
+
+		var hostname, severity, summary, rootCause, category string
+		var riskScore int
+		err = svc.dbConn.QueryRow(`SELECT hostname, severity, summary, root_cause, category, risk_score
+			FROM agent_logs WHERE message = ?`, logMsg.Message).
+			Scan(&hostname, &severity, &summary, &rootCause, &category, &riskScore)
+		if err != nil {
+			t.Fatalf("failed to read stored log: %v", err)
+		}
+		if hostname != "plc-01" || severity != "ERROR" || summary != "Disk /var is full" ||
+			rootCause != "Log rotation stopped" || category != "resource" || riskScore != 70 {
+			t.Errorf("stored log = %s %s %q %q %s %d", hostname, severity, summary, rootCause, category, riskScore)
+		}
+	})
+
+	t.Run("dead letter", func(t *testing.T) {
+		logMsg := LogMessage{
+			Timestamp: "2026-10-17T08:05:00Z",
+			Hostname:  "plc-02",
+			Severity:  "WARN",
+			Service:   "conveyor",
+			Message:   "Belt speed sensor reading out of range",
+		}
+		publish(logMsg, "")
+
+		// The first failure is retried after shared.NakDelay, the second dead-letters the log
+		var entries []DLQMessage
+		deadline := time.Now().Add(30 * time.Second)
+		for len(entries) == 0 && time.Now().Before(deadline) {
+			time.Sleep(250 * time.Millisecond)
+			if entries, err = ListDLQ(js, 0); err != nil {
+				t.Fatalf("failed to list DLQ: %v", err)
+			}
+		}
+		if len(entries) != 1 {
+			t.Fatalf("DLQ holds %d entries", len(entries))
+		}
+		entry := entries[0].Entry
+		if entry.Attempts != 2 {
+			t.Errorf("dead-lettered after %d attempts", entry.Attempts)
+		}
+		if entry.Reason != reasonAnalysis || entry.Provider != shared.ProviderMock {
+			t.Errorf("DLQ entry blames %s for %s", entry.Provider, entry.Reason)
+		}
+		if entry.Error == "" || entry.Subject != shared.SubjectName {
+			t.Errorf("DLQ entry = %+v", entry)
+		}
+		var payload LogMessage
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil || payload.Message != logMsg.Message {
+			t.Errorf("DLQ payload = %s", entry.Payload)
+		}
+
+		var stored int
+		if err := svc.dbConn.QueryRow(`SELECT COUNT(*) FROM agent_logs WHERE message = ?`, logMsg.Message).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if stored != 0 {
+			t.Errorf("dead-lettered log was stored %d times", stored)
+		}
+		if got := len(mock.Requests()); got != 3 {
+			t.Errorf("analyzer called %d times", got)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// StructuredAnalysis is the JSON answer the agent asks the model for
+type StructuredAnalysis struct {
+	Summary            string   `json:"summary"`
+	RootCause          string   `json:"root_cause"`
+	Category           string   `json:"category"`
+	RiskScore          int      `json:"risk_score"`
+	RecommendedActions []string `json:"recommended_actions"`
+	Confidence         float64  `json:"confidence"`
+}
+
+// analysisCategories are the values allowed in StructuredAnalysis.Category
+var analysisCategories = []string{
+	"hardware", "network", "software", "configuration", "security", "resource", "process", "other",
+}
+
+// analysisSchema describes StructuredAnalysis to the model
+var analysisSchema = `{
+  "type": "object",
+  "required": ["summary", "root_cause", "category", "risk_score", "recommended_actions", "confidence"],
+  "properties": {
+    "summary": {"type": "string", "description": "One or two sentence summary of what happened"},
+    "root_cause": {"type": "string", "description": "Most probable root cause"},
+    "category": {"type": "string", "enum": ["` + strings.Join(analysisCategories, `", "`) + `"]},
+    "risk_score": {"type": "integer", "minimum": 0, "maximum": 100, "description": "Operational risk, 100 is a line-down emergency"},
+    "recommended_actions": {"type": "array", "items": {"type": "string"}, "description": "Concrete next steps for the operator"},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1, "description": "Confidence in the root cause"}
+  }
+}`
+
+// structuredInstructions is appended to every single-log prompt, after any template, so
+// prompt overrides cannot break parsing
+var structuredInstructions = `
+
+Respond with only a JSON object matching this JSON schema, with no other text:
+` + analysisSchema
+
+// batchInstructions is appended to every batch prompt
+var batchInstructions = `
+
+Respond with only a JSON object with no other text. It must have a "batch_summary" string describing
+what the entries have in common, and an "entries" array holding, for every entry, an object with its
+"entry" number plus the fields of this JSON schema:
+` + analysisSchema
+
+// thinkBlock matches the reasoning preamble some models (e.g. deepseek-r1) emit before answering
+var thinkBlock = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// Validate checks that the analysis is complete and within range, normalizing the category
+func (a *StructuredAnalysis) Validate() error {
+	if strings.TrimSpace(a.Summary) == "" {
+		return fmt.Errorf("summary is empty")
+	}
+	if strings.TrimSpace(a.RootCause) == "" {
+		return fmt.Errorf("root_cause is empty")
+	}
+	a.Category = strings.ToLower(strings.TrimSpace(a.Category))
+	known := false
+	for _, c := range analysisCategories {
+		if a.Category == c {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("category %q is not one of %s", a.Category, strings.Join(analysisCategories, ", "))
+	}
+	if a.RiskScore < 0 || a.RiskScore > 100 {
+		return fmt.Errorf("risk_score %d is outside 0-100", a.RiskScore)
+	}
+	if a.Confidence < 0 || a.Confidence > 1 {
+		return fmt.Errorf("confidence %g is outside 0-1", a.Confidence)
+	}
+	if a.RecommendedActions == nil {
+		return fmt.Errorf("recommended_actions is missing")
+	}
+	return nil
+}
+
+// extractJSON pulls the outermost JSON object out of a model answer, skipping reasoning
+// blocks and markdown fences
+func extractJSON(text string) (string, error) {
+	text = thinkBlock.ReplaceAllString(text, "")
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("no JSON object in response")
+	}
+	return text[start : end+1], nil
+}
+
+// parseStructured decodes and validates a single-log answer
+func parseStructured(text string) (*StructuredAnalysis, error) {
+	raw, err := extractJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	var analysis StructuredAnalysis
+	if err := json.Unmarshal([]byte(raw), &analysis); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := analysis.Validate(); err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// batchAnalysis is the JSON answer to a batch prompt
+type batchAnalysis struct {
+	BatchSummary string `json:"batch_summary"`
+	Entries      []struct {
+		Entry int `json:"entry"`
+		StructuredAnalysis
+	} `json:"entries"`
+}
+
+// parseBatch decodes a batch answer into one validated analysis per entry
+func parseBatch(text string, n int) ([]*StructuredAnalysis, error) {
+	raw, err := extractJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	var batch batchAnalysis
+	if err := json.Unmarshal([]byte(raw), &batch); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	analyses := make([]*StructuredAnalysis, n)
+	for _, e := range batch.Entries {
+		if e.Entry < 1 || e.Entry > n {
+			return nil, fmt.Errorf("entry number %d is outside 1-%d", e.Entry, n)
+		}
+		analysis := e.StructuredAnalysis
+		if err := analysis.Validate(); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", e.Entry, err)
+		}
+		if batch.BatchSummary != "" {
+			analysis.Summary += " Batch: " + batch.BatchSummary
+		}
+		analyses[e.Entry-1] = &analysis
+	}
+	for i, a := range analyses {
+		if a == nil {
+			return nil, fmt.Errorf("entry %d is missing", i+1)
+		}
+	}
+	return analyses, nil
+}
+
+// analyzeStructured asks for a JSON answer and re-asks, quoting the validation error, until
+// parse accepts it or the retries run out. The last raw answer is returned either way so it
+// can still be stored as unstructured text.
+func (s *Service) analyzeStructured(ctx context.Context, instructions, prompt, format string, parse func(string) error) (*AnalysisResult, error) {
+	request := prompt + format
+
+	var result *AnalysisResult
+	for attempt := 0; attempt <= shared.StructuredRetries; attempt++ {
+		var err error
+		result, err = s.analyze(ctx, instructions, request)
+		if err != nil {
+			return nil, err
+		}
+
+		perr := parse(result.Content)
+		if perr == nil {
+			return result, nil
+		}
+		log.Printf("Malformed structured analysis from %s (attempt %d/%d): %v",
+			result.Provider, attempt+1, shared.StructuredRetries+1, perr)
+
+		request = fmt.Sprintf("%s%s\n\nYour previous answer was rejected: %v\nPrevious answer:\n%s\n\nAnswer again with only the corrected JSON object.",
+			prompt, format, perr, truncate(result.Content, 2000))
+	}
+
+	log.Printf("Storing unstructured analysis after %d malformed answers", shared.StructuredRetries+1)
+	return result, nil
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/tobalo/gogent/pkg/db"
+)
+
+// loadTemplates restores the mined templates stored by previous runs
+func (s *Service) loadTemplates() error {
+	templates, err := db.GetLogTemplates()
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		s.drain.Restore(&LogTemplate{
+			ID:            t.ID,
+			Service:       t.Service,
+			Tokens:        strings.Fields(t.Template),
+			Count:         t.Count,
+			AnalysisLogID: t.AnalysisLogID,
+		})
+	}
+	if len(templates) > 0 {
+		log.Printf("Restored %d log templates", len(templates))
+	}
+	return nil
+}
+
+// mineTemplate assigns the record's log to a template and persists the template. A redelivered
+// log was counted on its first delivery, so it only looks its template up.
+func (s *Service) mineTemplate(rec *record) {
+	found := false
+	if rec.redelivered {
+		rec.template, rec.templateParams, rec.templateStatus, found = s.drain.Lookup(rec.log.Service, rec.log.Message)
+	}
+	if !found {
+		rec.template, rec.templateParams, rec.templateStatus = s.drain.Match(rec.log.Service, rec.log.Message)
+		if err := db.SaveLogTemplate(rec.template.ID, rec.template.Service, rec.template.String(), rec.template.Count); err != nil {
+			log.Printf("Error saving log template: %v", err)
+		}
+	}
+
+	rec.sections = append(rec.sections, PromptSection{
+		Title: "Log Template",
+		Body: fmt.Sprintf("%s (%s template, seen %d times, parameters: %s)",
+			rec.template.String(), rec.templateStatus, rec.template.Count, strings.Join(rec.templateParams, ", ")),
+	})
+}
+
+// reuseTemplate fills rec from the analysis of an earlier log with the same template and reports
+// whether one was found. Only templates that did not change to admit the log are reused.
+func (s *Service) reuseTemplate(rec *record) bool {
+	if !s.config.TemplateReuse || rec.templateStatus != templateKnown {
+		return false
+	}
+	return s.reuseLog(rec, rec.template.AnalysisLogID, reusedTemplate)
+}
+
+// storeTemplateAnalysis makes a fresh structured analysis the one reused for its template
+func (s *Service) storeTemplateAnalysis(rec *record, logID int64) {
+	if rec.template.ID == 0 || rec.structured == nil {
+		return
+	}
+	s.drain.SetAnalysis(rec.template.ID, logID)
+	if err := db.SetTemplateAnalysis(rec.template.ID, logID); err != nil {
+		log.Printf("Error storing template analysis: %v", err)
+	}
+}
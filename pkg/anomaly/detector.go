@@ -0,0 +1,303 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Anomaly kinds
+const (
+	KindSpike     = "spike"      // Far more logs than the baseline in the current window
+	KindSilence   = "silence"    // No logs from a source that normally emits them
+	KindNewSource = "new_source" // First logs from a host, service and severity
+)
+
+// seasons is the number of seasonal slots, one per hour of the week
+const seasons = 7 * 24
+
+// Baseline smoothing factors per closed window
+const (
+	alpha         = 0.1 // Overall baseline, tracks roughly the last ten windows
+	seasonalAlpha = 0.3 // Hour-of-week baseline, tracks roughly the last three weeks
+)
+
+// Config holds the detection parameters
+type Config struct {
+	Window          time.Duration // Width of a counting window
+	Threshold       float64       // Standard deviations above the baseline that make a spike
+	MinCount        int           // Logs a window needs before it can be a spike
+	Warmup          int           // Closed windows a series needs before spikes and silences are reported
+	SilenceExpected float64       // Logs that must have been expected during a gap to report a silence
+}
+
+// Key identifies a log source
+type Key struct {
+	Hostname string
+	Service  string
+	Severity string
+}
+
+// Event is a detected anomaly
+type Event struct {
+	Kind        string    `json:"kind"`
+	Hostname    string    `json:"hostname"`
+	Service     string    `json:"service"`
+	Severity    string    `json:"severity"`
+	Count       int       `json:"count"`    // Logs in the window, or zero for a silence
+	Expected    float64   `json:"expected"` // Baseline logs per window
+	StdDev      float64   `json:"stddev"`
+	Score       float64   `json:"score"` // Standard deviations above the baseline for spikes
+	WindowStart time.Time `json:"window_start"`
+	Window      string    `json:"window"`
+	LastSeen    time.Time `json:"last_seen,omitempty"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// Describe renders the event as a sentence for prompts and logs
+func (e Event) Describe() string {
+	switch e.Kind {
+	case KindSpike:
+		return fmt.Sprintf("Spike in %s logs from %s on %s: %d in the current %s window against a baseline of %.1f ± %.1f (%.1f standard deviations above normal)",
+			e.Severity, e.Service, e.Hostname, e.Count, e.Window, e.Expected, e.StdDev, e.Score)
+	case KindSilence:
+		return fmt.Sprintf("Silence: no %s logs from %s on %s since %s, normally %.1f per %s window",
+			e.Severity, e.Service, e.Hostname, e.LastSeen.Format(time.RFC3339), e.Expected, e.Window)
+	default:
+		return fmt.Sprintf("New source: first %s logs from %s on %s", e.Severity, e.Service, e.Hostname)
+	}
+}
+
+// Season is the baseline of one hour-of-week slot
+type Season struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Samples  int     `json:"samples"`
+}
+
+// Baseline is the persistent state of one source's series
+type Baseline struct {
+	Key
+	Mean        float64
+	Variance    float64
+	Windows     int      // Closed windows folded into the baseline
+	Seasonal    []Season // One slot per hour of the week
+	WindowStart time.Time
+	Count       int // Logs in the open window
+	LastSeen    time.Time
+}
+
+// Observation is the state of a source after a log was counted
+type Observation struct {
+	Count    int     // Logs in the current window
+	Expected float64 // Baseline logs per window
+	StdDev   float64
+	Events   []Event // Anomalies raised by this log
+	Active   *Event  // Spike in progress in the current window, if any
+}
+
+// series tracks one source's log rate
+type series struct {
+	Baseline
+	spike  *Event // Spike reported for the open window
+	silent bool   // Silence reported and not yet broken
+}
+
+// Detector learns per-source log rates with exponentially weighted moving averages, overall and
+// per hour of the week, and reports spikes, silences and new sources
+type Detector struct {
+	mu      sync.Mutex
+	cfg     Config
+	series  map[Key]*series
+	started time.Time // When the detector first saw data, for new-source warmup
+}
+
+// New creates an empty detector
+func New(cfg Config) *Detector {
+	return &Detector{cfg: cfg, series: make(map[Key]*series)}
+}
+
+// Restore adds a previously saved baseline
+func (d *Detector) Restore(b Baseline) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(b.Seasonal) != seasons {
+		b.Seasonal = make([]Season, seasons)
+	}
+	d.series[b.Key] = &series{Baseline: b}
+	if d.started.IsZero() || b.WindowStart.Before(d.started) {
+		d.started = b.WindowStart
+	}
+}
+
+// Snapshot returns the baselines of every source for saving
+func (d *Detector) Snapshot() []Baseline {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	baselines := make([]Baseline, 0, len(d.series))
+	for _, s := range d.series {
+		b := s.Baseline
+		b.Seasonal = append([]Season(nil), s.Seasonal...)
+		baselines = append(baselines, b)
+	}
+	return baselines
+}
+
+// Observe counts a log from a source at time t
+func (d *Detector) Observe(key Key, t time.Time) Observation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var obs Observation
+	if d.started.IsZero() {
+		d.started = t
+	}
+
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{Baseline: Baseline{
+			Key:         key,
+			Seasonal:    make([]Season, seasons),
+			WindowStart: t.Truncate(d.cfg.Window),
+		}}
+		d.series[key] = s
+		// Sources appearing while the detector is still learning are not news
+		if t.Sub(d.started) >= time.Duration(d.cfg.Warmup)*d.cfg.Window {
+			obs.Events = append(obs.Events, d.event(KindNewSource, s, t))
+		}
+	}
+
+	d.roll(s, t)
+	s.Count++
+	s.LastSeen = t
+	s.silent = false
+
+	obs.Count = s.Count
+	obs.Expected, obs.StdDev = d.expected(s)
+
+	if s.spike == nil && s.Windows >= d.cfg.Warmup && s.Count >= d.cfg.MinCount {
+		if score := (float64(s.Count) - obs.Expected) / math.Max(obs.StdDev, 1); score >= d.cfg.Threshold {
+			e := d.event(KindSpike, s, t)
+			s.spike = &e
+			obs.Events = append(obs.Events, e)
+		}
+	}
+	if s.spike != nil {
+		active := *s.spike
+		active.Count = s.Count
+		obs.Active = &active
+	}
+	return obs
+}
+
+// Tick closes the windows that ended before now and reports sources that fell silent
+func (d *Detector) Tick(now time.Time) []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var events []Event
+	for _, s := range d.series {
+		d.roll(s, now)
+		if s.silent || s.Windows < d.cfg.Warmup || s.LastSeen.IsZero() {
+			continue
+		}
+		gap := now.Sub(s.LastSeen)
+		if gap < 2*d.cfg.Window {
+			continue
+		}
+		if s.Mean*float64(gap)/float64(d.cfg.Window) >= d.cfg.SilenceExpected {
+			s.silent = true
+			events = append(events, d.event(KindSilence, s, now))
+		}
+	}
+	return events
+}
+
+// roll closes every window of s that ended before t, folding the counts into the baselines.
+// Gaps longer than a week restart the window without replaying every empty window.
+func (d *Detector) roll(s *series, t time.Time) {
+	start := t.Truncate(d.cfg.Window)
+	if !start.After(s.WindowStart) {
+		return
+	}
+	if start.Sub(s.WindowStart) > 7*24*time.Hour {
+		d.fold(s, s.WindowStart, s.Count)
+		s.WindowStart, s.Count, s.spike = start, 0, nil
+		return
+	}
+	for s.WindowStart.Before(start) {
+		d.fold(s, s.WindowStart, s.Count)
+		s.WindowStart = s.WindowStart.Add(d.cfg.Window)
+		s.Count, s.spike = 0, nil
+	}
+}
+
+// fold adds a closed window's count to the overall and seasonal baselines
+func (d *Detector) fold(s *series, windowStart time.Time, count int) {
+	x := float64(count)
+	if s.Windows == 0 {
+		s.Mean = x
+	} else {
+		s.Mean, s.Variance = ewma(s.Mean, s.Variance, x, alpha)
+	}
+	s.Windows++
+
+	season := &s.Seasonal[slot(windowStart)]
+	if season.Samples == 0 {
+		season.Mean = x
+	} else {
+		season.Mean, season.Variance = ewma(season.Mean, season.Variance, x, seasonalAlpha)
+	}
+	season.Samples++
+}
+
+// expected returns the baseline for the open window, preferring the hour-of-week baseline
+// once that slot has a full week of windows behind it
+func (d *Detector) expected(s *series) (float64, float64) {
+	season := s.Seasonal[slot(s.WindowStart)]
+	if perHour := int(time.Hour / d.cfg.Window); perHour > 0 && season.Samples >= perHour {
+		return season.Mean, math.Sqrt(season.Variance)
+	}
+	return s.Mean, math.Sqrt(s.Variance)
+}
+
+// event builds an event for a series. The caller must hold d.mu.
+func (d *Detector) event(kind string, s *series, t time.Time) Event {
+	expected, stddev := d.expected(s)
+	e := Event{
+		Kind:        kind,
+		Hostname:    s.Hostname,
+		Service:     s.Service,
+		Severity:    s.Severity,
+		Count:       s.Count,
+		Expected:    expected,
+		StdDev:      stddev,
+		WindowStart: s.WindowStart,
+		Window:      d.cfg.Window.String(),
+		DetectedAt:  t,
+	}
+	switch kind {
+	case KindSpike:
+		e.Score = (float64(s.Count) - expected) / math.Max(stddev, 1)
+	case KindSilence:
+		e.Count = 0
+		e.Expected = s.Mean
+		e.LastSeen = s.LastSeen
+	}
+	return e
+}
+
+// ewma updates an exponentially weighted mean and variance with a new value
+func ewma(mean, variance, x, a float64) (float64, float64) {
+	diff := x - mean
+	incr := a * diff
+	return mean + incr, (1 - a) * (variance + diff*incr)
+}
+
+// slot returns the hour-of-week slot of t
+func slot(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
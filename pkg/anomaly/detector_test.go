@@ -0,0 +1,190 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// testConfig counts per minute and reports after five windows of history
+var testConfig = Config{Window: time.Minute, Threshold: 3, MinCount: 5, Warmup: 5, SilenceExpected: 3}
+
+// monday is the start of an hour-of-week slot
+var monday = time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)
+
+var key = Key{Hostname: "plc-01", Service: "conveyor", Severity: "ERROR"}
+
+// feed counts n logs from key in each of the given minutes after start
+func feed(d *Detector, start time.Time, counts []int) []Event {
+	var events []Event
+	for minute, n := range counts {
+		for i := 0; i < n; i++ {
+			at := start.Add(time.Duration(minute)*time.Minute + time.Duration(i)*time.Second)
+			events = append(events, d.Observe(key, at).Events...)
+		}
+	}
+	return events
+}
+
+func TestEWMA(t *testing.T) {
+	tests := []struct {
+		name           string
+		mean, variance float64
+		x, a           float64
+		wantMean       float64
+		wantVariance   float64
+	}{
+		{"steady", 10, 0, 10, 0.1, 10, 0},
+		{"rise", 10, 0, 20, 0.1, 11, 9},
+		{"fall", 10, 4, 0, 0.5, 5, 27},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, variance := ewma(tt.mean, tt.variance, tt.x, tt.a)
+			if math.Abs(mean-tt.wantMean) > 1e-9 || math.Abs(variance-tt.wantVariance) > 1e-9 {
+				t.Errorf("ewma() = %v, %v, want %v, %v", mean, variance, tt.wantMean, tt.wantVariance)
+			}
+		})
+	}
+}
+
+func TestObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int // Logs per minute
+		want   []string
+	}{
+		{"steady rate", []int{5, 5, 5, 5, 5, 5, 5}, nil},
+		{"spike after warmup", []int{5, 5, 5, 5, 5, 40}, []string{KindSpike}},
+		{"spike reported once per window", []int{5, 5, 5, 5, 5, 60, 60}, []string{KindSpike, KindSpike}},
+		{"no spike during warmup", []int{5, 5, 40}, nil},
+		{"no spike below the minimum count", []int{0, 0, 0, 0, 0, 4}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(testConfig)
+			events := feed(d, monday, tt.counts)
+			if len(events) != len(tt.want) {
+				t.Fatalf("events = %+v, want kinds %v", events, tt.want)
+			}
+			for i, e := range events {
+				if e.Kind != tt.want[i] {
+					t.Errorf("event %d kind = %s, want %s", i, e.Kind, tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("spike stays active for its window", func(t *testing.T) {
+		d := New(testConfig)
+		feed(d, monday, []int{5, 5, 5, 5, 5, 40})
+		obs := d.Observe(key, monday.Add(5*time.Minute+50*time.Second))
+		if obs.Active == nil || obs.Active.Count != 41 || obs.Count != 41 {
+			t.Errorf("Observe() = %+v", obs)
+		}
+		if obs := d.Observe(key, monday.Add(6*time.Minute)); obs.Active != nil {
+			t.Errorf("spike still active in the next window: %+v", obs.Active)
+		}
+	})
+}
+
+func TestNewSource(t *testing.T) {
+	d := New(testConfig)
+	other := Key{Hostname: "plc-02", Service: "conveyor", Severity: "ERROR"}
+
+	if obs := d.Observe(key, monday); len(obs.Events) != 0 {
+		t.Errorf("source during warmup reported: %+v", obs.Events)
+	}
+	obs := d.Observe(other, monday.Add(5*time.Minute))
+	if len(obs.Events) != 1 || obs.Events[0].Kind != KindNewSource || obs.Events[0].Hostname != "plc-02" {
+		t.Errorf("Observe() of a new source = %+v", obs.Events)
+	}
+	if obs := d.Observe(other, monday.Add(5*time.Minute+time.Second)); len(obs.Events) != 0 {
+		t.Errorf("known source reported again: %+v", obs.Events)
+	}
+}
+
+func TestTick(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int
+		after  time.Duration // Time since the last log when the detector ticks
+		want   int           // Silences reported
+	}{
+		{"busy source falls silent", []int{5, 5, 5, 5, 5, 5}, 3 * time.Minute, 1},
+		{"short gap", []int{5, 5, 5, 5, 5, 5}, 90 * time.Second, 0},
+		{"quiet source", []int{1, 0, 0, 1, 0, 0}, 3 * time.Minute, 0},
+		{"during warmup", []int{5, 5}, 3 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(testConfig)
+			feed(d, monday, tt.counts)
+			last := d.Snapshot()[0].LastSeen
+			events := d.Tick(last.Add(tt.after))
+			if len(events) != tt.want {
+				t.Fatalf("Tick() = %+v, want %d silences", events, tt.want)
+			}
+			for _, e := range events {
+				if e.Kind != KindSilence || !e.LastSeen.Equal(last) {
+					t.Errorf("Tick() event = %+v", e)
+				}
+			}
+			// A silence is reported once until the source logs again
+			if events := d.Tick(last.Add(tt.after + time.Minute)); tt.want > 0 && len(events) != 0 {
+				t.Errorf("silence reported again: %+v", events)
+			}
+		})
+	}
+}
+
+func TestSeasonalBaseline(t *testing.T) {
+	d := New(Config{Window: 30 * time.Minute, Threshold: 3, MinCount: 5, Warmup: 5, SilenceExpected: 3})
+
+	// Every Monday 08:00 is busy and every other hour quiet, for three weeks
+	start := monday.Add(-21 * 24 * time.Hour)
+	for at := start; at.Before(monday); at = at.Add(30 * time.Minute) {
+		n := 2
+		if slot(at) == slot(monday) {
+			n = 50
+		}
+		for i := 0; i < n; i++ {
+			d.Observe(key, at.Add(time.Duration(i)*time.Second))
+		}
+	}
+
+	// The busy hour is normal for its slot, though far above the overall baseline
+	var obs Observation
+	for i := 0; i < 50; i++ {
+		obs = d.Observe(key, monday.Add(time.Duration(i)*time.Second))
+		if len(obs.Events) > 0 {
+			t.Fatalf("busy hour reported: %+v", obs.Events)
+		}
+	}
+	if obs.Expected < 40 {
+		t.Errorf("expected = %.1f, want the Monday 08:00 baseline", obs.Expected)
+	}
+
+	// The same volume in a quiet hour is a spike
+	quiet := monday.Add(2 * time.Hour)
+	var events []Event
+	for i := 0; i < 50; i++ {
+		events = append(events, d.Observe(key, quiet.Add(time.Duration(i)*time.Second)).Events...)
+	}
+	if len(events) != 1 || events[0].Kind != KindSpike {
+		t.Errorf("quiet hour events = %+v", events)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	d := New(testConfig)
+	feed(d, monday, []int{5, 5, 5, 5, 5, 5})
+
+	restored := New(testConfig)
+	for _, b := range d.Snapshot() {
+		restored.Restore(b)
+	}
+	if events := feed(restored, monday.Add(6*time.Minute), []int{40}); len(events) != 1 || events[0].Kind != KindSpike {
+		t.Errorf("restored detector events = %+v", events)
+	}
+}
@@ -0,0 +1,244 @@
+package cluster
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Config holds the clustering parameters
+type Config struct {
+	Bands     int     // LSH bands; more bands find less similar candidates
+	Rows      int     // Signature values per band; more rows demand more similar candidates
+	Threshold float64 // Minimum TF-IDF cosine similarity to join a cluster
+	Window    int     // Documents remembered by the rolling vocabulary
+	Limit     int     // Clusters kept; beyond it the least recently joined is forgotten, none when zero
+}
+
+// Document is a log message to cluster
+type Document struct {
+	Service string
+	Host    string
+	Message string
+}
+
+// Cluster is a group of near-duplicate messages from one service
+type Cluster struct {
+	ID                  int64
+	Service             string
+	Representative      string // Message that founded the cluster
+	Members             int64
+	Hosts               int
+	RepresentativeLogID int64 // Log whose analysis stands for the cluster, zero if none
+}
+
+// Assignment is the cluster a document joined
+type Assignment struct {
+	Cluster
+	New        bool    // Document founded the cluster
+	NewHost    bool    // Document is the first from its host in the cluster
+	Similarity float64 // TF-IDF cosine similarity to the representative
+}
+
+// clusterState is a cluster with the data needed to match documents against it
+type clusterState struct {
+	Cluster
+	terms   []string // Representative terms, re-weighted on every match as the vocabulary rolls
+	hosts   map[string]bool
+	buckets []bucketKey   // LSH buckets the cluster is indexed in
+	elem    *list.Element // Position in the least recently joined order
+}
+
+// bucketKey is an LSH bucket, kept separate per service
+type bucketKey struct {
+	service string
+	band    uint64
+}
+
+// Clusterer assigns messages to clusters of near-duplicates. Candidates are found by MinHash
+// LSH over the message terms and confirmed by TF-IDF cosine similarity to the cluster
+// representative, so rare, informative words decide membership rather than boilerplate.
+type Clusterer struct {
+	mu       sync.Mutex
+	cfg      Config
+	vocab    *Vocabulary
+	hasher   *MinHasher
+	clusters map[int64]*clusterState
+	buckets  map[bucketKey][]int64
+	lru      *list.List // Cluster IDs, most recently joined first
+	nextID   int64
+}
+
+// New creates an empty clusterer
+func New(cfg Config) *Clusterer {
+	return &Clusterer{
+		cfg:      cfg,
+		vocab:    NewVocabulary(cfg.Window),
+		hasher:   NewMinHasher(cfg.Bands * cfg.Rows),
+		clusters: make(map[int64]*clusterState),
+		buckets:  make(map[bucketKey][]int64),
+		lru:      list.New(),
+		nextID:   1,
+	}
+}
+
+// Restore adds a previously built cluster and the hosts seen in it, as the most recently joined
+func (c *Clusterer) Restore(cl Cluster, hosts []string) {
+	terms := distinctTerms(Tokenize(cl.Representative))
+	c.vocab.Add(terms)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := &clusterState{Cluster: cl, terms: terms, hosts: make(map[string]bool)}
+	for _, h := range hosts {
+		state.hosts[h] = true
+	}
+	state.Hosts = len(state.hosts)
+	c.add(state)
+	if cl.ID >= c.nextID {
+		c.nextID = cl.ID + 1
+	}
+}
+
+// Assign places a document in the most similar cluster of its service, founding a new cluster
+// if none is similar enough. Documents without any word terms are not clustered and get a
+// zero Assignment.
+func (c *Clusterer) Assign(doc Document) Assignment {
+	terms := Tokenize(doc.Message)
+	if len(terms) == 0 {
+		return Assignment{}
+	}
+	c.vocab.Add(terms)
+	distinct := distinctTerms(terms)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	best, bestSim := c.nearest(doc.Service, terms, distinct)
+	isNew := false
+	if best == nil || bestSim < c.cfg.Threshold {
+		best = &clusterState{
+			Cluster: Cluster{ID: c.nextID, Service: doc.Service, Representative: doc.Message},
+			terms:   distinct,
+			hosts:   make(map[string]bool),
+		}
+		c.nextID++
+		c.add(best)
+		bestSim, isNew = 1, true
+	} else {
+		c.lru.MoveToFront(best.elem)
+	}
+
+	best.Members++
+	newHost := !best.hosts[doc.Host]
+	if newHost {
+		best.hosts[doc.Host] = true
+		best.Hosts = len(best.hosts)
+	}
+
+	return Assignment{Cluster: best.Cluster, New: isNew, NewHost: newHost, Similarity: bestSim}
+}
+
+// Lookup finds the cluster a document already joined, for documents Assign has seen before. It
+// neither counts the document nor updates the vocabulary, and reports false when no cluster is
+// similar enough.
+func (c *Clusterer) Lookup(doc Document) (Assignment, bool) {
+	terms := Tokenize(doc.Message)
+	if len(terms) == 0 {
+		return Assignment{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	best, bestSim := c.nearest(doc.Service, terms, distinctTerms(terms))
+	if best == nil || bestSim < c.cfg.Threshold {
+		return Assignment{}, false
+	}
+	// The founder of a cluster nothing else has joined yet is reported as founding it again
+	isNew := best.Members == 1 && best.Representative == doc.Message
+	return Assignment{Cluster: best.Cluster, New: isNew, Similarity: bestSim}, true
+}
+
+// nearest returns the LSH candidate cluster of a service most similar to a document's terms,
+// or nil if there is none. The caller must hold c.mu.
+func (c *Clusterer) nearest(service string, terms, distinct []string) (*clusterState, float64) {
+	vector := c.vocab.Vectorize(terms)
+	var best *clusterState
+	bestSim := -1.0
+	seen := make(map[int64]bool)
+	for _, key := range bandKeys(c.hasher.Signature(distinct), c.cfg.Rows) {
+		for _, id := range c.buckets[bucketKey{service, key}] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			candidate := c.clusters[id]
+			if sim := Cosine(vector, c.vocab.Vectorize(candidate.terms)); sim > bestSim {
+				best, bestSim = candidate, sim
+			}
+		}
+	}
+	return best, bestSim
+}
+
+// SetRepresentativeLog records the log whose analysis stands for a cluster
+func (c *Clusterer) SetRepresentativeLog(id, logID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state, ok := c.clusters[id]; ok {
+		state.RepresentativeLogID = logID
+	}
+}
+
+// ClearRepresentativeLog stops reusing a cluster's analysis if it is the one of logID, or
+// whatever it is when logID is zero, and reports whether it did
+func (c *Clusterer) ClearRepresentativeLog(id, logID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.clusters[id]
+	if !ok || state.RepresentativeLogID == 0 || (logID != 0 && state.RepresentativeLogID != logID) {
+		return false
+	}
+	state.RepresentativeLogID = 0
+	return true
+}
+
+// add indexes a cluster in the LSH buckets of its representative as the most recently joined,
+// then forgets the least recently joined clusters over the limit. The caller must hold c.mu.
+func (c *Clusterer) add(state *clusterState) {
+	c.clusters[state.ID] = state
+	state.buckets = nil
+	for _, key := range bandKeys(c.hasher.Signature(state.terms), c.cfg.Rows) {
+		bk := bucketKey{state.Service, key}
+		c.buckets[bk] = append(c.buckets[bk], state.ID)
+		state.buckets = append(state.buckets, bk)
+	}
+	state.elem = c.lru.PushFront(state.ID)
+
+	for c.cfg.Limit > 0 && c.lru.Len() > c.cfg.Limit {
+		c.evict(c.lru.Back().Value.(int64))
+	}
+}
+
+// evict forgets a cluster and drops it from its LSH buckets. The caller must hold c.mu.
+func (c *Clusterer) evict(id int64) {
+	state := c.clusters[id]
+	delete(c.clusters, id)
+	c.lru.Remove(state.elem)
+
+	for _, bk := range state.buckets {
+		ids := c.buckets[bk]
+		for i, other := range ids {
+			if other == id {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(c.buckets, bk)
+		} else {
+			c.buckets[bk] = ids
+		}
+	}
+}
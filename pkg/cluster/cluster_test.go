@@ -0,0 +1,175 @@
+package cluster
+
+import "testing"
+
+// testConfig is the default clustering configuration
+var testConfig = Config{Bands: 16, Rows: 4, Threshold: 0.8, Window: 10000}
+
+func TestAssign(t *testing.T) {
+	type step struct {
+		doc     Document
+		id      int64
+		isNew   bool
+		newHost bool
+		members int64
+		hosts   int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "near duplicates join the founder",
+			steps: []step{
+				{Document{"historian", "plc-01", "No space left on device writing /var/lib/historian/segment.dat"}, 1, true, true, 1, 1},
+				{Document{"historian", "plc-02", "No space left on device writing /var/lib/historian/segment.dat"}, 1, false, true, 2, 2},
+				{Document{"historian", "plc-02", "No space left on device writing /var/lib/historian/segment.dat"}, 1, false, false, 3, 2},
+			},
+		},
+		{
+			name: "numbers do not split clusters",
+			steps: []step{
+				{Document{"conveyor", "plc-01", "Belt 3 stopped after 120 seconds of overload"}, 1, true, true, 1, 1},
+				{Document{"conveyor", "plc-01", "Belt 7 stopped after 45 seconds of overload"}, 1, false, false, 2, 1},
+			},
+		},
+		{
+			name: "different events found new clusters",
+			steps: []step{
+				{Document{"conveyor", "plc-01", "Belt stopped after overload"}, 1, true, true, 1, 1},
+				{Document{"conveyor", "plc-01", "Temperature sensor reading out of range"}, 2, true, true, 1, 1},
+			},
+		},
+		{
+			name: "services cluster separately",
+			steps: []step{
+				{Document{"conveyor", "plc-01", "Connection refused by upstream"}, 1, true, true, 1, 1},
+				{Document{"historian", "plc-01", "Connection refused by upstream"}, 2, true, true, 1, 1},
+			},
+		},
+		{
+			name: "documents without terms are not clustered",
+			steps: []step{
+				{Document{"conveyor", "plc-01", "42 17 0x1f"}, 0, false, false, 0, 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(testConfig)
+			for i, s := range tt.steps {
+				got := c.Assign(s.doc)
+				if got.ID != s.id || got.New != s.isNew || got.NewHost != s.newHost || got.Members != s.members || got.Hosts != s.hosts {
+					t.Errorf("step %d: Assign() = %+v", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c := New(testConfig)
+	founder := Document{"historian", "plc-01", "No space left on device writing segment"}
+	c.Assign(founder)
+
+	tests := []struct {
+		name  string
+		doc   Document
+		found bool
+		isNew bool
+	}{
+		{"founder", founder, true, true},
+		{"member", Document{"historian", "plc-09", "No space left on device writing segment 12"}, true, false},
+		{"other service", Document{"conveyor", "plc-01", "No space left on device writing segment"}, false, false},
+		{"unrelated", Document{"historian", "plc-01", "Replication lag above threshold"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := c.Lookup(tt.doc)
+			if found != tt.found || got.New != tt.isNew {
+				t.Errorf("Lookup() = %+v, %v", got, found)
+			}
+		})
+	}
+
+	// Lookup does not count the document
+	if got, _ := c.Lookup(founder); got.Members != 1 {
+		t.Errorf("members after lookups = %d", got.Members)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	c := New(testConfig)
+	c.Restore(Cluster{ID: 5, Service: "historian", Representative: "Replication lag above threshold", Members: 9, RepresentativeLogID: 40},
+		[]string{"db-01", "db-02"})
+
+	got := c.Assign(Document{"historian", "db-02", "Replication lag above threshold"})
+	if got.ID != 5 || got.New || got.NewHost || got.Members != 10 || got.Hosts != 2 || got.RepresentativeLogID != 40 {
+		t.Errorf("Assign() after Restore = %+v", got)
+	}
+	if got := c.Assign(Document{"historian", "db-01", "Checkpoint completed"}); got.ID != 6 {
+		t.Errorf("new cluster ID = %d, want 6", got.ID)
+	}
+
+	c.SetRepresentativeLog(5, 42)
+	if got := c.Assign(Document{"historian", "db-03", "Replication lag above threshold"}); got.RepresentativeLogID != 42 || !got.NewHost {
+		t.Errorf("Assign() after SetRepresentativeLog = %+v", got)
+	}
+	if c.ClearRepresentativeLog(5, 40) {
+		t.Error("ClearRepresentativeLog() cleared another log's analysis")
+	}
+	if !c.ClearRepresentativeLog(5, 0) {
+		t.Error("ClearRepresentativeLog() kept the cluster's analysis")
+	}
+	if got := c.Assign(Document{"historian", "db-03", "Replication lag above threshold"}); got.RepresentativeLogID != 0 {
+		t.Errorf("RepresentativeLogID = %d after ClearRepresentativeLog", got.RepresentativeLogID)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	cfg := testConfig
+	cfg.Limit = 2
+	c := New(cfg)
+	c.Restore(Cluster{ID: 1, Service: "historian", Representative: "Replication lag above threshold", Members: 3}, nil)
+	c.Restore(Cluster{ID: 2, Service: "historian", Representative: "Checkpoint completed in segment", Members: 5, RepresentativeLogID: 7}, nil)
+
+	// Joining the older cluster makes the newer one the least recently joined
+	if got := c.Assign(Document{"historian", "db-01", "Replication lag above threshold"}); got.ID != 1 {
+		t.Fatalf("Assign() = cluster %d, want 1", got.ID)
+	}
+	if got := c.Assign(Document{"conveyor", "plc-01", "Belt motor overcurrent tripped"}); got.ID != 3 || !got.New {
+		t.Fatalf("Assign() = %+v, want new cluster 3", got)
+	}
+
+	tests := []struct {
+		doc   Document
+		id    int64
+		found bool
+	}{
+		{Document{"historian", "db-01", "Replication lag above threshold"}, 1, true},
+		{Document{"conveyor", "plc-01", "Belt motor overcurrent tripped"}, 3, true},
+		{Document{"historian", "db-01", "Checkpoint completed in segment"}, 0, false},
+	}
+	for _, tt := range tests {
+		got, found := c.Lookup(tt.doc)
+		if found != tt.found || got.ID != tt.id {
+			t.Errorf("Lookup(%q) = cluster %d, %v, want %d, %v", tt.doc.Message, got.ID, found, tt.id, tt.found)
+		}
+	}
+	for key, ids := range c.buckets {
+		for _, id := range ids {
+			if id == 2 {
+				t.Fatalf("bucket %v still holds the forgotten cluster", key)
+			}
+		}
+	}
+	if c.ClearRepresentativeLog(2, 0) {
+		t.Error("ClearRepresentativeLog() found the forgotten cluster")
+	}
+
+	// A forgotten cluster's documents found a new one
+	if got := c.Assign(Document{"historian", "db-01", "Checkpoint completed in segment"}); got.ID != 4 || !got.New {
+		t.Errorf("Assign() = %+v, want new cluster 4", got)
+	}
+}
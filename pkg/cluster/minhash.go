@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// MinHasher computes MinHash signatures of term sets, whose agreement estimates the sets'
+// Jaccard similarity
+type MinHasher struct {
+	seeds []uint64
+}
+
+// NewMinHasher creates a hasher producing signatures of n values
+func NewMinHasher(n int) *MinHasher {
+	seeds := make([]uint64, n)
+	// Deterministic seeds keep signatures comparable across restarts
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		seeds[i] = x
+	}
+	return &MinHasher{seeds: seeds}
+}
+
+// Signature returns the MinHash signature of a set of terms. Documents without terms all
+// share the maximal signature.
+func (m *MinHasher) Signature(terms []string) []uint64 {
+	sig := make([]uint64, len(m.seeds))
+	for i := range sig {
+		sig[i] = math.MaxUint64
+	}
+	for _, t := range terms {
+		h := fnv.New64a()
+		h.Write([]byte(t))
+		base := h.Sum64()
+		for i, seed := range m.seeds {
+			if v := mix(base ^ seed); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// mix is the splitmix64 finalizer, turning one term hash into independent per-seed hashes
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// bandKeys splits a signature into bands of rows values and hashes each band, so documents
+// sharing any band key are likely similar
+func bandKeys(sig []uint64, rows int) []uint64 {
+	var keys []uint64
+	buf := make([]byte, 8)
+	for start, band := 0, 0; start+rows <= len(sig); start, band = start+rows, band+1 {
+		h := fnv.New64a()
+		binary.LittleEndian.PutUint64(buf, uint64(band))
+		h.Write(buf)
+		for _, v := range sig[start : start+rows] {
+			binary.LittleEndian.PutUint64(buf, v)
+			h.Write(buf)
+		}
+		keys = append(keys, h.Sum64())
+	}
+	return keys
+}
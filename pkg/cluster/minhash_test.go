@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	m := NewMinHasher(256)
+	tests := []struct {
+		name    string
+		a, b    []string
+		jaccard float64 // Share of distinct terms the sets have in common
+	}{
+		{"identical", []string{"disk", "full", "var"}, []string{"var", "disk", "full", "disk"}, 1},
+		{"disjoint", []string{"disk", "full"}, []string{"fan", "stalled"}, 0},
+		{"half", []string{"disk", "full", "on", "var"}, []string{"disk", "full", "on", "tmp", "mount", "point"}, 3.0 / 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa, sb := m.Signature(tt.a), m.Signature(tt.b)
+			same := 0
+			for i := range sa {
+				if sa[i] == sb[i] {
+					same++
+				}
+			}
+			if got := float64(same) / float64(len(sa)); math.Abs(got-tt.jaccard) > 0.1 {
+				t.Errorf("signature agreement = %.2f, want about %.2f", got, tt.jaccard)
+			}
+		})
+	}
+
+	// Signatures are deterministic across hashers, so stored clusters survive restarts
+	if a, b := NewMinHasher(8).Signature([]string{"disk"}), NewMinHasher(8).Signature([]string{"disk"}); a[7] != b[7] {
+		t.Error("signatures differ between hashers")
+	}
+}
+
+func TestBandKeys(t *testing.T) {
+	sig := []uint64{1, 2, 3, 4, 5, 6, 7}
+	keys := bandKeys(sig, 3)
+	if len(keys) != 2 {
+		t.Fatalf("bandKeys() returned %d keys, want 2 full bands", len(keys))
+	}
+
+	tests := []struct {
+		name  string
+		other []uint64
+		same  []bool // Whether each band key matches sig's
+	}{
+		{"identical", []uint64{1, 2, 3, 4, 5, 6, 8}, []bool{true, true}},
+		{"first band differs", []uint64{1, 2, 9, 4, 5, 6}, []bool{false, true}},
+		{"bands swapped", []uint64{4, 5, 6, 1, 2, 3}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := bandKeys(tt.other, 3)
+			for i, want := range tt.same {
+				if got := other[i] == keys[i]; got != want {
+					t.Errorf("band %d matches = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Vector is a sparse TF-IDF vector keyed by term
+type Vector map[string]float64
+
+// Tokenize splits a message into lowercase word terms, dropping terms that carry digits since
+// counters, IDs and addresses say nothing about what kind of event a log describes
+func Tokenize(message string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(message), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if strings.IndexFunc(f, unicode.IsDigit) >= 0 {
+			continue
+		}
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// Vocabulary tracks document frequencies over a rolling window of the most recent documents,
+// so term weights follow the log stream as services come and go
+type Vocabulary struct {
+	mu     sync.Mutex
+	window [][]string // Distinct terms of each document in the window, oldest first
+	size   int
+	df     map[string]int
+}
+
+// NewVocabulary creates a vocabulary remembering the last size documents
+func NewVocabulary(size int) *Vocabulary {
+	return &Vocabulary{size: size, df: make(map[string]int)}
+}
+
+// Add counts a document's terms, evicting the oldest document once the window is full
+func (v *Vocabulary) Add(terms []string) {
+	distinct := distinctTerms(terms)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.window) >= v.size {
+		for _, t := range v.window[0] {
+			if v.df[t]--; v.df[t] <= 0 {
+				delete(v.df, t)
+			}
+		}
+		v.window = v.window[1:]
+	}
+	v.window = append(v.window, distinct)
+	for _, t := range distinct {
+		v.df[t]++
+	}
+}
+
+// Vectorize weights a document's terms by term frequency and smoothed inverse document
+// frequency, normalized to unit length
+func (v *Vocabulary) Vectorize(terms []string) Vector {
+	tf := make(map[string]float64)
+	for _, t := range terms {
+		tf[t]++
+	}
+
+	v.mu.Lock()
+	n := float64(len(v.window))
+	vec := make(Vector, len(tf))
+	for t, f := range tf {
+		vec[t] = f * (math.Log((1+n)/(1+float64(v.df[t]))) + 1)
+	}
+	v.mu.Unlock()
+
+	var norm float64
+	for _, w := range vec {
+		norm += w * w
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for t := range vec {
+			vec[t] /= norm
+		}
+	}
+	return vec
+}
+
+// Cosine returns the cosine similarity of two unit vectors
+func Cosine(a, b Vector) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var dot float64
+	for t, w := range a {
+		dot += w * b[t]
+	}
+	return dot
+}
+
+// distinctTerms returns each term once, in first-seen order
+func distinctTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var distinct []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			distinct = append(distinct, t)
+		}
+	}
+	return distinct
+}
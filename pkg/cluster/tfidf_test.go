@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"Disk /var is FULL", []string{"disk", "var", "is", "full"}},
+		{"user_id=42 login failed from 10.0.0.5", []string{"user_id", "login", "failed", "from"}},
+		{"worker-7 restarted after 3 attempts", []string{"worker", "restarted", "after", "attempts"}},
+		{"node7 restarted", []string{"restarted"}},
+		{"Température élevée", []string{"température", "élevée"}},
+		{"1234 0xdeadbeef", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := Tokenize(tt.message); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVocabulary(t *testing.T) {
+	v := NewVocabulary(3)
+	v.Add([]string{"disk", "full"})
+	v.Add([]string{"disk", "ok", "disk"})
+	v.Add([]string{"disk", "slow"})
+
+	// idf(t) = ln((1+n)/(1+df(t))) + 1 over the n = 3 documents in the window
+	idf := func(df float64) float64 { return math.Log(4/(1+df)) + 1 }
+	tests := []struct {
+		name  string
+		terms []string
+		want  Vector
+	}{
+		{"common term", []string{"disk"}, Vector{"disk": 1}},
+		{"rare term outweighs common term", []string{"disk", "full"}, unit(Vector{"disk": idf(3), "full": idf(1)})},
+		{"term frequency", []string{"full", "full", "slow"}, unit(Vector{"full": 2 * idf(1), "slow": idf(1)})},
+		{"unseen term", []string{"fire"}, Vector{"fire": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v.Vectorize(tt.terms)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Vectorize(%q) = %v, want %v", tt.terms, got, tt.want)
+			}
+			for term, w := range tt.want {
+				if math.Abs(got[term]-w) > 1e-9 {
+					t.Errorf("Vectorize(%q)[%s] = %v, want %v", tt.terms, term, got[term], w)
+				}
+			}
+		})
+	}
+
+	// The oldest document leaves the window
+	v.Add([]string{"fan", "slow"})
+	if v.df["full"] != 0 || v.df["disk"] != 2 || v.df["slow"] != 2 {
+		t.Errorf("document frequencies after eviction = %v", v.df)
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Vector
+		want float64
+	}{
+		{"identical", Vector{"disk": 0.6, "full": 0.8}, Vector{"disk": 0.6, "full": 0.8}, 1},
+		{"disjoint", Vector{"disk": 1}, Vector{"fan": 1}, 0},
+		{"partial", Vector{"disk": 0.6, "full": 0.8}, Vector{"disk": 1}, 0.6},
+		{"empty", Vector{}, Vector{"disk": 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cosine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// unit scales a vector to unit length
+func unit(v Vector) Vector {
+	var norm float64
+	for _, w := range v {
+		norm += w * w
+	}
+	for t := range v {
+		v[t] /= math.Sqrt(norm)
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// createBaselinesTableSQL holds the learned log rate of every host, service and severity
+const createBaselinesTableSQL = `
+CREATE TABLE IF NOT EXISTS anomaly_baselines (
+	hostname TEXT NOT NULL,
+	service TEXT NOT NULL,
+	severity TEXT NOT NULL,
+	mean REAL NOT NULL,
+	variance REAL NOT NULL,
+	windows INTEGER NOT NULL,
+	seasonal TEXT,
+	window_start DATETIME NOT NULL,
+	count INTEGER NOT NULL,
+	last_seen DATETIME NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (hostname, service, severity)
+);`
+
+// AnomalyBaseline represents the learned log rate of one source
+type AnomalyBaseline struct {
+	Hostname    string
+	Service     string
+	Severity    string
+	Mean        float64 // Logs per window
+	Variance    float64
+	Windows     int
+	Seasonal    string // JSON array of per hour-of-week baselines
+	WindowStart time.Time
+	Count       int // Logs in the open window
+	LastSeen    time.Time
+}
+
+// GetAnomalyBaselines returns every stored baseline
+func GetAnomalyBaselines() ([]AnomalyBaseline, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT hostname, service, severity, mean, variance, windows, COALESCE(seasonal, ''), window_start, count, last_seen
+	FROM anomaly_baselines`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomaly baselines: %v", err)
+	}
+	defer rows.Close()
+
+	var baselines []AnomalyBaseline
+	for rows.Next() {
+		var b AnomalyBaseline
+		if err := rows.Scan(&b.Hostname, &b.Service, &b.Severity, &b.Mean, &b.Variance, &b.Windows,
+			&b.Seasonal, &b.WindowStart, &b.Count, &b.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly baseline: %v", err)
+		}
+		baselines = append(baselines, b)
+	}
+	return baselines, rows.Err()
+}
+
+// SaveAnomalyBaselines replaces the stored baselines of the given sources in one transaction
+func SaveAnomalyBaselines(baselines []AnomalyBaseline) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	tx, err := instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	stmt, err := tx.Prepare(`
+	INSERT OR REPLACE INTO anomaly_baselines (hostname, service, severity, mean, variance, windows, seasonal,
+		window_start, count, last_seen, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to prepare baseline insert: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, b := range baselines {
+		_, err := stmt.Exec(b.Hostname, b.Service, b.Severity, b.Mean, b.Variance, b.Windows, b.Seasonal,
+			b.WindowStart, b.Count, b.LastSeen)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to save anomaly baseline: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit anomaly baselines: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// createCacheTableSQL holds recent analyses keyed by normalized log fingerprint
+const createCacheTableSQL = `
+CREATE TABLE IF NOT EXISTS analysis_cache (
+	fingerprint TEXT PRIMARY KEY,
+	analysis TEXT NOT NULL,
+	provider TEXT,
+	summary TEXT,
+	root_cause TEXT,
+	category TEXT,
+	risk_score INTEGER,
+	recommended_actions TEXT,
+	confidence REAL,
+	hits INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_hit_at DATETIME
+);`
+
+// CachedAnalysis is an analysis that can be reused for logs with the same fingerprint
+type CachedAnalysis struct {
+	Fingerprint        string
+	Analysis           string
+	Provider           string
+	Summary            string
+	RootCause          string
+	Category           string
+	RiskScore          int
+	RecommendedActions string // JSON array of recommended actions
+	Confidence         float64
+	Hits               int
+}
+
+// GetCachedAnalysis returns the analysis cached for a fingerprint if it is younger than ttl,
+// or nil when there is none
+func GetCachedAnalysis(fingerprint string, ttl time.Duration) (*CachedAnalysis, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	query := `
+	SELECT fingerprint, analysis, COALESCE(provider, ''), COALESCE(summary, ''), COALESCE(root_cause, ''),
+		COALESCE(category, ''), COALESCE(risk_score, 0), COALESCE(recommended_actions, ''),
+		COALESCE(confidence, 0), hits
+	FROM analysis_cache
+	WHERE fingerprint = ? AND created_at >= datetime('now', ?)`
+
+	var c CachedAnalysis
+	err := instance.QueryRow(query, fingerprint, fmt.Sprintf("-%d seconds", int(ttl.Seconds()))).Scan(
+		&c.Fingerprint,
+		&c.Analysis,
+		&c.Provider,
+		&c.Summary,
+		&c.RootCause,
+		&c.Category,
+		&c.RiskScore,
+		&c.RecommendedActions,
+		&c.Confidence,
+		&c.Hits,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query analysis cache: %v", err)
+	}
+	return &c, nil
+}
+
+// RecordCacheHit counts a reuse of a cached analysis and returns the new hit count
+func RecordCacheHit(fingerprint string) (int, error) {
+	if instance == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	var hits int
+	err := instance.QueryRow(`
+	UPDATE analysis_cache SET hits = hits + 1, last_hit_at = CURRENT_TIMESTAMP
+	WHERE fingerprint = ?
+	RETURNING hits`, fingerprint).Scan(&hits)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record cache hit: %v", err)
+	}
+	return hits, nil
+}
+
+// PutCachedAnalysis caches an analysis, replacing any previous one for the fingerprint
+func PutCachedAnalysis(c CachedAnalysis) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	query := `
+	INSERT INTO analysis_cache (fingerprint, analysis, provider, summary, root_cause, category,
+		risk_score, recommended_actions, confidence)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(fingerprint) DO UPDATE SET
+		analysis = excluded.analysis,
+		provider = excluded.provider,
+		summary = excluded.summary,
+		root_cause = excluded.root_cause,
+		category = excluded.category,
+		risk_score = excluded.risk_score,
+		recommended_actions = excluded.recommended_actions,
+		confidence = excluded.confidence,
+		hits = 0,
+		created_at = CURRENT_TIMESTAMP,
+		last_hit_at = NULL`
+
+	_, err := instance.Exec(query,
+		c.Fingerprint,
+		c.Analysis,
+		c.Provider,
+		c.Summary,
+		c.RootCause,
+		c.Category,
+		c.RiskScore,
+		c.RecommendedActions,
+		c.Confidence,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cache analysis: %v", err)
+	}
+	return nil
+}
+
+// DeleteCachedAnalysis removes the cached analysis of a fingerprint and reports whether there
+// was one
+func DeleteCachedAnalysis(fingerprint string) (bool, error) {
+	if instance == nil {
+		return false, fmt.Errorf("database not initialized")
+	}
+
+	result, err := instance.Exec(`DELETE FROM analysis_cache WHERE fingerprint = ?`, fingerprint)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete cached analysis: %v", err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,122 @@
+package db
+
+import "fmt"
+
+// createClustersTableSQL holds the clusters of near-duplicate messages and the hosts seen in them
+const createClustersTableSQL = `
+CREATE TABLE IF NOT EXISTS log_clusters (
+	id INTEGER PRIMARY KEY,
+	service TEXT NOT NULL,
+	representative TEXT NOT NULL,
+	members INTEGER NOT NULL DEFAULT 0,
+	representative_log_id INTEGER,
+	first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS cluster_hosts (
+	cluster_id INTEGER NOT NULL,
+	hostname TEXT NOT NULL,
+	first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (cluster_id, hostname)
+);`
+
+// LogCluster represents a cluster of near-duplicate log messages
+type LogCluster struct {
+	ID                  int64
+	Service             string
+	Representative      string // Message that founded the cluster
+	Members             int64
+	RepresentativeLogID int64 // agent_logs row whose analysis stands for the cluster, zero if none
+	Hosts               []string
+	FirstSeen           string
+	LastSeen            string
+}
+
+// GetLogClusters returns every stored cluster with its hosts, least recently seen first
+func GetLogClusters() ([]LogCluster, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT id, service, representative, members, COALESCE(representative_log_id, 0), first_seen, last_seen
+	FROM log_clusters
+	ORDER BY last_seen, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log clusters: %v", err)
+	}
+	defer rows.Close()
+
+	var clusters []LogCluster
+	index := make(map[int64]int)
+	for rows.Next() {
+		var c LogCluster
+		if err := rows.Scan(&c.ID, &c.Service, &c.Representative, &c.Members, &c.RepresentativeLogID, &c.FirstSeen, &c.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan log cluster: %v", err)
+		}
+		index[c.ID] = len(clusters)
+		clusters = append(clusters, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query log clusters: %v", err)
+	}
+
+	hostRows, err := instance.Query(`SELECT cluster_id, hostname FROM cluster_hosts`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cluster hosts: %v", err)
+	}
+	defer hostRows.Close()
+
+	for hostRows.Next() {
+		var id int64
+		var host string
+		if err := hostRows.Scan(&id, &host); err != nil {
+			return nil, fmt.Errorf("failed to scan cluster host: %v", err)
+		}
+		if i, ok := index[id]; ok {
+			clusters[i].Hosts = append(clusters[i].Hosts, host)
+		}
+	}
+	return clusters, hostRows.Err()
+}
+
+// SaveLogCluster creates or updates a cluster, marking it as seen now
+func SaveLogCluster(id int64, service, representative string, members int64) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := instance.Exec(`
+	INSERT INTO log_clusters (id, service, representative, members) VALUES (?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		members = excluded.members,
+		last_seen = CURRENT_TIMESTAMP`, id, service, representative, members)
+	if err != nil {
+		return fmt.Errorf("failed to save log cluster: %v", err)
+	}
+	return nil
+}
+
+// AddClusterHost records a host seen in a cluster
+func AddClusterHost(id int64, hostname string) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if _, err := instance.Exec(`INSERT OR IGNORE INTO cluster_hosts (cluster_id, hostname) VALUES (?, ?)`, id, hostname); err != nil {
+		return fmt.Errorf("failed to add cluster host: %v", err)
+	}
+	return nil
+}
+
+// SetClusterRepresentativeLog records the log whose analysis stands for a cluster
+func SetClusterRepresentativeLog(id, logID int64) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if _, err := instance.Exec(`UPDATE log_clusters SET representative_log_id = ? WHERE id = ?`, nullInt64(logID), id); err != nil {
+		return fmt.Errorf("failed to set cluster representative: %v", err)
+	}
+	return nil
+}
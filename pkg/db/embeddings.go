@@ -0,0 +1,134 @@
+package db
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// createEmbeddingsTableSQL holds one embedding vector per agent_logs row
+const createEmbeddingsTableSQL = `
+CREATE TABLE IF NOT EXISTS log_embeddings (
+	log_id INTEGER PRIMARY KEY,
+	model TEXT NOT NULL,
+	dims INTEGER NOT NULL,
+	vector BLOB NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_log_embeddings_model ON log_embeddings (model, dims);`
+
+// VectorMatch is a log found by a vector search
+type VectorMatch struct {
+	LogID      int64
+	Similarity float64 // Cosine similarity to the query vector
+}
+
+// PutLogEmbedding stores the embedding of a log entry, replacing any previous one
+func PutLogEmbedding(logID int64, model string, vector []float32) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := instance.Exec(`INSERT OR REPLACE INTO log_embeddings (log_id, model, dims, vector) VALUES (?, ?, ?, ?)`,
+		logID, model, len(vector), encodeVector(vector))
+	if err != nil {
+		return fmt.Errorf("failed to store log embedding: %v", err)
+	}
+	return nil
+}
+
+// NearestLogs returns up to limit logs whose embeddings from the same model are most similar
+// to vector, most similar first. The search is an exact scan over every stored vector.
+func NearestLogs(model string, vector []float32, limit int) ([]VectorMatch, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := instance.Query(`SELECT log_id, vector FROM log_embeddings WHERE model = ? AND dims = ?`, model, len(vector))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log embeddings: %v", err)
+	}
+	defer rows.Close()
+
+	// Keep the best matches in a min-heap so memory stays bounded by limit
+	best := &matchHeap{}
+	stored := make([]float32, len(vector))
+	for rows.Next() {
+		var m VectorMatch
+		var blob []byte
+		if err := rows.Scan(&m.LogID, &blob); err != nil {
+			return nil, fmt.Errorf("failed to scan log embedding: %v", err)
+		}
+		if !decodeVector(blob, stored) {
+			continue
+		}
+		m.Similarity = cosine(vector, stored)
+		if best.Len() < limit {
+			heap.Push(best, m)
+		} else if m.Similarity > (*best)[0].Similarity {
+			(*best)[0] = m
+			heap.Fix(best, 0)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query log embeddings: %v", err)
+	}
+
+	matches := make([]VectorMatch, best.Len())
+	for i := len(matches) - 1; i >= 0; i-- {
+		matches[i] = heap.Pop(best).(VectorMatch)
+	}
+	return matches, nil
+}
+
+// encodeVector stores a vector as little-endian float32s
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+// decodeVector reads a vector written by encodeVector into v and reports whether the sizes match
+func decodeVector(b []byte, v []float32) bool {
+	if len(b) != 4*len(v) {
+		return false
+	}
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return true
+}
+
+// cosine returns the cosine similarity of two vectors of equal length
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// matchHeap is a min-heap of matches by similarity
+type matchHeap []VectorMatch
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(i, j int) bool  { return h[i].Similarity < h[j].Similarity }
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(VectorMatch)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
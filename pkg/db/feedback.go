@@ -0,0 +1,104 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// createFeedbackTableSQL holds operator feedback on stored analyses
+const createFeedbackTableSQL = `
+CREATE TABLE IF NOT EXISTS log_feedback (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	log_id INTEGER NOT NULL,
+	rating INTEGER,
+	correction TEXT,
+	resolution TEXT,
+	author TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_log_feedback_log_id ON log_feedback (log_id);`
+
+// Feedback is an operator's verdict on the analysis of a log entry
+type Feedback struct {
+	ID         int64     `json:"id"`
+	LogID      int64     `json:"log_id"`
+	Rating     int       `json:"rating,omitempty"`     // 1 (wrong) to 5 (spot on), zero if not rated
+	Correction string    `json:"correction,omitempty"` // What the analysis should have said
+	Resolution string    `json:"resolution,omitempty"` // What actually fixed the problem
+	Author     string    `json:"author,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AddFeedback stores feedback on a log entry and returns its ID. A resolution also becomes the
+// log entry's resolution, so it is offered to later analyses of similar logs.
+func AddFeedback(f Feedback) (int64, error) {
+	if instance == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	tx, err := instance.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`SELECT 1 FROM agent_logs WHERE id = ?`, f.LogID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("log entry %d not found", f.LogID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query log entry: %v", err)
+	}
+
+	result, err := tx.Exec(`INSERT INTO log_feedback (log_id, rating, correction, resolution, author) VALUES (?, ?, ?, ?, ?)`,
+		f.LogID, nullInt64(int64(f.Rating)), nullString(f.Correction), nullString(f.Resolution), nullString(f.Author))
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert feedback: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert feedback: %v", err)
+	}
+
+	if f.Resolution != "" {
+		if _, err := tx.Exec(`UPDATE agent_logs SET resolution = ? WHERE id = ?`, f.Resolution, f.LogID); err != nil {
+			return 0, fmt.Errorf("failed to record resolution: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit feedback: %v", err)
+	}
+	return id, nil
+}
+
+// GetFeedback retrieves the most recent feedback, on one log entry or on all of them when logID
+// is zero
+func GetFeedback(logID int64, limit int) ([]Feedback, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT id, log_id, COALESCE(rating, 0), COALESCE(correction, ''), COALESCE(resolution, ''),
+		COALESCE(author, ''), created_at
+	FROM log_feedback
+	WHERE (? = 0 OR log_id = ?)
+	ORDER BY id DESC
+	LIMIT ?`, logID, logID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %v", err)
+	}
+	defer rows.Close()
+
+	var feedback []Feedback
+	for rows.Next() {
+		var f Feedback
+		if err := rows.Scan(&f.ID, &f.LogID, &f.Rating, &f.Correction, &f.Resolution, &f.Author, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %v", err)
+		}
+		feedback = append(feedback, f)
+	}
+	return feedback, rows.Err()
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Incident statuses
+const (
+	IncidentOpen   = "open"
+	IncidentClosed = "closed"
+)
+
+// createIncidentsTableSQL holds incidents grouping correlated log entries
+const createIncidentsTableSQL = `
+CREATE TABLE IF NOT EXISTS incidents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	status TEXT NOT NULL,
+	host_group TEXT,
+	summary TEXT,
+	entries INTEGER NOT NULL DEFAULT 0,
+	max_risk INTEGER,
+	opened_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_activity DATETIME DEFAULT CURRENT_TIMESTAMP,
+	closed_at DATETIME
+);`
+
+// createIncidentLogsIndexSQL indexes the log entries of each incident. It is created after the
+// agent_logs migration, since older databases lack the incident_id column until then.
+const createIncidentLogsIndexSQL = `CREATE INDEX IF NOT EXISTS idx_agent_logs_incident ON agent_logs(incident_id);`
+
+// Incident represents a group of correlated log entries
+type Incident struct {
+	ID           int64      `json:"id"`
+	Title        string     `json:"title"`
+	Status       string     `json:"status"`
+	HostGroup    string     `json:"host_group"`
+	Summary      string     `json:"summary"` // Rolling LLM summary, empty until the first one is written
+	Entries      int        `json:"entries"`
+	MaxRisk      int        `json:"max_risk"`
+	OpenedAt     time.Time  `json:"opened_at"`
+	LastActivity time.Time  `json:"last_activity"`
+	ClosedAt     *time.Time `json:"closed_at"`
+}
+
+// incidentColumns are the incidents columns read into an Incident, in scanIncident order
+const incidentColumns = `id, title, status, COALESCE(host_group, ''), COALESCE(summary, ''), entries,
+	COALESCE(max_risk, 0), opened_at, last_activity, closed_at`
+
+// scanIncident reads a row selected with incidentColumns
+func scanIncident(row rowScanner) (Incident, error) {
+	var inc Incident
+	var closedAt sql.NullTime
+	err := row.Scan(
+		&inc.ID,
+		&inc.Title,
+		&inc.Status,
+		&inc.HostGroup,
+		&inc.Summary,
+		&inc.Entries,
+		&inc.MaxRisk,
+		&inc.OpenedAt,
+		&inc.LastActivity,
+		&closedAt,
+	)
+	if closedAt.Valid {
+		inc.ClosedAt = &closedAt.Time
+	}
+	return inc, err
+}
+
+// CreateIncident opens an incident and attaches the given log entries to it
+func CreateIncident(title, hostGroup string, logIDs []int64) (int64, error) {
+	if instance == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	result, err := instance.Exec(`INSERT INTO incidents (title, status, host_group) VALUES (?, ?, ?)`,
+		title, IncidentOpen, nullString(hostGroup))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create incident: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create incident: %v", err)
+	}
+	return id, AttachToIncident(id, logIDs)
+}
+
+// AttachToIncident links log entries to an incident and records the activity. The incident's
+// entry count and maximum risk are updated from the newly attached entries alone.
+func AttachToIncident(id int64, logIDs []int64) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	if len(logIDs) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(logIDs)), ",")
+	ids := make([]interface{}, 0, len(logIDs))
+	for _, logID := range logIDs {
+		ids = append(ids, logID)
+	}
+
+	tx, err := instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Entries already in the incident, such as redelivered logs, are not counted again
+	result, err := tx.Exec(`UPDATE agent_logs SET incident_id = ? WHERE incident_id IS NOT ? AND id IN (`+placeholders+`)`,
+		append([]interface{}{id, id}, ids...)...)
+	if err != nil {
+		return fmt.Errorf("failed to attach logs to incident: %v", err)
+	}
+	attached, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to attach logs to incident: %v", err)
+	}
+
+	var risk sql.NullInt64
+	err = tx.QueryRow(`SELECT MAX(risk_score) FROM agent_logs WHERE id IN (`+placeholders+`)`, ids...).Scan(&risk)
+	if err != nil {
+		return fmt.Errorf("failed to read log risk: %v", err)
+	}
+
+	// SQLite's scalar MAX is NULL if either argument is, so the COALESCE keeps whichever is set
+	_, err = tx.Exec(`
+	UPDATE incidents SET
+		entries = entries + ?,
+		max_risk = COALESCE(MAX(max_risk, ?), max_risk, ?),
+		last_activity = CURRENT_TIMESTAMP
+	WHERE id = ?`, attached, risk, risk, id)
+	if err != nil {
+		return fmt.Errorf("failed to update incident: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit incident: %v", err)
+	}
+	return nil
+}
+
+// UpdateIncidentSummary stores an incident's rolling summary
+func UpdateIncidentSummary(id int64, summary string) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if _, err := instance.Exec(`UPDATE incidents SET summary = ? WHERE id = ?`, summary, id); err != nil {
+		return fmt.Errorf("failed to update incident summary: %v", err)
+	}
+	return nil
+}
+
+// CloseIncident marks an incident closed
+func CloseIncident(id int64) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := instance.Exec(`UPDATE incidents SET status = ?, closed_at = CURRENT_TIMESTAMP WHERE id = ?`, IncidentClosed, id)
+	if err != nil {
+		return fmt.Errorf("failed to close incident: %v", err)
+	}
+	return nil
+}
+
+// GetIncident retrieves an incident by ID, or nil if there is none
+func GetIncident(id int64) (*Incident, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	inc, err := scanIncident(instance.QueryRow(`SELECT `+incidentColumns+` FROM incidents WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident: %v", err)
+	}
+	return &inc, nil
+}
+
+// GetIncidents retrieves the most recently active incidents, optionally only those with a status
+func GetIncidents(status string, limit int) ([]Incident, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT `+incidentColumns+`
+	FROM incidents
+	WHERE (? = '' OR status = ?)
+	ORDER BY last_activity DESC
+	LIMIT ?`, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %v", err)
+	}
+	defer rows.Close()
+
+	var incidents []Incident
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %v", err)
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// GetIncidentLogs retrieves the most recent log entries of an incident
+func GetIncidentLogs(id int64, limit int) ([]LogEntry, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT `+logEntryColumns+`
+	FROM agent_logs
+	WHERE incident_id = ?
+	ORDER BY id DESC
+	LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident logs: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		entry, err := scanLogEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan log entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
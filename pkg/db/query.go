@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LogFilter selects stored log entries. Zero fields match everything.
+type LogFilter struct {
+	From       time.Time // Stored at or after From
+	To         time.Time // Stored before To
+	Hostname   string
+	Service    string
+	Severity   string // Matched case-insensitively
+	Text       string // Words that must all appear in the message, summary, root cause or resolution
+	IncidentID int64
+
+	After     int64 // Cursor: only entries past this ID in the sort order
+	Ascending bool  // Oldest first instead of newest first
+	Limit     int
+}
+
+// QueryLogEntries retrieves the log entries matching a filter, newest first unless Ascending
+// is set. It returns the ID to pass as After for the next page, or zero on the last page.
+func QueryLogEntries(f LogFilter) ([]LogEntry, int64, error) {
+	if instance == nil {
+		return nil, 0, fmt.Errorf("database not initialized")
+	}
+	if f.Limit <= 0 {
+		return nil, 0, fmt.Errorf("limit must be positive")
+	}
+
+	var where []string
+	var args []interface{}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.UTC().Format(sqliteTime))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.UTC().Format(sqliteTime))
+	}
+	if f.Hostname != "" {
+		where = append(where, "hostname = ?")
+		args = append(args, f.Hostname)
+	}
+	if f.Service != "" {
+		where = append(where, "service = ?")
+		args = append(args, f.Service)
+	}
+	if f.Severity != "" {
+		where = append(where, "severity = ? COLLATE NOCASE")
+		args = append(args, f.Severity)
+	}
+	if f.IncidentID != 0 {
+		where = append(where, "incident_id = ?")
+		args = append(args, f.IncidentID)
+	}
+	if match := matchAll(f.Text); match != "" {
+		where = append(where, "id IN (SELECT docid FROM agent_logs_fts WHERE agent_logs_fts MATCH ?)")
+		args = append(args, match)
+	}
+
+	order := "DESC"
+	if f.Ascending {
+		order = "ASC"
+	}
+	if f.After != 0 {
+		if f.Ascending {
+			where = append(where, "id > ?")
+		} else {
+			where = append(where, "id < ?")
+		}
+		args = append(args, f.After)
+	}
+
+	query := `SELECT ` + logEntryColumns + ` FROM agent_logs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// Fetch one extra entry to learn whether another page follows
+	query += ` ORDER BY id ` + order + ` LIMIT ?`
+	args = append(args, f.Limit+1)
+
+	rows, err := instance.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query logs: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		entry, err := scanLogEntry(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan log entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to query logs: %v", err)
+	}
+
+	if len(entries) <= f.Limit {
+		return entries, 0, nil
+	}
+	entries = entries[:f.Limit]
+	return entries, entries[len(entries)-1].ID, nil
+}
+
+// matchAll turns free text into a full-text query requiring every word, quoting each one so
+// that operators in the text are searched for rather than interpreted
+func matchAll(text string) string {
+	var words []string
+	for _, w := range strings.Fields(text) {
+		if w = strings.ReplaceAll(w, `"`, ``); w != "" {
+			words = append(words, `"`+w+`"`)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// sqliteTime is the layout of CURRENT_TIMESTAMP, which is always UTC
+const sqliteTime = "2006-01-02 15:04:05"
+
+// LogCount summarizes the log entries of one service and severity
+type LogCount struct {
+	Service   string  `json:"service"`
+	Severity  string  `json:"severity"`
+	Count     int     `json:"count"`
+	Reused    int     `json:"reused"` // Entries whose analysis was reused instead of requested
+	Hosts     int     `json:"hosts"`
+	Incidents int     `json:"incidents"` // Distinct incidents the entries were correlated into
+	MaxRisk   int     `json:"max_risk"`  // Highest risk score, zero if none was analyzed
+	AvgRisk   float64 `json:"avg_risk"`
+}
+
+// GetLogCounts counts the log entries stored in [from, to) by service and severity, busiest first
+func GetLogCounts(from, to time.Time) ([]LogCount, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT service, severity, COUNT(*), SUM(cached), COUNT(DISTINCT hostname), COUNT(DISTINCT incident_id),
+		COALESCE(MAX(risk_score), 0), COALESCE(AVG(risk_score), 0)
+	FROM agent_logs
+	WHERE created_at >= ? AND created_at < ?
+	GROUP BY service, severity
+	ORDER BY COUNT(*) DESC`, from.UTC().Format(sqliteTime), to.UTC().Format(sqliteTime))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count logs: %v", err)
+	}
+	defer rows.Close()
+
+	var counts []LogCount
+	for rows.Next() {
+		var c LogCount
+		if err := rows.Scan(&c.Service, &c.Severity, &c.Count, &c.Reused, &c.Hosts, &c.Incidents, &c.MaxRisk, &c.AvgRisk); err != nil {
+			return nil, fmt.Errorf("failed to scan log count: %v", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// GetTopRiskLogs retrieves the highest-risk analyzed log entries stored in [from, to)
+func GetTopRiskLogs(from, to time.Time, limit int) ([]LogEntry, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT `+logEntryColumns+`
+	FROM agent_logs
+	WHERE created_at >= ? AND created_at < ? AND risk_score IS NOT NULL
+	ORDER BY risk_score DESC, id DESC
+	LIMIT ?`, from.UTC().Format(sqliteTime), to.UTC().Format(sqliteTime), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top risk logs: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		entry, err := scanLogEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan log entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetIncidentsBetween retrieves the incidents that were open at any time in [from, to), most
+// severe first
+func GetIncidentsBetween(from, to time.Time) ([]Incident, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT `+incidentColumns+`
+	FROM incidents
+	WHERE opened_at < ? AND (closed_at IS NULL OR closed_at >= ?)
+	ORDER BY COALESCE(max_risk, 0) DESC, entries DESC`, to.UTC().Format(sqliteTime), from.UTC().Format(sqliteTime))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incidents: %v", err)
+	}
+	defer rows.Close()
+
+	var incidents []Incident
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan incident: %v", err)
+		}
+		incidents = append(incidents, inc)
+	}
+	return incidents, rows.Err()
+}
+
+// LogBucket counts the log entries of one service and severity stored in one time bucket
+type LogBucket struct {
+	Start    time.Time `json:"start"`
+	Service  string    `json:"service"`
+	Severity string    `json:"severity"`
+	Count    int       `json:"count"`
+}
+
+// GetLogHistogram counts the log entries stored in [from, to) per bucket of the given width,
+// service and severity, oldest bucket first. Buckets without entries are left out.
+func GetLogHistogram(from, to time.Time, bucket time.Duration) ([]LogBucket, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	width := int64(bucket / time.Second)
+	if width <= 0 {
+		return nil, fmt.Errorf("bucket must be at least a second")
+	}
+
+	rows, err := instance.Query(`
+	SELECT CAST(strftime('%s', created_at) AS INTEGER) / ? * ? AS start, service, severity, COUNT(*)
+	FROM agent_logs
+	WHERE created_at >= ? AND created_at < ?
+	GROUP BY start, service, severity
+	ORDER BY start, service, severity`, width, width, from.UTC().Format(sqliteTime), to.UTC().Format(sqliteTime))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count logs: %v", err)
+	}
+	defer rows.Close()
+
+	var buckets []LogBucket
+	for rows.Next() {
+		var b LogBucket
+		var start int64
+		if err := rows.Scan(&start, &b.Service, &b.Severity, &b.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan log bucket: %v", err)
+		}
+		b.Start = time.Unix(start, 0).UTC()
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
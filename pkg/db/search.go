@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// searchCandidates bounds how many full-text matches are ranked per search
+const searchCandidates = 200
+
+// createSearchIndexSQL indexes the text of agent_logs in an external content FTS4 table kept in
+// sync by triggers
+const createSearchIndexSQL = `
+CREATE VIRTUAL TABLE agent_logs_fts USING fts4(content="agent_logs", message, summary, root_cause, resolution);
+CREATE TRIGGER agent_logs_fts_bu BEFORE UPDATE OF message, summary, root_cause, resolution ON agent_logs BEGIN
+	DELETE FROM agent_logs_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER agent_logs_fts_bd BEFORE DELETE ON agent_logs BEGIN
+	DELETE FROM agent_logs_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER agent_logs_fts_au AFTER UPDATE OF message, summary, root_cause, resolution ON agent_logs BEGIN
+	INSERT INTO agent_logs_fts (docid, message, summary, root_cause, resolution)
+	VALUES (new.id, new.message, new.summary, new.root_cause, new.resolution);
+END;
+CREATE TRIGGER agent_logs_fts_ai AFTER INSERT ON agent_logs BEGIN
+	INSERT INTO agent_logs_fts (docid, message, summary, root_cause, resolution)
+	VALUES (new.id, new.message, new.summary, new.root_cause, new.resolution);
+END;
+INSERT INTO agent_logs_fts (agent_logs_fts) VALUES ('rebuild');`
+
+// createSearchIndex creates the full-text index over the existing logs on first use
+func createSearchIndex() error {
+	var name string
+	err := instance.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'agent_logs_fts'`).Scan(&name)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up search index: %v", err)
+	}
+
+	tx, err := instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec(createSearchIndexSQL); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create search index: %v", err)
+	}
+	return tx.Commit()
+}
+
+// SearchLogEntries returns up to limit analyzed log entries matching the most of the given
+// terms, best match first. Entries whose analysis was reused are skipped unless an operator
+// recorded a resolution for them, so repeats of one event do not crowd out the rest.
+func SearchLogEntries(terms []string, limit int) ([]LogEntry, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	quoted := make([]string, 0, len(terms))
+	for _, t := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(t, `"`, ``)+`"`)
+	}
+	if len(quoted) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := instance.Query(`
+	SELECT agent_logs.id, matchinfo(agent_logs_fts, 'pcnx')
+	FROM agent_logs_fts
+	JOIN agent_logs ON agent_logs.id = agent_logs_fts.docid
+	WHERE agent_logs_fts MATCH ?
+		AND (agent_logs.summary IS NOT NULL OR agent_logs.resolution IS NOT NULL)
+		AND (agent_logs.cached = 0 OR agent_logs.resolution IS NOT NULL)
+	ORDER BY agent_logs.id DESC
+	LIMIT ?`, strings.Join(quoted, " OR "), searchCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search logs: %v", err)
+	}
+
+	type match struct {
+		id    int64
+		score float64
+	}
+	var matches []match
+	for rows.Next() {
+		var m match
+		var info []byte
+		if err := rows.Scan(&m.id, &info); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan search match: %v", err)
+		}
+		m.score = rank(info)
+		matches = append(matches, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search logs: %v", err)
+	}
+
+	// Most recent first among equal scores, as the candidates arrived
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	entries := make([]LogEntry, 0, len(matches))
+	for _, m := range matches {
+		entry, err := GetLogEntry(m.id)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+// rank scores a match from its matchinfo 'pcnx' blob with TF-IDF: every query term found in a
+// column adds its saturated hit count weighted by how rare the term is across all logs
+func rank(info []byte) float64 {
+	ints := make([]uint32, len(info)/4)
+	for i := range ints {
+		ints[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(ints) < 3 {
+		return 0
+	}
+
+	phrases, columns, total := int(ints[0]), int(ints[1]), float64(ints[2])
+	var score float64
+	for p := 0; p < phrases; p++ {
+		for c := 0; c < columns; c++ {
+			x := 3 + 3*(p*columns+c)
+			if x+2 >= len(ints) || ints[x] == 0 {
+				continue
+			}
+			hits, docs := float64(ints[x]), float64(ints[x+2])
+			score += hits / (hits + 1) * math.Log(1+total/docs)
+		}
+	}
+	return score
+}
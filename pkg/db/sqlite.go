@@ -16,14 +16,36 @@ var (
 
 // LogEntry represents a database log entry
 type LogEntry struct {
-	ID        int64
-	Timestamp string
-	Hostname  string
-	Severity  string
-	Service   string
-	Message   string
-	Context   string // JSON string of the context map
-	Analysis  string // Store the AI analysis
+	ID        int64  `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Hostname  string `json:"hostname"`
+	Severity  string `json:"severity"`
+	Service   string `json:"service"`
+	Message   string `json:"message"`
+	Context   string `json:"context,omitempty"`  // JSON string of the context map
+	Analysis  string `json:"analysis,omitempty"` // Store the AI analysis
+	Provider  string `json:"provider,omitempty"` // LLM provider that produced the analysis
+
+	// Structured analysis fields, empty when the model never produced valid JSON
+	Summary            string  `json:"summary,omitempty"`
+	RootCause          string  `json:"root_cause,omitempty"`
+	Category           string  `json:"category,omitempty"`
+	RiskScore          int     `json:"risk_score,omitempty"`
+	RecommendedActions string  `json:"recommended_actions,omitempty"` // JSON array of recommended actions
+	Confidence         float64 `json:"confidence,omitempty"`
+
+	Fingerprint string `json:"fingerprint,omitempty"` // Normalized fingerprint used as the analysis cache key
+	Cached      bool   `json:"cached"`                // Analysis was reused from the cache instead of requested
+
+	TemplateID     int64  `json:"template_id,omitempty"`     // Mined log template the message belongs to
+	TemplateParams string `json:"template_params,omitempty"` // JSON array of the message tokens at the template's wildcards
+	ClusterID      int64  `json:"cluster_id,omitempty"`      // Cluster of near-duplicate messages the message belongs to
+	IncidentID     int64  `json:"incident_id,omitempty"`     // Incident the message was correlated into, zero if none
+
+	Resolution string `json:"resolution,omitempty"` // Operator-recorded fix, empty until one is recorded
+
+	Format     string `json:"format"`                // Input format the log was decoded from
+	RawPayload []byte `json:"raw_payload,omitempty"` // Original payload of logs not published as LogMessage JSON, base64 in JSON
 }
 
 // InitDB initializes the SQLite database connection
@@ -55,6 +77,72 @@ func InitDB(dbPath string) (*sql.DB, error) {
 			log.Printf("Error creating table: %v", err)
 			return
 		}
+
+		_, err = instance.Exec(createCacheTableSQL)
+		if err != nil {
+			log.Printf("Error creating cache table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createTemplatesTableSQL)
+		if err != nil {
+			log.Printf("Error creating templates table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createClustersTableSQL)
+		if err != nil {
+			log.Printf("Error creating clusters tables: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createBaselinesTableSQL)
+		if err != nil {
+			log.Printf("Error creating baselines table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createIncidentsTableSQL)
+		if err != nil {
+			log.Printf("Error creating incidents table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createEmbeddingsTableSQL)
+		if err != nil {
+			log.Printf("Error creating embeddings table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createFeedbackTableSQL)
+		if err != nil {
+			log.Printf("Error creating feedback table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createTailOffsetsTableSQL)
+		if err != nil {
+			log.Printf("Error creating tail offsets table: %v", err)
+			return
+		}
+
+		err = addMissingColumns("agent_logs", agentLogColumns)
+		if err != nil {
+			log.Printf("Error migrating table: %v", err)
+			return
+		}
+
+		_, err = instance.Exec(createIncidentLogsIndexSQL)
+		if err != nil {
+			log.Printf("Error creating incident index: %v", err)
+			return
+		}
+
+		err = createSearchIndex()
+		if err != nil {
+			log.Printf("Error creating search index: %v", err)
+			return
+		}
 	})
 
 	if err != nil {
@@ -64,22 +152,91 @@ func InitDB(dbPath string) (*sql.DB, error) {
 	return instance, nil
 }
 
+// column is a column added to an existing table after its initial release
+type column struct {
+	name       string
+	definition string
+}
+
+// agentLogColumns are the agent_logs columns that databases created by older versions lack
+var agentLogColumns = []column{
+	{"provider", "TEXT"},
+	{"summary", "TEXT"},
+	{"root_cause", "TEXT"},
+	{"category", "TEXT"},
+	{"risk_score", "INTEGER"},
+	{"recommended_actions", "TEXT"},
+	{"confidence", "REAL"},
+	{"fingerprint", "TEXT"},
+	{"cached", "INTEGER NOT NULL DEFAULT 0"},
+	{"template_id", "INTEGER"},
+	{"template_params", "TEXT"},
+	{"cluster_id", "INTEGER"},
+	{"incident_id", "INTEGER"},
+	{"resolution", "TEXT"},
+	{"format", "TEXT NOT NULL DEFAULT 'json'"},
+	{"raw_payload", "BLOB"},
+}
+
+// addMissingColumns adds any of the given columns that the table does not have yet
+func addMissingColumns(table string, columns []column) error {
+	rows, err := instance.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read %s schema: %v", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name, kind string
+			notNull    int
+			dflt       sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan %s schema: %v", table, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, c := range columns {
+		if existing[c.name] {
+			continue
+		}
+		if _, err := instance.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c.name, c.definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %v", table, c.name, err)
+		}
+	}
+	return nil
+}
+
 // GetDB returns the database instance
 func GetDB() *sql.DB {
 	return instance
 }
 
-// InsertLogEntry inserts a new log entry into the database
-func InsertLogEntry(entry LogEntry) error {
+// InsertLogEntry inserts a new log entry into the database and returns its ID
+func InsertLogEntry(entry LogEntry) (int64, error) {
 	if instance == nil {
-		return fmt.Errorf("database not initialized")
+		return 0, fmt.Errorf("database not initialized")
 	}
 
 	query := `
-	INSERT INTO agent_logs (timestamp, hostname, severity, service, message, context, analysis)
-	VALUES (?, ?, ?, ?, ?, ?, ?)`
+	INSERT INTO agent_logs (timestamp, hostname, severity, service, message, context, analysis, provider,
+		summary, root_cause, category, risk_score, recommended_actions, confidence, fingerprint, cached,
+		template_id, template_params, cluster_id, format, raw_payload)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := instance.Exec(query,
+	// Leave the structured columns NULL for unstructured analyses
+	var riskScore, confidence interface{}
+	if entry.Summary != "" {
+		riskScore = entry.RiskScore
+		confidence = entry.Confidence
+	}
+
+	result, err := instance.Exec(query,
 		entry.Timestamp,
 		entry.Hostname,
 		entry.Severity,
@@ -87,51 +244,100 @@ func InsertLogEntry(entry LogEntry) error {
 		entry.Message,
 		entry.Context,
 		entry.Analysis,
+		entry.Provider,
+		nullString(entry.Summary),
+		nullString(entry.RootCause),
+		nullString(entry.Category),
+		riskScore,
+		nullString(entry.RecommendedActions),
+		confidence,
+		nullString(entry.Fingerprint),
+		entry.Cached,
+		nullInt64(entry.TemplateID),
+		nullString(entry.TemplateParams),
+		nullInt64(entry.ClusterID),
+		entry.Format,
+		entry.RawPayload,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert log: %v", err)
+		return 0, fmt.Errorf("failed to insert log: %v", err)
 	}
 
-	return nil
+	return result.LastInsertId()
 }
 
-// GetLogEntries retrieves log entries with optional filters
-func GetLogEntries(limit int, severity string) ([]LogEntry, error) {
-	if instance == nil {
-		return nil, fmt.Errorf("database not initialized")
+// nullString stores empty strings as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
 	}
+	return s
+}
 
-	query := `
-	SELECT id, timestamp, hostname, severity, service, message, context, analysis
-	FROM agent_logs
-	WHERE (? = '' OR severity = ?)
-	ORDER BY timestamp DESC
-	LIMIT ?`
-
-	rows, err := instance.Query(query, severity, severity, limit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query logs: %v", err)
+// nullInt64 stores zero as NULL
+func nullInt64(n int64) interface{} {
+	if n == 0 {
+		return nil
 	}
-	defer rows.Close()
+	return n
+}
 
-	var entries []LogEntry
-	for rows.Next() {
-		var entry LogEntry
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Timestamp,
-			&entry.Hostname,
-			&entry.Severity,
-			&entry.Service,
-			&entry.Message,
-			&entry.Context,
-			&entry.Analysis,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan log entry: %v", err)
-		}
-		entries = append(entries, entry)
+// logEntryColumns are the agent_logs columns read into a LogEntry, in scanLogEntry order
+const logEntryColumns = `id, timestamp, hostname, severity, service, message, context, analysis, COALESCE(provider, ''),
+	COALESCE(summary, ''), COALESCE(root_cause, ''), COALESCE(category, ''), COALESCE(risk_score, 0),
+	COALESCE(recommended_actions, ''), COALESCE(confidence, 0), COALESCE(fingerprint, ''), cached,
+	COALESCE(template_id, 0), COALESCE(template_params, ''), COALESCE(cluster_id, 0),
+	COALESCE(incident_id, 0), COALESCE(resolution, ''), format, raw_payload`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLogEntry reads a row selected with logEntryColumns
+func scanLogEntry(row rowScanner) (LogEntry, error) {
+	var entry LogEntry
+	err := row.Scan(
+		&entry.ID,
+		&entry.Timestamp,
+		&entry.Hostname,
+		&entry.Severity,
+		&entry.Service,
+		&entry.Message,
+		&entry.Context,
+		&entry.Analysis,
+		&entry.Provider,
+		&entry.Summary,
+		&entry.RootCause,
+		&entry.Category,
+		&entry.RiskScore,
+		&entry.RecommendedActions,
+		&entry.Confidence,
+		&entry.Fingerprint,
+		&entry.Cached,
+		&entry.TemplateID,
+		&entry.TemplateParams,
+		&entry.ClusterID,
+		&entry.IncidentID,
+		&entry.Resolution,
+		&entry.Format,
+		&entry.RawPayload,
+	)
+	return entry, err
+}
+
+// GetLogEntry retrieves a single log entry by ID
+func GetLogEntry(id int64) (*LogEntry, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
 	}
 
-	return entries, nil
+	entry, err := scanLogEntry(instance.QueryRow(`SELECT `+logEntryColumns+` FROM agent_logs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log entry: %v", err)
+	}
+	return &entry, nil
 }
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// createTailOffsetsTableSQL holds how far each tailed file has been published
+const createTailOffsetsTableSQL = `
+CREATE TABLE IF NOT EXISTS tail_offsets (
+	path TEXT PRIMARY KEY,
+	offset INTEGER NOT NULL,
+	head_size INTEGER NOT NULL,
+	head_hash TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`
+
+// TailOffset is the checkpoint of a tailed file. The hash of the file's first HeadSize bytes
+// tells whether the file at Path is still the one the offset belongs to.
+type TailOffset struct {
+	Path     string
+	Offset   int64
+	HeadSize int
+	HeadHash string
+}
+
+// GetTailOffset returns the checkpoint of a file, or nil when there is none
+func GetTailOffset(path string) (*TailOffset, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	t := TailOffset{Path: path}
+	err := instance.QueryRow(`SELECT offset, head_size, head_hash FROM tail_offsets WHERE path = ?`, path).
+		Scan(&t.Offset, &t.HeadSize, &t.HeadHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tail offset: %v", err)
+	}
+	return &t, nil
+}
+
+// SaveTailOffset stores the checkpoint of a file, replacing the previous one
+func SaveTailOffset(t TailOffset) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := instance.Exec(`
+	INSERT INTO tail_offsets (path, offset, head_size, head_hash, updated_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(path) DO UPDATE SET offset = excluded.offset, head_size = excluded.head_size,
+		head_hash = excluded.head_hash, updated_at = excluded.updated_at`,
+		t.Path, t.Offset, t.HeadSize, t.HeadHash)
+	if err != nil {
+		return fmt.Errorf("failed to save tail offset: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import "fmt"
+
+// createTemplatesTableSQL holds the log templates mined from incoming messages
+const createTemplatesTableSQL = `
+CREATE TABLE IF NOT EXISTS log_templates (
+	id INTEGER PRIMARY KEY,
+	service TEXT NOT NULL,
+	template TEXT NOT NULL,
+	count INTEGER NOT NULL DEFAULT 0,
+	analysis_log_id INTEGER,
+	first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+);`
+
+// LogTemplate represents a mined log template
+type LogTemplate struct {
+	ID            int64
+	Service       string
+	Template      string // Message pattern with variable tokens as "<*>"
+	Count         int64
+	AnalysisLogID int64 // agent_logs row whose analysis is reused, zero if none
+	FirstSeen     string
+	LastSeen      string
+}
+
+// GetLogTemplates returns every stored log template, least recently seen first
+func GetLogTemplates() ([]LogTemplate, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := instance.Query(`
+	SELECT id, service, template, count, COALESCE(analysis_log_id, 0), first_seen, last_seen
+	FROM log_templates
+	ORDER BY last_seen, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log templates: %v", err)
+	}
+	defer rows.Close()
+
+	var templates []LogTemplate
+	for rows.Next() {
+		var t LogTemplate
+		if err := rows.Scan(&t.ID, &t.Service, &t.Template, &t.Count, &t.AnalysisLogID, &t.FirstSeen, &t.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan log template: %v", err)
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// SaveLogTemplate creates or updates a service's log template, marking it as seen now
+func SaveLogTemplate(id int64, service, template string, count int64) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := instance.Exec(`
+	INSERT INTO log_templates (id, service, template, count) VALUES (?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		template = excluded.template,
+		count = excluded.count,
+		last_seen = CURRENT_TIMESTAMP`, id, service, template, count)
+	if err != nil {
+		return fmt.Errorf("failed to save log template: %v", err)
+	}
+	return nil
+}
+
+// SetTemplateAnalysis records the log whose analysis is reused for a template
+func SetTemplateAnalysis(id, logID int64) error {
+	if instance == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if _, err := instance.Exec(`UPDATE log_templates SET analysis_log_id = ? WHERE id = ?`, nullInt64(logID), id); err != nil {
+		return fmt.Errorf("failed to set template analysis: %v", err)
+	}
+	return nil
+}
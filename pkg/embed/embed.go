@@ -0,0 +1,30 @@
+package embed
+
+import (
+	"context"
+	"math"
+)
+
+// Embedder produces embedding vectors for text
+type Embedder interface {
+	// Embed returns the embedding of text
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// Model identifies the vector space; vectors of different models are never compared
+	Model() string
+}
+
+// normalize scales v to unit length in place, leaving zero vectors untouched
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
@@ -0,0 +1,58 @@
+package embed
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// Hash is a deterministic local embedder that hashes the words of a text and their character
+// trigrams into a fixed number of dimensions. It needs no model, so it suits tests and offline
+// runs, but only captures shared vocabulary, not meaning.
+type Hash struct {
+	dims int
+}
+
+// NewHash creates a hash embedder producing vectors of the given size
+func NewHash(dims int) *Hash {
+	return &Hash{dims: dims}
+}
+
+// Embed implements Embedder
+func (h *Hash) Embed(ctx context.Context, text string) ([]float32, error) {
+	v := make([]float32, h.dims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		// Numbers vary between otherwise identical logs, so they only count as "a number"
+		if strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			w = "<num>"
+		}
+		h.add(v, "w:"+w, 1)
+
+		padded := []rune("^" + w + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			h.add(v, "t:"+string(padded[i:i+3]), 0.5)
+		}
+	}
+	return normalize(v), nil
+}
+
+// add folds a feature into v, with a hash-derived sign so collisions cancel out on average
+func (h *Hash) add(v []float32, feature string, weight float32) {
+	f := fnv.New64a()
+	f.Write([]byte(feature))
+	sum := f.Sum64()
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	v[sum%uint64(h.dims)] += weight
+}
+
+// Model implements Embedder
+func (h *Hash) Model() string {
+	return fmt.Sprintf("hash-%d", h.dims)
+}
@@ -0,0 +1,77 @@
+package embed
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// dot is the cosine similarity of two unit vectors
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestHashEmbed(t *testing.T) {
+	h := NewHash(256)
+	embed := func(text string) []float32 {
+		v, err := h.Embed(context.Background(), text)
+		if err != nil {
+			t.Fatalf("Embed(%q) error: %v", text, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		similar   string
+		unrelated string
+	}{
+		{
+			name:      "numbers only count as a number",
+			query:     "Connection to historian lost after 30 retries",
+			similar:   "Connection to historian lost after 2 retries",
+			unrelated: "Conveyor belt stopped by operator",
+		},
+		{
+			name:      "shared words outrank other vocabulary",
+			query:     "Disk usage above threshold on /var",
+			similar:   "Disk usage above threshold on /data",
+			unrelated: "User alice logged in from console",
+		},
+		{
+			name:      "trigrams relate word variants",
+			query:     "Pump overheating",
+			similar:   "Pumps overheated",
+			unrelated: "Valve closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := embed(tt.query)
+			if n := dot(q, q); math.Abs(n-1) > 1e-5 {
+				t.Errorf("|Embed(%q)|^2 = %v, want 1", tt.query, n)
+			}
+			similar, unrelated := dot(q, embed(tt.similar)), dot(q, embed(tt.unrelated))
+			if similar <= unrelated {
+				t.Errorf("similarity to %q = %.3f, not above %.3f to %q", tt.similar, similar, unrelated, tt.unrelated)
+			}
+		})
+	}
+
+	// Equal texts embed equally, so stored vectors stay comparable across runs
+	if got := dot(embed("Belt stopped"), embed("Belt stopped")); math.Abs(got-1) > 1e-5 {
+		t.Errorf("similarity of equal texts = %v, want 1", got)
+	}
+	if got := dot(embed("Retry 3 of 5"), embed("Retry 4 of 9")); math.Abs(got-1) > 1e-5 {
+		t.Errorf("similarity of texts differing in numbers = %v, want 1", got)
+	}
+	if got := h.Model(); got != "hash-256" {
+		t.Errorf("Model() = %q, want hash-256", got)
+	}
+}
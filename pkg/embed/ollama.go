@@ -0,0 +1,83 @@
+package embed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Ollama embeds text with the /api/embed endpoint of an Ollama-compatible server
+type Ollama struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+// NewOllama creates an embedder for a model served at baseURL, e.g. http://localhost:11434
+func NewOllama(baseURL, model string) *Ollama {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Ollama{
+		url:    strings.TrimSuffix(baseURL, "/") + "/api/embed",
+		model:  model,
+		client: &http.Client{},
+	}
+}
+
+// ollamaEmbedRequest is the body of an /api/embed request
+type ollamaEmbedRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+// ollamaEmbedResponse is the body of an /api/embed response
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+	Error      string      `json:"error"`
+}
+
+// Embed implements Embedder
+func (o *Ollama) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(ollamaEmbedRequest{Model: o.model, Input: text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embed request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embed request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request embedding: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding: %w", err)
+	}
+	var result ollamaEmbedResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed (HTTP %d): %s", resp.StatusCode, result.Error)
+	}
+	if len(result.Embeddings) == 0 || len(result.Embeddings[0]) == 0 {
+		return nil, fmt.Errorf("server returned no embedding")
+	}
+	return normalize(result.Embeddings[0]), nil
+}
+
+// Model implements Embedder
+func (o *Ollama) Model() string {
+	return o.model
+}
@@ -1,8 +1,12 @@
 package embeddednats
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
+	"slices"
+	"strconv"
 	"time"
 
 	server "github.com/nats-io/nats-server/v2/server"
@@ -11,12 +15,21 @@ import (
 )
 
 type NatsService struct {
-	server *server.Server
-	js     nats.JetStreamContext
-	port   int
+	server   *server.Server
+	js       nats.JetStreamContext
+	port     int
+	mqttAddr string
 }
 
-func NewNatsService(port int) (*NatsService, error) {
+// Options enables optional listeners of the embedded server
+type Options struct {
+	MQTTAddr     string // host:port of the MQTT listener; empty leaves MQTT disabled
+	MQTTUsername string // Credentials MQTT clients must present, when set
+	MQTTPassword string
+	MQTTTLS      *tls.Config // Serves MQTT over TLS when set
+}
+
+func NewNatsService(port int, options Options) (*NatsService, error) {
 	// Configure NATS server with JetStream enabled
 	opts := &server.Options{
 		Port:           port,
@@ -34,6 +47,26 @@ func NewNatsService(port int) (*NatsService, error) {
 		Trace:          true, // Enable trace logging
 	}
 
+	// MQTT clients such as Sparkplug B edge nodes publish through the server's MQTT gateway,
+	// which maps topics to NATS subjects and keeps sessions in JetStream
+	if options.MQTTAddr != "" {
+		host, portStr, err := net.SplitHostPort(options.MQTTAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MQTT address %q: %w", options.MQTTAddr, err)
+		}
+		mqttPort, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MQTT port %q: %w", portStr, err)
+		}
+		opts.MQTT = server.MQTTOpts{
+			Host:      host,
+			Port:      mqttPort,
+			Username:  options.MQTTUsername,
+			Password:  options.MQTTPassword,
+			TLSConfig: options.MQTTTLS,
+		}
+	}
+
 	s, err := server.NewServer(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create NATS server: %w", err)
@@ -43,8 +76,9 @@ func NewNatsService(port int) (*NatsService, error) {
 	s.ConfigureLogger()
 
 	return &NatsService{
-		server: s,
-		port:   port,
+		server:   s,
+		port:     port,
+		mqttAddr: options.MQTTAddr,
 	}, nil
 }
 
@@ -69,25 +103,55 @@ func (n *NatsService) Start() error {
 		return fmt.Errorf("failed to create JetStream context: %w", err)
 	}
 
-	// Create the stream
-	_, err = js.StreamInfo(shared.StreamName)
-	if err != nil {
-		// Create the stream if it doesn't exist
-		_, err = js.AddStream(&nats.StreamConfig{
+	// Create the streams
+	streams := []*nats.StreamConfig{
+		{
 			Name:     shared.StreamName,
-			Subjects: []string{shared.SubjectName},
+			Subjects: []string{shared.SubjectName, shared.FormatSubjects},
 			Storage:  nats.FileStorage,
 			MaxAge:   24 * time.Hour, // Keep messages for 24 hours
-		})
-		if err != nil {
+		},
+		{
+			Name:     shared.DLQStreamName,
+			Subjects: []string{shared.DLQSubjectName},
+			Storage:  nats.FileStorage,
+			MaxAge:   7 * 24 * time.Hour, // Keep failed messages for a week
+		},
+	}
+	for _, cfg := range streams {
+		if err := ensureStream(js, cfg); err != nil {
 			nc.Close()
-			return fmt.Errorf("failed to create stream: %w", err)
+			return err
 		}
-		log.Printf("Created NATS stream: %s", shared.StreamName)
 	}
 
 	n.js = js
 	log.Printf("NATS server started on port %d with JetStream enabled", n.port)
+	if n.mqttAddr != "" {
+		log.Printf("Accepting MQTT clients on %s", n.mqttAddr)
+	}
+	return nil
+}
+
+// ensureStream creates the stream if it doesn't exist, and gives an existing stream any
+// subjects added since it was created
+func ensureStream(js nats.JetStreamContext, cfg *nats.StreamConfig) error {
+	if info, err := js.StreamInfo(cfg.Name); err == nil {
+		if slices.Equal(info.Config.Subjects, cfg.Subjects) {
+			return nil
+		}
+		updated := info.Config
+		updated.Subjects = cfg.Subjects
+		if _, err := js.UpdateStream(&updated); err != nil {
+			return fmt.Errorf("failed to update stream %s subjects: %w", cfg.Name, err)
+		}
+		log.Printf("Updated NATS stream %s subjects to %v", cfg.Name, cfg.Subjects)
+		return nil
+	}
+	if _, err := js.AddStream(cfg); err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+	}
+	log.Printf("Created NATS stream: %s", cfg.Name)
 	return nil
 }
 
@@ -126,7 +190,6 @@ func (n *NatsService) CreateConsumer(streamName, durableName string) error {
 		Durable:       durableName,
 		AckPolicy:     nats.AckExplicitPolicy,
 		MaxDeliver:    -1,
-		FilterSubject: shared.SubjectName,
 		MaxAckPending: -1,
 	})
 	if err != nil {
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// dashboardFiles is the single-page dashboard served at /
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboard serves the embedded dashboard files
+func dashboard() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // The directory is embedded at build time
+	}
+	return http.FileServerFS(files)
+}
+
+// StatsReply breaks down the logs stored in a time range
+type StatsReply struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Bucket  string         `json:"bucket"`
+	Groups  []db.LogCount  `json:"groups"`  // Per service and severity, busiest first
+	Buckets []db.LogBucket `json:"buckets"` // Per bucket, service and severity, oldest first
+}
+
+// handleStats breaks down the logs stored between the query parameters from and to (the last
+// day by default) by service and severity, overall and per bucket (an hour by default)
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bucket := shared.StatsBucket
+	if v := r.URL.Query().Get("bucket"); v != "" {
+		if bucket, err = time.ParseDuration(v); err != nil || bucket < time.Second {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid bucket %q", v))
+			return
+		}
+	}
+	if to.Sub(from)/bucket > shared.StatsMaxBuckets {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("more than %d buckets, use a wider bucket", shared.StatsMaxBuckets))
+		return
+	}
+
+	groups, err := db.GetLogCounts(from, to)
+	if err != nil {
+		log.Printf("Error counting logs: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	buckets, err := db.GetLogHistogram(from, to, bucket)
+	if err != nil {
+		log.Printf("Error counting logs: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reply := StatsReply{From: from, To: to, Bucket: bucket.String(), Groups: groups, Buckets: buckets}
+	if reply.Groups == nil {
+		reply.Groups = []db.LogCount{}
+	}
+	if reply.Buckets == nil {
+		reply.Buckets = []db.LogBucket{}
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// IncidentsReply lists incidents
+type IncidentsReply struct {
+	Incidents []db.Incident `json:"incidents"`
+}
+
+// handleIncidents lists the incidents open at any time between the query parameters from and
+// to (the last day by default), most severe first
+func (s *Server) handleIncidents(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	incidents, err := db.GetIncidentsBetween(from, to)
+	if err != nil {
+		log.Printf("Error reading incidents: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if incidents == nil {
+		incidents = []db.Incident{}
+	}
+	writeJSON(w, http.StatusOK, IncidentsReply{Incidents: incidents})
+}
+
+// timeRange reads the RFC 3339 query parameters from and to, defaulting to the last
+// StatsRange
+func timeRange(r *http.Request) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	to = time.Now()
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid to %q, want RFC 3339", v)
+		}
+	}
+	from = to.Add(-shared.StatsRange)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid from %q, want RFC 3339", v)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
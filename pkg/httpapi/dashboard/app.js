@@ -0,0 +1,362 @@
+"use strict";
+
+// Histogram bucket per selectable range
+const BUCKETS = { "1h": "5m", "6h": "15m", "24h": "1h", "168h": "6h" };
+const SEVERITIES = ["critical", "error", "warn", "info", "debug", "other"];
+const FEED_ROWS = 100;
+const REFRESH_MS = 60000;
+
+const $ = (id) => document.getElementById(id);
+
+// severityClass maps the many spellings of a severity onto the dashboard's classes
+function severityClass(severity) {
+  const s = (severity || "").toUpperCase();
+  if (["CRITICAL", "CRIT", "FATAL", "EMERGENCY", "EMERG", "ALERT"].includes(s)) return "critical";
+  if (["ERROR", "ERR"].includes(s)) return "error";
+  if (["WARN", "WARNING"].includes(s)) return "warn";
+  if (["INFO", "NOTICE", "INFORMATIONAL"].includes(s)) return "info";
+  if (["DEBUG", "TRACE"].includes(s)) return "debug";
+  return "other";
+}
+
+// el creates an element with text content, so log text is never interpreted as HTML
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) e.textContent = String(text);
+  if (className) e.className = className;
+  return e;
+}
+
+function severityBadge(severity) {
+  return el("span", severity || "?", "sev " + severityClass(severity));
+}
+
+function riskCell(risk) {
+  const td = el("td", risk ? risk : "-", "num");
+  if (risk >= 70) td.classList.add("risk-high");
+  else if (risk >= 40) td.classList.add("risk-medium");
+  return td;
+}
+
+function formatTime(value) {
+  const d = new Date(value);
+  return isNaN(d) ? value : d.toLocaleString();
+}
+
+async function getJSON(url) {
+  const res = await fetch(url);
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error || res.statusText);
+  return body;
+}
+
+function rangeParams() {
+  const range = $("range").value;
+  const to = new Date();
+  const from = new Date(to.getTime() - parseInt(range, 10) * 3600 * 1000);
+  return { from: from.toISOString().replace(/\.\d+Z$/, "Z"), to: to.toISOString().replace(/\.\d+Z$/, "Z"), bucket: BUCKETS[range] };
+}
+
+// logRow renders a log shaped like the analysis reply
+function logRow(reply) {
+  const msg = reply.original_message || {};
+  const analysis = reply.structured || {};
+  const tr = document.createElement("tr");
+  tr.append(
+    el("td", reply.log_id),
+    el("td", msg.hostname),
+    el("td", msg.service),
+    document.createElement("td"),
+    riskCell(analysis.risk_score),
+    el("td", msg.message, "message"),
+    el("td", analysis.summary || reply.analysis, "analysis"),
+  );
+  tr.children[3].append(severityBadge(msg.severity));
+  tr.children[5].title = msg.message || "";
+  tr.addEventListener("click", () => showLog(reply.log_id));
+  return tr;
+}
+
+// Summary cards, chart and service breakdown
+
+async function loadStats() {
+  const p = rangeParams();
+  const stats = await getJSON(`stats?from=${p.from}&to=${p.to}&bucket=${p.bucket}`);
+
+  let total = 0, errors = 0, maxRisk = 0;
+  const services = new Map();
+  for (const g of stats.groups) {
+    total += g.count;
+    const cls = severityClass(g.severity);
+    if (cls === "critical" || cls === "error") errors += g.count;
+    maxRisk = Math.max(maxRisk, g.max_risk);
+
+    const s = services.get(g.service) || { service: g.service, count: 0, hosts: 0, maxRisk: 0, severities: [] };
+    s.count += g.count;
+    s.hosts = Math.max(s.hosts, g.hosts); // Hosts are counted per severity, so this is a lower bound
+    s.maxRisk = Math.max(s.maxRisk, g.max_risk);
+    s.severities.push(g);
+    services.set(g.service, s);
+  }
+  $("total").textContent = total;
+  $("errors").textContent = errors;
+  $("max-risk").textContent = maxRisk || "-";
+
+  const tbody = $("services").querySelector("tbody");
+  tbody.replaceChildren();
+  for (const s of [...services.values()].sort((a, b) => b.count - a.count)) {
+    const tr = document.createElement("tr");
+    const sevs = document.createElement("td");
+    for (const g of s.severities) {
+      const badge = severityBadge(`${g.severity} ${g.count}`);
+      sevs.append(badge);
+    }
+    tr.append(el("td", s.service), sevs, el("td", s.count, "num"), el("td", s.hosts, "num"), riskCell(s.maxRisk));
+    tr.style.cursor = "pointer";
+    tr.addEventListener("click", () => search({ service: s.service }));
+    tbody.append(tr);
+  }
+  if (services.size === 0) {
+    const tr = document.createElement("tr");
+    const td = el("td", "No logs in this range.", "empty");
+    td.colSpan = 5;
+    tr.append(td);
+    tbody.append(tr);
+  }
+
+  drawChart(stats);
+}
+
+// drawChart stacks the logs of every bucket by severity
+function drawChart(stats) {
+  const bucketMs = parseDuration(stats.bucket);
+  const from = new Date(stats.from).getTime();
+  const to = new Date(stats.to).getTime();
+  const first = Math.floor(from / bucketMs) * bucketMs;
+  const count = Math.max(1, Math.ceil((to - first) / bucketMs));
+
+  const columns = Array.from({ length: count }, () => Object.fromEntries(SEVERITIES.map((s) => [s, 0])));
+  for (const b of stats.buckets) {
+    const i = Math.floor((new Date(b.start).getTime() - first) / bucketMs);
+    if (i >= 0 && i < count) columns[i][severityClass(b.severity)] += b.count;
+  }
+  const peak = Math.max(1, ...columns.map((c) => SEVERITIES.reduce((n, s) => n + c[s], 0)));
+
+  const width = 1000, height = 180, top = 10, bottom = 20, left = 40;
+  const barWidth = (width - left) / count;
+  const scale = (height - top - bottom) / peak;
+  const ns = "http://www.w3.org/2000/svg";
+  const svg = document.createElementNS(ns, "svg");
+  svg.setAttribute("viewBox", `0 0 ${width} ${height}`);
+  svg.setAttribute("preserveAspectRatio", "none");
+
+  const label = (x, y, text, anchor) => {
+    const t = document.createElementNS(ns, "text");
+    t.setAttribute("x", x);
+    t.setAttribute("y", y);
+    t.setAttribute("text-anchor", anchor);
+    t.textContent = text;
+    svg.append(t);
+  };
+  label(left - 4, top + 8, peak, "end");
+  label(left - 4, height - bottom, 0, "end");
+
+  columns.forEach((c, i) => {
+    let y = height - bottom;
+    const start = new Date(first + i * bucketMs);
+    for (const s of SEVERITIES) {
+      if (!c[s]) continue;
+      const h = c[s] * scale;
+      y -= h;
+      const rect = document.createElementNS(ns, "rect");
+      rect.setAttribute("x", left + i * barWidth + 1);
+      rect.setAttribute("y", y);
+      rect.setAttribute("width", Math.max(1, barWidth - 2));
+      rect.setAttribute("height", h);
+      rect.style.fill = `var(--${s})`;
+      const title = document.createElementNS(ns, "title");
+      title.textContent = `${start.toLocaleString()}: ${c[s]} ${s}`;
+      rect.append(title);
+      svg.append(rect);
+    }
+    if (i % Math.ceil(count / 8) === 0) {
+      label(left + i * barWidth, height - 5, start.toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" }), "start");
+    }
+  });
+
+  $("chart").replaceChildren(svg);
+  $("legend").replaceChildren(...SEVERITIES.map((s) => {
+    const span = el("span", s);
+    span.style.setProperty("--swatch", `var(--${s})`);
+    return span;
+  }));
+}
+
+// parseDuration reads the Go durations the stats endpoint reports, e.g. "1h0m0s"
+function parseDuration(text) {
+  const units = { h: 3600e3, m: 60e3, s: 1e3 };
+  let ms = 0;
+  for (const [, n, unit] of text.matchAll(/(\d+(?:\.\d+)?)(h|m|s)/g)) ms += parseFloat(n) * units[unit];
+  return ms || 3600e3;
+}
+
+// Incidents
+
+async function loadIncidents() {
+  const p = rangeParams();
+  const { incidents } = await getJSON(`incidents?from=${p.from}&to=${p.to}`);
+  $("open-incidents").textContent = incidents.filter((i) => i.status === "open").length;
+
+  const list = $("incidents");
+  list.replaceChildren();
+  for (const inc of incidents) {
+    const li = document.createElement("li");
+    const title = el("div");
+    title.append(el("strong", `#${inc.id} `), el("span", inc.title));
+    const meta = el("div", "", "meta");
+    meta.append(
+      el("span", inc.status, inc.status === "open" ? "open" : ""),
+      el("span", ` · ${inc.entries} logs · risk ${inc.max_risk || "-"} · opened ${formatTime(inc.opened_at)}`),
+    );
+    li.append(title, meta);
+    if (inc.summary) li.append(el("div", inc.summary));
+    li.addEventListener("click", () => search({ incident_id: inc.id }));
+    list.append(li);
+  }
+  if (incidents.length === 0) list.append(el("li", "No incidents in this range.", "empty"));
+}
+
+// Live feed
+
+function connectFeed() {
+  const live = $("live");
+  const source = new EventSource("stream");
+  source.onopen = () => {
+    live.textContent = "live";
+    live.className = "live on";
+  };
+  source.onerror = () => {
+    live.textContent = "reconnecting";
+    live.className = "live off";
+  };
+  source.addEventListener("analysis", (event) => {
+    const reply = JSON.parse(event.data);
+    const tbody = $("feed").querySelector("tbody");
+    const row = logRow(reply);
+    row.classList.add("fresh");
+    tbody.prepend(row);
+    while (tbody.children.length > FEED_ROWS) tbody.lastChild.remove();
+    $("feed-empty").hidden = true;
+  });
+}
+
+// Search
+
+let nextCursor = null;
+
+async function search(filters, cursor) {
+  const form = $("search");
+  if (filters) {
+    for (const input of form.elements) {
+      if (input.name) input.value = filters[input.name] ?? "";
+    }
+  }
+  const params = new URLSearchParams();
+  for (const input of form.elements) {
+    if (input.name && input.value.trim()) params.set(input.name, input.value.trim());
+  }
+  params.set("limit", "50");
+  if (cursor) params.set("cursor", cursor);
+
+  const tbody = $("results").querySelector("tbody");
+  if (!cursor) tbody.replaceChildren();
+  try {
+    const reply = await getJSON(`logs?${params}`);
+    for (const log of reply.logs) tbody.append(logRow(log));
+    nextCursor = reply.next_cursor || null;
+    $("more").hidden = !nextCursor;
+    $("results-empty").hidden = tbody.children.length > 0;
+    $("results-empty").textContent = "No matching logs.";
+  } catch (err) {
+    $("results-empty").hidden = false;
+    $("results-empty").textContent = `Search failed: ${err.message}`;
+  }
+  if (filters) form.scrollIntoView({ behavior: "smooth" });
+}
+
+// Log detail
+
+async function showLog(id) {
+  const body = $("detail-body");
+  body.replaceChildren(el("p", "Loading...", "empty"));
+  $("detail").hidden = false;
+
+  let reply;
+  try {
+    reply = await getJSON(`logs/${id}`);
+  } catch (err) {
+    body.replaceChildren(el("p", `Failed to load log ${id}: ${err.message}`, "empty"));
+    return;
+  }
+  const msg = reply.original_message || {};
+  const analysis = reply.structured;
+
+  const fields = (pairs) => {
+    const dl = document.createElement("dl");
+    for (const [k, v] of pairs) {
+      if (v === undefined || v === null || v === "" || v === 0) continue;
+      dl.append(el("dt", k), el("dd", typeof v === "object" ? JSON.stringify(v) : v));
+    }
+    return dl;
+  };
+
+  const title = el("h2", `Log ${reply.log_id} `);
+  title.append(severityBadge(msg.severity));
+  body.replaceChildren(
+    title,
+    el("pre", msg.message),
+    fields([["Timestamp", msg.timestamp], ["Host", msg.hostname], ["Service", msg.service], ["Provider", reply.provider],
+      ["Reused analysis", reply.cached ? "yes" : "no"], ["Template", reply.template_id], ["Cluster", reply.cluster_id],
+      ["Incident", reply.incident_id]]),
+  );
+
+  body.append(el("h3", "Context"));
+  const context = msg.context && Object.keys(msg.context).length ? Object.entries(msg.context) : null;
+  body.append(context ? fields(context) : el("p", "No context.", "empty"));
+
+  body.append(el("h3", "Analysis"));
+  if (analysis) {
+    body.append(fields([["Summary", analysis.summary], ["Root cause", analysis.root_cause], ["Category", analysis.category],
+      ["Risk", analysis.risk_score], ["Confidence", analysis.confidence]]));
+    if (analysis.recommended_actions && analysis.recommended_actions.length) {
+      body.append(el("h3", "Recommended actions"));
+      const ol = document.createElement("ol");
+      for (const action of analysis.recommended_actions) ol.append(el("li", action));
+      body.append(ol);
+    }
+  }
+  body.append(el("h3", "Raw analysis"), el("pre", reply.analysis || "None"));
+}
+
+// Wiring
+
+function refresh() {
+  loadStats().catch((err) => console.error("Failed to load stats:", err));
+  loadIncidents().catch((err) => console.error("Failed to load incidents:", err));
+}
+
+$("range").addEventListener("change", refresh);
+$("search").addEventListener("submit", (event) => {
+  event.preventDefault();
+  search();
+});
+$("more").addEventListener("click", () => search(null, nextCursor));
+$("close").addEventListener("click", () => { $("detail").hidden = true; });
+document.addEventListener("keydown", (event) => {
+  if (event.key === "Escape") $("detail").hidden = true;
+});
+
+refresh();
+setInterval(refresh, REFRESH_MS);
+connectFeed();
+search();
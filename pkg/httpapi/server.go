@@ -0,0 +1,278 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// Server exposes log ingestion, stored analyses, a live analysis feed and the dashboard over
+// HTTP for clients that cannot speak NATS
+type Server struct {
+	nc   *nats.Conn
+	js   nats.JetStreamContext
+	http *http.Server
+	done chan struct{} // Closed on shutdown to end open event streams
+	once sync.Once
+	errs chan error // Receives the error that stopped serving, if any
+}
+
+// NewServer creates a server listening on addr that publishes and subscribes through nc
+func NewServer(addr string, nc *nats.Conn) (*Server, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	s := &Server{nc: nc, js: js, done: make(chan struct{}), errs: make(chan error, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /logs", s.handlePostLogs)
+	mux.HandleFunc("GET /logs", s.handleGetLogs)
+	mux.HandleFunc("GET /logs/{id}", s.handleGetLog)
+	mux.HandleFunc("GET /stream", s.handleStream)
+	mux.HandleFunc("GET /stats", s.handleStats)
+	mux.HandleFunc("GET /incidents", s.handleIncidents)
+	mux.Handle("GET /", dashboard())
+	s.http = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// Start listens on the server's address and serves HTTP in the background until Shutdown is
+// called. An error that stops serving later is sent on Errors.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for HTTP on %s: %w", s.http.Addr, err)
+	}
+	log.Printf("HTTP API listening on %s", ln.Addr())
+	go func() {
+		if err := s.http.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.errs <- fmt.Errorf("HTTP server failed: %w", err)
+		}
+	}()
+	return nil
+}
+
+// Errors receives the error that made the server stop serving
+func (s *Server) Errors() <-chan error {
+	return s.errs
+}
+
+// Shutdown ends open event streams and waits for other requests to finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.once.Do(func() { close(s.done) })
+	return s.http.Shutdown(ctx)
+}
+
+// PublishReply acknowledges logs accepted for analysis
+type PublishReply struct {
+	Accepted  int      `json:"accepted"`
+	Sequences []uint64 `json:"sequences"` // Stream sequence of each log, in request order
+}
+
+// handlePostLogs publishes a log, or a JSON array of logs, for analysis. The logs are
+// persisted in the stream before the request is answered; the analyses follow on /stream.
+func (s *Server) handlePostLogs(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, shared.HTTPMaxBody))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, fmt.Sprintf("failed to read body: %v", err))
+		return
+	}
+
+	var raw []json.RawMessage
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid log array: %v", err))
+			return
+		}
+	} else {
+		raw = []json.RawMessage{trimmed}
+	}
+	if len(raw) == 0 {
+		writeError(w, http.StatusBadRequest, "no logs in request")
+		return
+	}
+
+	// Validate every log before publishing any, so a bad request publishes nothing
+	for i, data := range raw {
+		var logMsg agent.LogMessage
+		if err := json.Unmarshal(data, &logMsg); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid log %d: %v", i, err))
+			return
+		}
+		if logMsg.Message == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("log %d has no message", i))
+			return
+		}
+	}
+
+	reply := PublishReply{Sequences: make([]uint64, 0, len(raw))}
+	for _, data := range raw {
+		ack, err := s.js.Publish(shared.SubjectName, data, nats.Context(r.Context()))
+		if err != nil {
+			log.Printf("Error publishing log from %s: %v", r.RemoteAddr, err)
+			writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("failed to publish log: %v", err))
+			return
+		}
+		reply.Accepted++
+		reply.Sequences = append(reply.Sequences, ack.Sequence)
+	}
+	writeJSON(w, http.StatusAccepted, reply)
+}
+
+// LogsReply is one page of stored logs
+type LogsReply struct {
+	Logs       []agent.AnalysisReply `json:"logs"`
+	NextCursor string                `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// handleGetLogs lists stored logs, filtered by the query parameters from, to, hostname,
+// service, severity, text and incident_id and paged with order, cursor and limit
+func (s *Server) handleGetLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := agent.LogQuery{
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		Hostname: q.Get("hostname"),
+		Service:  q.Get("service"),
+		Severity: q.Get("severity"),
+		Text:     q.Get("text"),
+		Order:    q.Get("order"),
+		Cursor:   q.Get("cursor"),
+	}
+	var err error
+	if v := q.Get("incident_id"); v != "" {
+		if query.IncidentID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid incident_id %q", v))
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit %q", v))
+			return
+		}
+	}
+
+	filter, err := query.Filter()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entries, next, err := db.QueryLogEntries(filter)
+	if err != nil {
+		log.Printf("Error querying logs: %v", err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reply := LogsReply{Logs: make([]agent.AnalysisReply, 0, len(entries))}
+	for _, e := range entries {
+		reply.Logs = append(reply.Logs, agent.EntryReply(e))
+	}
+	if next != 0 {
+		reply.NextCursor = strconv.FormatInt(next, 10)
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// handleGetLog returns one stored log and its analysis
+func (s *Server) handleGetLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid log ID %q", r.PathValue("id")))
+		return
+	}
+	entry, err := db.GetLogEntry(id)
+	if err != nil {
+		log.Printf("Error reading log %d: %v", id, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entry == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("log %d not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, agent.EntryReply(*entry))
+}
+
+// handleStream sends every new analysis as a Server-Sent Event until the client goes away
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	msgs := make(chan *nats.Msg, shared.HTTPStreamBuffer)
+	sub, err := s.nc.ChanSubscribe(shared.AnalysisSubjectName, msgs)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("failed to subscribe to analyses: %v", err))
+		return
+	}
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(shared.HTTPHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case msg := <-msgs:
+			var reply struct {
+				LogID int64 `json:"log_id"`
+			}
+			json.Unmarshal(msg.Data, &reply)
+			fmt.Fprintf(w, "id: %d\nevent: analysis\ndata: %s\n\n", reply.LogID, msg.Data)
+		}
+		flusher.Flush()
+	}
+}
+
+// writeJSON sends a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing HTTP response: %v", err)
+	}
+}
+
+// writeError sends a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
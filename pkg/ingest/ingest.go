@@ -0,0 +1,38 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// Publisher hands logs received from other protocols to the agent pipeline by publishing
+// them into the stream as LogMessage JSON
+type Publisher struct {
+	js nats.JetStreamContext
+}
+
+// NewPublisher creates a publisher on nc
+func NewPublisher(nc *nats.Conn) (*Publisher, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	return &Publisher{js: js}, nil
+}
+
+// Publish persists a log in the stream for analysis
+func (p *Publisher) Publish(ctx context.Context, logMsg agent.LogMessage) error {
+	data, err := json.Marshal(logMsg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log: %w", err)
+	}
+	if _, err := p.js.Publish(shared.SubjectName, data, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to publish log: %w", err)
+	}
+	return nil
+}
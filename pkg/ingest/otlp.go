@@ -0,0 +1,293 @@
+package ingest
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/shared"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // Accept gzip compressed gRPC exports
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// OTLPConfig selects the OTLP receivers to open. Empty addresses are not listened on.
+type OTLPConfig struct {
+	GRPCAddr string // OTLP/gRPC, conventionally :4317
+	HTTPAddr string // OTLP/HTTP, conventionally :4318
+}
+
+// OTLPServer receives OpenTelemetry log exports over OTLP/gRPC and OTLP/HTTP and publishes
+// them for analysis
+type OTLPServer struct {
+	config    OTLPConfig
+	publisher *Publisher
+	grpc      *grpc.Server
+	http      *http.Server
+	wg        sync.WaitGroup
+}
+
+// NewOTLPServer creates an OTLP receiver publishing through publisher
+func NewOTLPServer(cfg OTLPConfig, publisher *Publisher) (*OTLPServer, error) {
+	if cfg.GRPCAddr == "" && cfg.HTTPAddr == "" {
+		return nil, fmt.Errorf("no OTLP listen address configured")
+	}
+	return &OTLPServer{config: cfg, publisher: publisher}, nil
+}
+
+// Start opens the configured receivers
+func (s *OTLPServer) Start() error {
+	if s.config.GRPCAddr != "" {
+		ln, err := net.Listen("tcp", s.config.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for OTLP/gRPC on %s: %w", s.config.GRPCAddr, err)
+		}
+		s.grpc = grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.MaxRecvMsgSize(shared.OTLPMaxBody))
+		s.grpc.RegisterService(&logsServiceDesc, s)
+		log.Printf("Receiving OTLP/gRPC logs on %s", ln.Addr())
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.grpc.Serve(ln); err != nil {
+				log.Printf("Error serving OTLP/gRPC: %v", err)
+			}
+		}()
+	}
+	if s.config.HTTPAddr != "" {
+		ln, err := net.Listen("tcp", s.config.HTTPAddr)
+		if err != nil {
+			s.Stop(context.Background())
+			return fmt.Errorf("failed to listen for OTLP/HTTP on %s: %w", s.config.HTTPAddr, err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/logs", s.handleHTTP)
+		s.http = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		log.Printf("Receiving OTLP/HTTP logs on %s", ln.Addr())
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.http.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Error serving OTLP/HTTP: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Stop stops accepting exports and waits for those in progress until ctx is done
+func (s *OTLPServer) Stop(ctx context.Context) {
+	if s.http != nil {
+		if err := s.http.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down OTLP/HTTP: %v", err)
+		}
+	}
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+	s.wg.Wait()
+}
+
+// errPublish marks exports that were valid but could not be published, which senders may
+// retry
+var errPublish = errors.New("failed to publish logs")
+
+// export publishes the records of a decoded request and returns how many were rejected
+func (s *OTLPServer) export(ctx context.Context, req *otlpRequest, source string) (int64, error) {
+	logs, rejected := otlpLogs(req, source, time.Now())
+	for _, logMsg := range logs {
+		if err := s.publisher.Publish(ctx, logMsg); err != nil {
+			log.Printf("Error publishing OTLP logs from %s: %v", source, err)
+			return rejected, fmt.Errorf("%w: %v", errPublish, err)
+		}
+	}
+	return rejected, nil
+}
+
+// rejectedMessage explains a partial success to the sender
+func rejectedMessage(rejected int64) string {
+	return fmt.Sprintf("dropped %d log records without a body", rejected)
+}
+
+// handleHTTP accepts an ExportLogsServiceRequest as protobuf or JSON, optionally gzip
+// compressed, and answers in the same encoding
+func (s *OTLPServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isJSON := mediaType == "application/json"
+	if !isJSON && mediaType != "application/x-protobuf" {
+		writeOTLPError(w, false, http.StatusUnsupportedMediaType, codes.InvalidArgument,
+			fmt.Sprintf("unsupported content type %q, want application/x-protobuf or application/json", mediaType))
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, shared.OTLPMaxBody)
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			writeOTLPError(w, isJSON, http.StatusBadRequest, codes.InvalidArgument, fmt.Sprintf("invalid gzip body: %v", err))
+			return
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, shared.OTLPMaxBody+1)
+	default:
+		writeOTLPError(w, isJSON, http.StatusUnsupportedMediaType, codes.InvalidArgument,
+			fmt.Sprintf("unsupported content encoding %q", r.Header.Get("Content-Encoding")))
+		return
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeOTLPError(w, isJSON, status, codes.InvalidArgument, fmt.Sprintf("failed to read body: %v", err))
+		return
+	}
+	if len(data) > shared.OTLPMaxBody {
+		writeOTLPError(w, isJSON, http.StatusRequestEntityTooLarge, codes.InvalidArgument,
+			fmt.Sprintf("body larger than %d bytes", shared.OTLPMaxBody))
+		return
+	}
+
+	var req *otlpRequest
+	if isJSON {
+		req, err = decodeOTLPJSON(data)
+	} else {
+		req, err = decodeOTLPProtobuf(data)
+	}
+	if err != nil {
+		writeOTLPError(w, isJSON, http.StatusBadRequest, codes.InvalidArgument, err.Error())
+		return
+	}
+
+	rejected, err := s.export(r.Context(), req, r.RemoteAddr)
+	if err != nil {
+		writeOTLPError(w, isJSON, http.StatusServiceUnavailable, codes.Unavailable, err.Error())
+		return
+	}
+
+	if isJSON {
+		reply := map[string]interface{}{}
+		if rejected > 0 {
+			reply["partialSuccess"] = map[string]interface{}{
+				"rejectedLogRecords": strconv.FormatInt(rejected, 10),
+				"errorMessage":       rejectedMessage(rejected),
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(reply)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+	if rejected > 0 {
+		w.Write(encodeExportResponse(rejected, rejectedMessage(rejected)))
+	}
+}
+
+// writeOTLPError answers a failed OTLP/HTTP export with a google.rpc.Status in the request's
+// encoding
+func writeOTLPError(w http.ResponseWriter, isJSON bool, status int, code codes.Code, message string) {
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(status)
+	w.Write(encodeStatus(int32(code), message))
+}
+
+// logsServer is the OTLP/gRPC logs service, implemented by OTLPServer
+type logsServer interface {
+	exportGRPC(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// logsServiceDesc registers opentelemetry.proto.collector.logs.v1.LogsService without
+// generated code; messages stay encoded and are decoded by decodeOTLPProtobuf
+var logsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.logs.v1.LogsService",
+	HandlerType: (*logsServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Export",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			var data []byte
+			if err := dec(&data); err != nil {
+				return nil, err
+			}
+			return srv.(logsServer).exportGRPC(ctx, data)
+		},
+	}},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "opentelemetry/proto/collector/logs/v1/logs_service.proto",
+}
+
+// exportGRPC handles an OTLP/gRPC Export call
+func (s *OTLPServer) exportGRPC(ctx context.Context, data []byte) ([]byte, error) {
+	source := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		source = p.Addr.String()
+	}
+	req, err := decodeOTLPProtobuf(data)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rejected, err := s.export(ctx, req, source)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return encodeExportResponse(rejected, rejectedMessage(rejected)), nil
+}
+
+// rawCodec passes gRPC messages through as bytes
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		return *b, nil
+	}
+	return nil, fmt.Errorf("cannot marshal %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name is the content subtype OTLP clients send, application/grpc+proto
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,368 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The OTLP logs data model, as far as the agent uses it. Both the protobuf and the JSON
+// encodings of an ExportLogsServiceRequest decode into these types.
+
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         otlpUint64     `json:"timeUnixNano"`
+	ObservedTimeUnixNano otlpUint64     `json:"observedTimeUnixNano"`
+	SeverityNumber       int32          `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 *otlpAnyValue  `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              otlpID         `json:"traceId"`
+	SpanID               otlpID         `json:"spanId"`
+	EventName            string         `json:"eventName"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue holds one of the OTLP attribute value kinds
+type otlpAnyValue struct {
+	StringValue *string        `json:"stringValue"`
+	BoolValue   *bool          `json:"boolValue"`
+	IntValue    *otlpInt64     `json:"intValue"`
+	DoubleValue *float64       `json:"doubleValue"`
+	ArrayValue  *otlpArray     `json:"arrayValue"`
+	KvlistValue *otlpKeyValues `json:"kvlistValue"`
+	BytesValue  []byte         `json:"bytesValue"` // base64 in JSON
+}
+
+type otlpArray struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKeyValues struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// otlpUint64 and otlpInt64 accept the JSON encoding's decimal strings as well as numbers
+type otlpUint64 uint64
+
+func (n *otlpUint64) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseUint(unquote(data), 10, 64)
+	*n = otlpUint64(v)
+	return err
+}
+
+type otlpInt64 int64
+
+func (n *otlpInt64) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(unquote(data), 10, 64)
+	*n = otlpInt64(v)
+	return err
+}
+
+// otlpID is a trace or span ID, raw bytes in protobuf and hex in JSON
+type otlpID string
+
+func (id *otlpID) UnmarshalJSON(data []byte) error {
+	*id = otlpID(unquote(data))
+	return nil
+}
+
+// unquote strips the quotes from a JSON string token, leaving numbers as they are
+func unquote(data []byte) string {
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		return string(data[1 : len(data)-1])
+	}
+	return string(data)
+}
+
+// value converts an attribute value to the plain Go value stored in a log's Context
+func (v *otlpAnyValue) value() interface{} {
+	switch {
+	case v == nil:
+		return nil
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for i := range v.ArrayValue.Values {
+			values = append(values, v.ArrayValue.Values[i].value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return attributeMap(v.KvlistValue.Values)
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	}
+	return nil
+}
+
+// attributeMap converts OTLP attributes to a map
+func attributeMap(attrs []otlpKeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for i := range attrs {
+		m[attrs[i].Key] = attrs[i].Value.value()
+	}
+	return m
+}
+
+// decodeOTLPJSON decodes the OTLP/JSON encoding of an ExportLogsServiceRequest
+func decodeOTLPJSON(data []byte) (*otlpRequest, error) {
+	var req otlpRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("invalid OTLP JSON: %w", err)
+	}
+	return &req, nil
+}
+
+// decodeOTLPProtobuf decodes the protobuf encoding of an ExportLogsServiceRequest
+func decodeOTLPProtobuf(data []byte) (*otlpRequest, error) {
+	var req otlpRequest
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num == 1 && typ == protowire.BytesType {
+			var rl otlpResourceLogs
+			if err := decodeResourceLogs(v, &rl); err != nil {
+				return err
+			}
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP protobuf: %w", err)
+	}
+	return &req, nil
+}
+
+func decodeResourceLogs(data []byte, rl *otlpResourceLogs) error {
+	return walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 && typ == protowire.BytesType {
+					return appendKeyValue(v, &rl.Resource.Attributes)
+				}
+				return nil
+			})
+		case num == 2 && typ == protowire.BytesType:
+			var sl otlpScopeLogs
+			if err := decodeScopeLogs(v, &sl); err != nil {
+				return err
+			}
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		return nil
+	})
+}
+
+func decodeScopeLogs(data []byte, sl *otlpScopeLogs) error {
+	return walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					sl.Scope.Name = string(v)
+				case num == 2 && typ == protowire.BytesType:
+					sl.Scope.Version = string(v)
+				}
+				return nil
+			})
+		case num == 2 && typ == protowire.BytesType:
+			var rec otlpLogRecord
+			if err := decodeLogRecord(v, &rec); err != nil {
+				return err
+			}
+			sl.LogRecords = append(sl.LogRecords, rec)
+		}
+		return nil
+	})
+}
+
+func decodeLogRecord(data []byte, rec *otlpLogRecord) error {
+	return walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			rec.TimeUnixNano = otlpUint64(n)
+		case num == 11 && typ == protowire.Fixed64Type:
+			rec.ObservedTimeUnixNano = otlpUint64(n)
+		case num == 2 && typ == protowire.VarintType:
+			rec.SeverityNumber = int32(n)
+		case num == 3 && typ == protowire.BytesType:
+			rec.SeverityText = string(v)
+		case num == 5 && typ == protowire.BytesType:
+			rec.Body = &otlpAnyValue{}
+			return decodeAnyValue(v, rec.Body)
+		case num == 6 && typ == protowire.BytesType:
+			return appendKeyValue(v, &rec.Attributes)
+		case num == 9 && typ == protowire.BytesType:
+			rec.TraceID = otlpID(fmt.Sprintf("%x", v))
+		case num == 10 && typ == protowire.BytesType:
+			rec.SpanID = otlpID(fmt.Sprintf("%x", v))
+		case num == 12 && typ == protowire.BytesType:
+			rec.EventName = string(v)
+		}
+		return nil
+	})
+}
+
+func appendKeyValue(data []byte, attrs *[]otlpKeyValue) error {
+	var kv otlpKeyValue
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			kv.Key = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			return decodeAnyValue(v, &kv.Value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*attrs = append(*attrs, kv)
+	return nil
+}
+
+func decodeAnyValue(data []byte, av *otlpAnyValue) error {
+	return walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			s := string(v)
+			av.StringValue = &s
+		case num == 2 && typ == protowire.VarintType:
+			b := n != 0
+			av.BoolValue = &b
+		case num == 3 && typ == protowire.VarintType:
+			i := otlpInt64(int64(n))
+			av.IntValue = &i
+		case num == 4 && typ == protowire.Fixed64Type:
+			f := math.Float64frombits(n)
+			av.DoubleValue = &f
+		case num == 5 && typ == protowire.BytesType:
+			av.ArrayValue = &otlpArray{}
+			return walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 && typ == protowire.BytesType {
+					var elem otlpAnyValue
+					if err := decodeAnyValue(v, &elem); err != nil {
+						return err
+					}
+					av.ArrayValue.Values = append(av.ArrayValue.Values, elem)
+				}
+				return nil
+			})
+		case num == 6 && typ == protowire.BytesType:
+			av.KvlistValue = &otlpKeyValues{}
+			return walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 && typ == protowire.BytesType {
+					return appendKeyValue(v, &av.KvlistValue.Values)
+				}
+				return nil
+			})
+		case num == 7 && typ == protowire.BytesType:
+			av.BytesValue = append([]byte{}, v...)
+		}
+		return nil
+	})
+}
+
+// walkMessage calls fn for every field of a protobuf message, with the contents of
+// length-delimited fields in v and the value of numeric fields in n. Unknown fields are
+// skipped, so newer OTLP versions still decode.
+func walkMessage(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(data) > 0 {
+		num, typ, tagLen := protowire.ConsumeTag(data)
+		if tagLen < 0 {
+			return protowire.ParseError(tagLen)
+		}
+		data = data[tagLen:]
+
+		var v []byte
+		var n uint64
+		var fieldLen int
+		switch typ {
+		case protowire.VarintType:
+			n, fieldLen = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			n, fieldLen = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var n32 uint32
+			n32, fieldLen = protowire.ConsumeFixed32(data)
+			n = uint64(n32)
+		case protowire.BytesType:
+			v, fieldLen = protowire.ConsumeBytes(data)
+		default:
+			fieldLen = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if fieldLen < 0 {
+			return protowire.ParseError(fieldLen)
+		}
+		data = data[fieldLen:]
+
+		if err := fn(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeExportResponse encodes an ExportLogsServiceResponse, reporting rejected records as a
+// partial success
+func encodeExportResponse(rejected int64, message string) []byte {
+	if rejected == 0 {
+		return nil
+	}
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, uint64(rejected))
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, message)
+
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	return protowire.AppendBytes(resp, partial)
+}
+
+// encodeStatus encodes a google.rpc.Status, the body of a failed OTLP/HTTP request
+func encodeStatus(code int32, message string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(code))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendString(b, message)
+}
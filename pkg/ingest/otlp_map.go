@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/agent"
+)
+
+// otlpSeverities names the OTLP severity number ranges, four numbers per name starting at 1
+var otlpSeverities = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+// otlpLogs converts the records of an export request into log messages. Records without a
+// body are dropped and counted as rejected.
+func otlpLogs(req *otlpRequest, source string, received time.Time) ([]agent.LogMessage, int64) {
+	var logs []agent.LogMessage
+	var rejected int64
+	for _, rl := range req.ResourceLogs {
+		resource := attributeMap(rl.Resource.Attributes)
+		for _, sl := range rl.ScopeLogs {
+			for i := range sl.LogRecords {
+				logMsg, ok := otlpLog(&sl.LogRecords[i], resource, sl.Scope, source, received)
+				if !ok {
+					rejected++
+					continue
+				}
+				logs = append(logs, logMsg)
+			}
+		}
+	}
+	return logs, rejected
+}
+
+// otlpLog maps one log record. host.name and service.name come from the resource, falling
+// back to the sender's address and the instrumentation scope.
+func otlpLog(rec *otlpLogRecord, resource map[string]interface{}, scope otlpScope, source string, received time.Time) (agent.LogMessage, bool) {
+	message := otlpBody(rec.Body)
+	if strings.TrimSpace(message) == "" {
+		return agent.LogMessage{}, false
+	}
+
+	logMsg := agent.LogMessage{
+		Timestamp: received.Format(time.RFC3339Nano),
+		Hostname:  sourceHost(source),
+		Severity:  otlpSeverity(rec.SeverityNumber, rec.SeverityText),
+		Service:   scope.Name,
+		Message:   message,
+		Context:   attributeMap(rec.Attributes),
+	}
+	if host, ok := resource["host.name"].(string); ok && host != "" {
+		logMsg.Hostname = host
+	}
+	if service, ok := resource["service.name"].(string); ok && service != "" {
+		logMsg.Service = service
+	}
+	if rec.TimeUnixNano != 0 {
+		logMsg.Timestamp = time.Unix(0, int64(rec.TimeUnixNano)).UTC().Format(time.RFC3339Nano)
+	} else if rec.ObservedTimeUnixNano != 0 {
+		logMsg.Timestamp = time.Unix(0, int64(rec.ObservedTimeUnixNano)).UTC().Format(time.RFC3339Nano)
+	}
+
+	if len(resource) > 0 {
+		logMsg.Context["resource"] = resource
+	}
+	if scope.Name != "" {
+		scopeInfo := map[string]interface{}{"name": scope.Name}
+		if scope.Version != "" {
+			scopeInfo["version"] = scope.Version
+		}
+		logMsg.Context["scope"] = scopeInfo
+	}
+	if rec.TraceID != "" {
+		logMsg.Context["trace_id"] = string(rec.TraceID)
+	}
+	if rec.SpanID != "" {
+		logMsg.Context["span_id"] = string(rec.SpanID)
+	}
+	if rec.EventName != "" {
+		logMsg.Context["event_name"] = rec.EventName
+	}
+	logMsg.Context["protocol"] = "otlp"
+	logMsg.Context["source"] = source
+	return logMsg, true
+}
+
+// otlpBody returns a string body as is and any other body as JSON
+func otlpBody(body *otlpAnyValue) string {
+	if body == nil {
+		return ""
+	}
+	if body.StringValue != nil {
+		return *body.StringValue
+	}
+	v := body.value()
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// otlpSeverity maps a severity number to the agent's severity names, falling back to the
+// sender's severity text when the number is unspecified
+func otlpSeverity(number int32, text string) string {
+	if number >= 1 && number <= 24 {
+		return otlpSeverities[(number-1)/4]
+	}
+	if text != "" {
+		return strings.ToUpper(text)
+	}
+	return "INFO"
+}
@@ -0,0 +1,339 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	server "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/shared"
+	collectorlogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// startJetStream runs an in-process NATS server with the log stream and returns a
+// publisher on it together with a pull subscription to what it publishes
+func startJetStream(t *testing.T) (*Publisher, *nats.Subscription) {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create NATS server: %v", err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server failed to start")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: shared.StreamName, Subjects: []string{shared.SubjectName}}); err != nil {
+		t.Fatalf("failed to add stream: %v", err)
+	}
+	sub, err := js.PullSubscribe(shared.SubjectName, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher, err := NewPublisher(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publisher, sub
+}
+
+// published fetches the n logs published since the last call
+func published(t *testing.T, sub *nats.Subscription, n int) []agent.LogMessage {
+	t.Helper()
+	var logs []agent.LogMessage
+	for len(logs) < n {
+		msgs, err := sub.Fetch(n-len(logs), nats.MaxWait(5*time.Second))
+		if err != nil {
+			t.Fatalf("fetched %d of %d logs: %v", len(logs), n, err)
+		}
+		for _, msg := range msgs {
+			var logMsg agent.LogMessage
+			if err := json.Unmarshal(msg.Data, &logMsg); err != nil {
+				t.Fatalf("invalid published log: %v", err)
+			}
+			logs = append(logs, logMsg)
+			msg.Ack()
+		}
+	}
+	return logs
+}
+
+func stringValue(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+func attribute(key string, value *commonpb.AnyValue) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: value}
+}
+
+// marshalOTLPJSON encodes a message in OTLP/JSON, which differs from the canonical protobuf
+// JSON mapping in writing enums as numbers and trace and span IDs as hex instead of base64
+func marshalOTLPJSON(m proto.Message) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if err := hexIDs(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// hexIDs re-encodes the base64 traceId and spanId fields of decoded JSON as hex
+func hexIDs(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if id, ok := field.(string); ok && (key == "traceId" || key == "spanId") {
+				raw, err := base64.StdEncoding.DecodeString(id)
+				if err != nil {
+					return err
+				}
+				v[key] = hex.EncodeToString(raw)
+				continue
+			}
+			if err := hexIDs(field); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := hexIDs(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestOTLPHTTPExport(t *testing.T) {
+	publisher, sub := startJetStream(t)
+	receiver, err := NewOTLPServer(OTLPConfig{HTTPAddr: "127.0.0.1:0"}, publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, 10, 17, 8, 0, 0, 123456789, time.UTC)
+	traceID := []byte{0x5b, 0x8e, 0xfa, 0x23, 0xd3, 0x65, 0x4b, 0x7e, 0x9a, 0x1f, 0x3c, 0x0d, 0x42, 0x11, 0x8a, 0x6e}
+	spanID := []byte{0xeb, 0xa7, 0x31, 0x0c, 0x59, 0x62, 0x0f, 0x4d}
+	resource := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		attribute("service.name", stringValue("historian")),
+		attribute("host.name", stringValue("plc-01")),
+	}}
+	scope := &commonpb.InstrumentationScope{Name: "io.gogent.historian", Version: "1.4.0"}
+	wantResource := map[string]interface{}{"service.name": "historian", "host.name": "plc-01"}
+	wantScope := map[string]interface{}{"name": "io.gogent.historian", "version": "1.4.0"}
+	const source = "192.0.2.20:41000"
+
+	tests := []struct {
+		name     string
+		records  []*logspb.LogRecord
+		resource *resourcepb.Resource
+		want     []agent.LogMessage
+		rejected int64
+	}{
+		{
+			name:     "string body with attributes",
+			resource: resource,
+			records: []*logspb.LogRecord{{
+				TimeUnixNano:   uint64(at.UnixNano()),
+				SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR2,
+				SeverityText:   "Error",
+				Body:           stringValue("No space left on device"),
+				Attributes: []*commonpb.KeyValue{
+					attribute("path", stringValue("/var/lib/historian")),
+					attribute("retries", &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 3}}),
+					attribute("degraded", &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}),
+					attribute("usage", &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0.99}}),
+				},
+				TraceId: traceID,
+				SpanId:  spanID,
+			}},
+			want: []agent.LogMessage{{
+				Timestamp: "2026-10-17T08:00:00.123456789Z",
+				Hostname:  "plc-01",
+				Severity:  "ERROR",
+				Service:   "historian",
+				Message:   "No space left on device",
+				Context: map[string]interface{}{
+					"path": "/var/lib/historian", "retries": float64(3), "degraded": true, "usage": 0.99,
+					"resource": wantResource, "scope": wantScope,
+					"trace_id": "5b8efa23d3654b7e9a1f3c0d42118a6e", "span_id": "eba7310c59620f4d",
+					"protocol": "otlp", "source": source,
+				},
+			}},
+		},
+		{
+			name:     "structured body and observed time",
+			resource: resource,
+			records: []*logspb.LogRecord{{
+				ObservedTimeUnixNano: uint64(at.UnixNano()),
+				SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+				Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+					Values: []*commonpb.KeyValue{
+						attribute("event", stringValue("valve stuck")),
+						attribute("positions", &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+							Values: []*commonpb.AnyValue{stringValue("open"), stringValue("half")},
+						}}}),
+					},
+				}}},
+			}},
+			want: []agent.LogMessage{{
+				Timestamp: "2026-10-17T08:00:00.123456789Z",
+				Hostname:  "plc-01",
+				Severity:  "WARN",
+				Service:   "historian",
+				Message:   `{"event":"valve stuck","positions":["open","half"]}`,
+				Context: map[string]interface{}{
+					"resource": wantResource, "scope": wantScope, "protocol": "otlp", "source": source,
+				},
+			}},
+		},
+		{
+			name: "severity text and sender fallbacks",
+			records: []*logspb.LogRecord{
+				{TimeUnixNano: uint64(at.UnixNano()), SeverityText: "notice", Body: stringValue("Shift started")},
+				{TimeUnixNano: uint64(at.UnixNano()), SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4, Body: stringValue("Line down")},
+				{TimeUnixNano: uint64(at.UnixNano()), SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_INFO},
+			},
+			want: []agent.LogMessage{
+				{
+					Timestamp: "2026-10-17T08:00:00.123456789Z",
+					Hostname:  "192.0.2.20",
+					Severity:  "NOTICE",
+					Service:   "io.gogent.historian",
+					Message:   "Shift started",
+					Context:   map[string]interface{}{"scope": wantScope, "protocol": "otlp", "source": source},
+				},
+				{
+					Timestamp: "2026-10-17T08:00:00.123456789Z",
+					Hostname:  "192.0.2.20",
+					Severity:  "FATAL",
+					Service:   "io.gogent.historian",
+					Message:   "Line down",
+					Context:   map[string]interface{}{"scope": wantScope, "protocol": "otlp", "source": source},
+				},
+			},
+			rejected: 1,
+		},
+	}
+
+	encodings := []struct {
+		contentType string
+		marshal     func(proto.Message) ([]byte, error)
+		rejected    func(t *testing.T, body []byte) int64
+	}{
+		{
+			contentType: "application/x-protobuf",
+			marshal:     proto.Marshal,
+			rejected: func(t *testing.T, body []byte) int64 {
+				var resp collectorlogspb.ExportLogsServiceResponse
+				if err := proto.Unmarshal(body, &resp); err != nil {
+					t.Fatalf("invalid protobuf response: %v", err)
+				}
+				return resp.GetPartialSuccess().GetRejectedLogRecords()
+			},
+		},
+		{
+			contentType: "application/json",
+			marshal:     marshalOTLPJSON,
+			rejected: func(t *testing.T, body []byte) int64 {
+				var resp collectorlogspb.ExportLogsServiceResponse
+				if err := protojson.Unmarshal(body, &resp); err != nil {
+					t.Fatalf("invalid JSON response %s: %v", body, err)
+				}
+				return resp.GetPartialSuccess().GetRejectedLogRecords()
+			},
+		},
+	}
+
+	for _, enc := range encodings {
+		for _, tt := range tests {
+			t.Run(enc.contentType+"/"+tt.name, func(t *testing.T) {
+				req := &collectorlogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+					Resource:  tt.resource,
+					ScopeLogs: []*logspb.ScopeLogs{{Scope: scope, LogRecords: tt.records}},
+				}}}
+				body, err := enc.marshal(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				httpReq := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader(body))
+				httpReq.Header.Set("Content-Type", enc.contentType)
+				httpReq.RemoteAddr = source
+				w := httptest.NewRecorder()
+				receiver.handleHTTP(w, httpReq)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("status %d: %s", w.Code, w.Body.Bytes())
+				}
+				if got := w.Header().Get("Content-Type"); got != enc.contentType {
+					t.Errorf("response content type %q", got)
+				}
+				if got := enc.rejected(t, w.Body.Bytes()); got != tt.rejected {
+					t.Errorf("rejected %d records, want %d", got, tt.rejected)
+				}
+				if got := published(t, sub, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("published %#v\nwant %#v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestOTLPHTTPExportErrors(t *testing.T) {
+	receiver, err := NewOTLPServer(OTLPConfig{HTTPAddr: "127.0.0.1:0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unsupported content type", "text/plain", "hello", http.StatusUnsupportedMediaType},
+		{"invalid protobuf", "application/x-protobuf", "\x0a\xff", http.StatusBadRequest},
+		{"invalid JSON", "application/json", `{"resourceLogs": [`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpReq := httptest.NewRequest(http.MethodPost, "/v1/logs", bytes.NewReader([]byte(tt.body)))
+			httpReq.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			receiver.handleHTTP(w, httpReq)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
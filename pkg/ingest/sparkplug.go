@@ -0,0 +1,215 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// SparkplugConfig tunes which Sparkplug B messages become logs
+type SparkplugConfig struct {
+	AlarmPattern string // Matches alarm metric names, SparkplugAlarmPattern when empty
+	AllData      bool   // Also publish DATA messages without alarms or faults as INFO logs
+}
+
+// SparkplugListener follows the Sparkplug B messages MQTT edge nodes publish through the
+// embedded server's MQTT gateway and publishes device deaths, alarms and faulty metrics for
+// analysis
+type SparkplugListener struct {
+	config    SparkplugConfig
+	alarm     *regexp.Regexp
+	nc        *nats.Conn
+	publisher *Publisher
+	sub       *nats.Subscription
+
+	// Session state by group and edge node, only touched by the subscription handler, which
+	// NATS calls for one message at a time
+	nodes map[string]*sparkplugNode
+}
+
+// sparkplugNode is what the listener remembers of an edge node's session
+type sparkplugNode struct {
+	bdSeq   *uint64           // Birth/death sequence of the current session
+	aliases map[uint64]string // Metric names by the aliases announced in NBIRTH and DBIRTH
+	offline bool
+	devices map[string]bool // Devices that died, by device ID
+}
+
+// sparkplugTopic is a parsed spBv1.0/group/type/node[/device] topic
+type sparkplugTopic struct {
+	Group       string
+	MessageType string
+	Node        string
+	Device      string
+}
+
+// NewSparkplugListener creates a listener for Sparkplug B messages on nc, publishing through
+// publisher
+func NewSparkplugListener(cfg SparkplugConfig, nc *nats.Conn, publisher *Publisher) (*SparkplugListener, error) {
+	pattern := cfg.AlarmPattern
+	if pattern == "" {
+		pattern = shared.SparkplugAlarmPattern
+	}
+	alarm, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sparkplug alarm pattern: %w", err)
+	}
+	return &SparkplugListener{
+		config:    cfg,
+		alarm:     alarm,
+		nc:        nc,
+		publisher: publisher,
+		nodes:     make(map[string]*sparkplugNode),
+	}, nil
+}
+
+// Start subscribes to Sparkplug B messages until ctx is done or Stop is called
+func (l *SparkplugListener) Start(ctx context.Context) error {
+	sub, err := l.nc.Subscribe(shared.SparkplugSubjects, func(msg *nats.Msg) {
+		l.handle(ctx, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to Sparkplug messages: %w", err)
+	}
+	l.sub = sub
+	log.Printf("Receiving Sparkplug B messages on %s", shared.SparkplugSubjects)
+
+	go func() {
+		<-ctx.Done()
+		l.Stop()
+	}()
+	return nil
+}
+
+// Stop unsubscribes; messages already received are still handled
+func (l *SparkplugListener) Stop() {
+	if l.sub != nil {
+		if err := l.sub.Drain(); err != nil && err != nats.ErrConnectionClosed && err != nats.ErrBadSubscription {
+			log.Printf("Error draining Sparkplug subscription: %v", err)
+		}
+	}
+}
+
+// handle updates the session state of the message's edge node and publishes the logs the
+// message gives rise to
+func (l *SparkplugListener) handle(ctx context.Context, msg *nats.Msg) {
+	topic, ok := parseSparkplugTopic(msg.Subject)
+	if !ok {
+		return
+	}
+	payload, err := decodeSparkplugPayload(msg.Data)
+	if err != nil {
+		log.Printf("Error decoding Sparkplug %s from %s: %v", topic.MessageType, topic.Node, err)
+		return
+	}
+	received := time.Now().UTC()
+
+	key := topic.Group + "/" + topic.Node
+	node := l.nodes[key]
+	if node == nil {
+		node = &sparkplugNode{aliases: make(map[uint64]string), devices: make(map[string]bool)}
+		l.nodes[key] = node
+	}
+
+	var logs []agent.LogMessage
+	switch topic.MessageType {
+	case "NBIRTH":
+		node.bdSeq = nil
+		if bdSeq, ok := sparkplugUint(metricValue(payload, "bdSeq")); ok {
+			node.bdSeq = &bdSeq
+		}
+		node.aliases = make(map[uint64]string)
+		node.devices = make(map[string]bool)
+		node.recordAliases(payload)
+		if node.offline {
+			node.offline = false
+			logs = append(logs, sparkplugLog(topic, payload, received, "NOTICE",
+				fmt.Sprintf("Edge node %s is back online", topic.Node)))
+		}
+	case "DBIRTH":
+		node.recordAliases(payload)
+		if node.devices[topic.Device] {
+			delete(node.devices, topic.Device)
+			logs = append(logs, sparkplugLog(topic, payload, received, "NOTICE",
+				fmt.Sprintf("Device %s on edge node %s is back online", topic.Device, topic.Node)))
+		}
+	case "NDEATH":
+		// The broker publishes an edge node's will after it has already reconnected when the
+		// old connection is only noticed late; its bdSeq then belongs to an ended session
+		bdSeq, ok := sparkplugUint(metricValue(payload, "bdSeq"))
+		if ok && node.bdSeq != nil && bdSeq != *node.bdSeq {
+			log.Printf("Ignoring stale NDEATH of edge node %s with bdSeq %d", topic.Node, bdSeq)
+			return
+		}
+		node.offline = true
+		logs = append(logs, sparkplugLog(topic, payload, received, "CRITICAL",
+			fmt.Sprintf("Edge node %s in group %s went offline; its devices are no longer reporting", topic.Node, topic.Group)))
+	case "DDEATH":
+		node.devices[topic.Device] = true
+		logs = append(logs, sparkplugLog(topic, payload, received, "ERROR",
+			fmt.Sprintf("Device %s on edge node %s went offline", topic.Device, topic.Node)))
+	case "NDATA", "DDATA":
+		node.resolveAliases(payload)
+		logs = l.dataLogs(topic, payload, received)
+	default:
+		// Commands and host application STATE messages carry no device telemetry
+		return
+	}
+
+	for _, logMsg := range logs {
+		if err := l.publisher.Publish(ctx, logMsg); err != nil {
+			log.Printf("Error publishing Sparkplug %s from %s: %v", topic.MessageType, topic.Node, err)
+		}
+	}
+}
+
+// recordAliases remembers the names of the aliased metrics of a birth certificate
+func (n *sparkplugNode) recordAliases(p *sparkplugPayload) {
+	for _, m := range p.Metrics {
+		if m.Alias != nil && m.Name != "" {
+			n.aliases[*m.Alias] = m.Name
+		}
+	}
+}
+
+// resolveAliases names the metrics of a DATA message that only carry an alias
+func (n *sparkplugNode) resolveAliases(p *sparkplugPayload) {
+	for i := range p.Metrics {
+		m := &p.Metrics[i]
+		if m.Name != "" || m.Alias == nil {
+			continue
+		}
+		if name, ok := n.aliases[*m.Alias]; ok {
+			m.Name = name
+		} else {
+			m.Name = fmt.Sprintf("alias %d", *m.Alias)
+		}
+	}
+}
+
+// parseSparkplugTopic reads the parts of a Sparkplug subject. The MQTT gateway encodes dots
+// in topic levels as //, which is undone here.
+func parseSparkplugTopic(subject string) (sparkplugTopic, bool) {
+	tokens := strings.Split(subject, ".")
+	if len(tokens) < 4 || len(tokens) > 5 {
+		return sparkplugTopic{}, false
+	}
+	for i := range tokens {
+		tokens[i] = strings.ReplaceAll(tokens[i], "//", ".")
+	}
+	topic := sparkplugTopic{Group: tokens[1], MessageType: tokens[2], Node: tokens[3]}
+	if len(tokens) == 5 {
+		topic.Device = tokens[4]
+	}
+	if strings.HasPrefix(topic.MessageType, "D") && topic.Device == "" {
+		return sparkplugTopic{}, false
+	}
+	return topic, true
+}
@@ -0,0 +1,218 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The Sparkplug B payload model, as far as the agent uses it. Datasets, templates and
+// metadata are not decoded.
+
+type sparkplugPayload struct {
+	Timestamp uint64 // Unix milliseconds
+	Seq       *uint64
+	Metrics   []sparkplugMetric
+}
+
+type sparkplugMetric struct {
+	Name       string
+	Alias      *uint64
+	Timestamp  uint64
+	Datatype   uint32
+	Historical bool
+	Null       bool
+	Value      interface{}
+	Properties map[string]interface{}
+}
+
+// Sparkplug B metric data types
+const (
+	sparkplugInt8     = 1
+	sparkplugInt16    = 2
+	sparkplugInt32    = 3
+	sparkplugInt64    = 4
+	sparkplugUInt8    = 5
+	sparkplugUInt16   = 6
+	sparkplugUInt32   = 7
+	sparkplugUInt64   = 8
+	sparkplugFloat    = 9
+	sparkplugDouble   = 10
+	sparkplugBoolean  = 11
+	sparkplugString   = 12
+	sparkplugDateTime = 13
+	sparkplugText     = 14
+	sparkplugUUID     = 15
+	sparkplugDataSet  = 16
+	sparkplugBytes    = 17
+	sparkplugFile     = 18
+	sparkplugTemplate = 19
+)
+
+// sparkplugTypeNames names the data types in log context
+var sparkplugTypeNames = map[uint32]string{
+	sparkplugInt8: "Int8", sparkplugInt16: "Int16", sparkplugInt32: "Int32", sparkplugInt64: "Int64",
+	sparkplugUInt8: "UInt8", sparkplugUInt16: "UInt16", sparkplugUInt32: "UInt32", sparkplugUInt64: "UInt64",
+	sparkplugFloat: "Float", sparkplugDouble: "Double", sparkplugBoolean: "Boolean", sparkplugString: "String",
+	sparkplugDateTime: "DateTime", sparkplugText: "Text", sparkplugUUID: "UUID", sparkplugDataSet: "DataSet",
+	sparkplugBytes: "Bytes", sparkplugFile: "File", sparkplugTemplate: "Template",
+}
+
+// decodeSparkplugPayload decodes a Sparkplug B protobuf payload
+func decodeSparkplugPayload(data []byte) (*sparkplugPayload, error) {
+	p := &sparkplugPayload{}
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			p.Timestamp = n
+		case num == 2 && typ == protowire.BytesType:
+			var m sparkplugMetric
+			if err := decodeSparkplugMetric(v, &m); err != nil {
+				return err
+			}
+			p.Metrics = append(p.Metrics, m)
+		case num == 3 && typ == protowire.VarintType:
+			p.Seq = &n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decodeSparkplugMetric(data []byte, m *sparkplugMetric) error {
+	// The value fields are read raw and converted once the data type is known, since the
+	// type may follow the value on the wire
+	var raw uint64
+	var rawBytes []byte
+	var rawField protowire.Number
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			m.Name = string(v)
+		case num == 2 && typ == protowire.VarintType:
+			m.Alias = &n
+		case num == 3 && typ == protowire.VarintType:
+			m.Timestamp = n
+		case num == 4 && typ == protowire.VarintType:
+			m.Datatype = uint32(n)
+		case num == 5 && typ == protowire.VarintType:
+			m.Historical = n != 0
+		case num == 7 && typ == protowire.VarintType:
+			m.Null = n != 0
+		case num == 9 && typ == protowire.BytesType:
+			props, err := decodeSparkplugProperties(v)
+			if err != nil {
+				return err
+			}
+			m.Properties = props
+		case num >= 10 && num <= 18:
+			rawField, raw, rawBytes = num, n, v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !m.Null && rawField != 0 {
+		m.Value = sparkplugValue(m.Datatype, rawField, raw, rawBytes)
+	}
+	return nil
+}
+
+// sparkplugValue converts the raw value of a metric field to a Go value of its data type.
+// Signed integers travel as the two's complement in the unsigned int_value and long_value.
+func sparkplugValue(datatype uint32, field protowire.Number, n uint64, v []byte) interface{} {
+	switch field {
+	case 10: // int_value
+		switch datatype {
+		case sparkplugInt8:
+			return int64(int8(n))
+		case sparkplugInt16:
+			return int64(int16(n))
+		case sparkplugInt32:
+			return int64(int32(n))
+		}
+		return uint64(uint32(n))
+	case 11: // long_value
+		switch datatype {
+		case sparkplugInt64:
+			return int64(n)
+		case sparkplugDateTime:
+			return time.UnixMilli(int64(n)).UTC().Format(time.RFC3339Nano)
+		}
+		return n
+	case 12: // float_value
+		return float64(math.Float32frombits(uint32(n)))
+	case 13: // double_value
+		return math.Float64frombits(n)
+	case 14: // boolean_value
+		return n != 0
+	case 15: // string_value
+		return string(v)
+	case 16: // bytes_value
+		return base64.StdEncoding.EncodeToString(v)
+	case 17:
+		return "<dataset>"
+	case 18:
+		return "<template>"
+	}
+	return nil
+}
+
+// decodeSparkplugProperties decodes a PropertySet into its keys and scalar values
+func decodeSparkplugProperties(data []byte) (map[string]interface{}, error) {
+	var keys []string
+	var values []interface{}
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			keys = append(keys, string(v))
+		case num == 2 && typ == protowire.BytesType:
+			value, err := decodeSparkplugPropertyValue(v)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]interface{}, len(keys))
+	for i, key := range keys {
+		if i < len(values) {
+			props[key] = values[i]
+		}
+	}
+	return props, nil
+}
+
+func decodeSparkplugPropertyValue(data []byte) (interface{}, error) {
+	var datatype uint32
+	var raw uint64
+	var rawBytes []byte
+	var rawField protowire.Number
+	var null bool
+	err := walkMessage(data, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			datatype = uint32(n)
+		case num == 2 && typ == protowire.VarintType:
+			null = n != 0
+		case num >= 3 && num <= 8:
+			rawField, raw, rawBytes = num, n, v
+		}
+		return nil
+	})
+	if err != nil || null || rawField == 0 {
+		return nil, err
+	}
+	// Property values number their fields seven below the metric value fields
+	return sparkplugValue(datatype, rawField+7, raw, rawBytes), nil
+}
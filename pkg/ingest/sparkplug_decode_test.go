@@ -0,0 +1,275 @@
+package ingest
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// tahuSchema is the Payload message of Eclipse Tahu's sparkplug_b.proto, without the
+// DataSet and Template messages the agent does not decode
+const tahuSchema = `
+name: "sparkplug_b.proto"
+package: "org.eclipse.tahu.protobuf"
+syntax: "proto2"
+message_type {
+  name: "Payload"
+  field { name: "timestamp" number: 1 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+  field { name: "metrics" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.Metric" }
+  field { name: "seq" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+  field { name: "uuid" number: 4 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "body" number: 5 label: LABEL_OPTIONAL type: TYPE_BYTES }
+  nested_type {
+    name: "PropertyValue"
+    field { name: "type" number: 1 label: LABEL_OPTIONAL type: TYPE_UINT32 }
+    field { name: "is_null" number: 2 label: LABEL_OPTIONAL type: TYPE_BOOL }
+    field { name: "int_value" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT32 oneof_index: 0 }
+    field { name: "long_value" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT64 oneof_index: 0 }
+    field { name: "float_value" number: 5 label: LABEL_OPTIONAL type: TYPE_FLOAT oneof_index: 0 }
+    field { name: "double_value" number: 6 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0 }
+    field { name: "boolean_value" number: 7 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 0 }
+    field { name: "string_value" number: 8 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+    field { name: "propertyset_value" number: 9 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.PropertySet" oneof_index: 0 }
+    field { name: "propertysets_value" number: 10 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.PropertySetList" oneof_index: 0 }
+    oneof_decl { name: "value" }
+  }
+  nested_type {
+    name: "PropertySet"
+    field { name: "keys" number: 1 label: LABEL_REPEATED type: TYPE_STRING }
+    field { name: "values" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.PropertyValue" }
+  }
+  nested_type {
+    name: "PropertySetList"
+    field { name: "propertyset" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.PropertySet" }
+  }
+  nested_type {
+    name: "MetaData"
+    field { name: "is_multi_part" number: 1 label: LABEL_OPTIONAL type: TYPE_BOOL }
+    field { name: "content_type" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "size" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+    field { name: "seq" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+    field { name: "file_name" number: 5 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "file_type" number: 6 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "md5" number: 7 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "description" number: 8 label: LABEL_OPTIONAL type: TYPE_STRING }
+  }
+  nested_type {
+    name: "Metric"
+    field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "alias" number: 2 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+    field { name: "timestamp" number: 3 label: LABEL_OPTIONAL type: TYPE_UINT64 }
+    field { name: "datatype" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT32 }
+    field { name: "is_historical" number: 5 label: LABEL_OPTIONAL type: TYPE_BOOL }
+    field { name: "is_transient" number: 6 label: LABEL_OPTIONAL type: TYPE_BOOL }
+    field { name: "is_null" number: 7 label: LABEL_OPTIONAL type: TYPE_BOOL }
+    field { name: "metadata" number: 8 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.MetaData" }
+    field { name: "properties" number: 9 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".org.eclipse.tahu.protobuf.Payload.PropertySet" }
+    field { name: "int_value" number: 10 label: LABEL_OPTIONAL type: TYPE_UINT32 oneof_index: 0 }
+    field { name: "long_value" number: 11 label: LABEL_OPTIONAL type: TYPE_UINT64 oneof_index: 0 }
+    field { name: "float_value" number: 12 label: LABEL_OPTIONAL type: TYPE_FLOAT oneof_index: 0 }
+    field { name: "double_value" number: 13 label: LABEL_OPTIONAL type: TYPE_DOUBLE oneof_index: 0 }
+    field { name: "boolean_value" number: 14 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 0 }
+    field { name: "string_value" number: 15 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+    field { name: "bytes_value" number: 16 label: LABEL_OPTIONAL type: TYPE_BYTES oneof_index: 0 }
+    oneof_decl { name: "value" }
+  }
+}
+`
+
+// tahuPayloadDescriptor builds the Payload message descriptor from tahuSchema
+func tahuPayloadDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	var fdp descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(tahuSchema), &fdp); err != nil {
+		t.Fatalf("invalid Tahu schema: %v", err)
+	}
+	fd, err := protodesc.NewFile(&fdp, nil)
+	if err != nil {
+		t.Fatalf("invalid Tahu schema: %v", err)
+	}
+	return fd.Messages().ByName("Payload")
+}
+
+// tahuPayload encodes a Payload given in its protobuf JSON form
+func tahuPayload(t *testing.T, desc protoreflect.MessageDescriptor, payload map[string]interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := dynamicpb.NewMessage(desc)
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		t.Fatalf("invalid Tahu payload %s: %v", data, err)
+	}
+	wire, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wire
+}
+
+// Signed integers travel as their two's complement in the unsigned value fields, the way
+// Tahu's encoders write them
+func int32Wire(v int32) uint32 { return uint32(v) }
+func int64Wire(v int64) uint64 { return uint64(v) }
+
+func TestDecodeSparkplugPayload(t *testing.T) {
+	desc := tahuPayloadDescriptor(t)
+	at := time.Date(2026, 10, 17, 8, 0, 0, 250_000_000, time.UTC)
+	alias := func(n uint64) *uint64 { return &n }
+	seq := func(n uint64) *uint64 { return &n }
+
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		want    *sparkplugPayload
+	}{
+		{
+			name: "negative signed integers",
+			payload: map[string]interface{}{
+				"timestamp": at.UnixMilli(),
+				"seq":       4,
+				"metrics": []map[string]interface{}{
+					{"name": "Int8", "alias": 1, "datatype": sparkplugInt8, "intValue": int32Wire(-5)},
+					{"name": "Int16", "alias": 2, "datatype": sparkplugInt16, "intValue": int32Wire(math.MinInt16)},
+					{"name": "Int32", "alias": 3, "datatype": sparkplugInt32, "intValue": int32Wire(-70000)},
+					{"name": "Int64", "alias": 4, "datatype": sparkplugInt64, "longValue": int64Wire(-1 << 40)},
+					{"name": "UInt32", "alias": 5, "datatype": sparkplugUInt32, "intValue": uint32(math.MaxUint32)},
+				},
+			},
+			want: &sparkplugPayload{
+				Timestamp: uint64(at.UnixMilli()),
+				Seq:       seq(4),
+				Metrics: []sparkplugMetric{
+					{Name: "Int8", Alias: alias(1), Datatype: sparkplugInt8, Value: int64(-5)},
+					{Name: "Int16", Alias: alias(2), Datatype: sparkplugInt16, Value: int64(math.MinInt16)},
+					{Name: "Int32", Alias: alias(3), Datatype: sparkplugInt32, Value: int64(-70000)},
+					{Name: "Int64", Alias: alias(4), Datatype: sparkplugInt64, Value: int64(-1 << 40)},
+					{Name: "UInt32", Alias: alias(5), Datatype: sparkplugUInt32, Value: uint64(math.MaxUint32)},
+				},
+			},
+		},
+		{
+			name: "floating point, boolean, string and bytes",
+			payload: map[string]interface{}{
+				"metrics": []map[string]interface{}{
+					{"name": "Temp", "datatype": sparkplugFloat, "floatValue": 21.5},
+					{"name": "Pressure", "datatype": sparkplugDouble, "doubleValue": -3.25},
+					{"name": "Running", "datatype": sparkplugBoolean, "booleanValue": true},
+					{"name": "Recipe", "datatype": sparkplugString, "stringValue": "PVC-40"},
+					{"name": "Blob", "datatype": sparkplugBytes, "bytesValue": "AAEC/w=="},
+				},
+			},
+			want: &sparkplugPayload{
+				Metrics: []sparkplugMetric{
+					{Name: "Temp", Datatype: sparkplugFloat, Value: 21.5},
+					{Name: "Pressure", Datatype: sparkplugDouble, Value: -3.25},
+					{Name: "Running", Datatype: sparkplugBoolean, Value: true},
+					{Name: "Recipe", Datatype: sparkplugString, Value: "PVC-40"},
+					{Name: "Blob", Datatype: sparkplugBytes, Value: "AAEC/w=="},
+				},
+			},
+		},
+		{
+			name: "date time and historical metric",
+			payload: map[string]interface{}{
+				"metrics": []map[string]interface{}{
+					{"name": "Last Maintenance", "timestamp": at.UnixMilli(), "datatype": sparkplugDateTime,
+						"isHistorical": true, "longValue": at.Add(-48 * time.Hour).UnixMilli()},
+				},
+			},
+			want: &sparkplugPayload{
+				Metrics: []sparkplugMetric{
+					{Name: "Last Maintenance", Timestamp: uint64(at.UnixMilli()), Datatype: sparkplugDateTime,
+						Historical: true, Value: "2026-10-15T08:00:00.25Z"},
+				},
+			},
+		},
+		{
+			name: "null metrics",
+			payload: map[string]interface{}{
+				"metrics": []map[string]interface{}{
+					{"alias": 7, "datatype": sparkplugInt32, "isNull": true},
+					{"name": "Setpoint", "datatype": sparkplugDouble, "isNull": true},
+				},
+			},
+			want: &sparkplugPayload{
+				Metrics: []sparkplugMetric{
+					{Alias: alias(7), Datatype: sparkplugInt32, Null: true},
+					{Name: "Setpoint", Datatype: sparkplugDouble, Null: true},
+				},
+			},
+		},
+		{
+			name: "property sets",
+			payload: map[string]interface{}{
+				"metrics": []map[string]interface{}{{
+					"alias": 4, "datatype": sparkplugDouble, "doubleValue": 0,
+					"properties": map[string]interface{}{
+						"keys": []string{"Quality", "engUnit", "engLow", "readOnly", "offset", "comment", "nested"},
+						"values": []map[string]interface{}{
+							{"type": sparkplugInt32, "intValue": 0},
+							{"type": sparkplugString, "stringValue": "bar"},
+							{"type": sparkplugFloat, "floatValue": -1.5},
+							{"type": sparkplugBoolean, "booleanValue": true},
+							{"type": sparkplugInt16, "intValue": int32Wire(-12)},
+							{"type": sparkplugString, "isNull": true},
+							{"type": 20, "propertysetValue": map[string]interface{}{"keys": []string{"a"}, "values": []map[string]interface{}{{"type": sparkplugBoolean, "booleanValue": false}}}},
+						},
+					},
+				}},
+			},
+			want: &sparkplugPayload{
+				Metrics: []sparkplugMetric{{
+					Alias:    alias(4),
+					Datatype: sparkplugDouble,
+					Value:    0.0,
+					Properties: map[string]interface{}{
+						"Quality": int64(0), "engUnit": "bar", "engLow": -1.5, "readOnly": true, "offset": int64(-12),
+						"comment": nil, "nested": nil,
+					},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeSparkplugPayload(tahuPayload(t, desc, tt.payload))
+			if err != nil {
+				t.Fatalf("decodeSparkplugPayload() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeSparkplugPayload() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSparkplugPayloadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated metric", []byte{0x12, 0x05, 0x0a, 0x03, 'a'}},
+		{"invalid tag", []byte{0xff}},
+		{"truncated properties", []byte{0x12, 0x04, 0x4a, 0x02, 0x0a, 0x05}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeSparkplugPayload(tt.data); err == nil {
+				t.Errorf("decodeSparkplugPayload(%x) succeeded", tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// dataLogs turns the alarm metrics and the metrics of bad quality in an NDATA or DDATA
+// message into logs, each carrying the message's other metrics for context. Routine
+// telemetry is only published with AllData.
+func (l *SparkplugListener) dataLogs(topic sparkplugTopic, p *sparkplugPayload, received time.Time) []agent.LogMessage {
+	source := "edge node " + topic.Node
+	if topic.Device != "" {
+		source = fmt.Sprintf("device %s of edge node %s", topic.Device, topic.Node)
+	}
+
+	var logs []agent.LogMessage
+	for _, m := range p.Metrics {
+		if m.Null {
+			continue
+		}
+		if l.alarm.MatchString(m.Name) {
+			severity, state := "NOTICE", "cleared"
+			if alarmActive(m.Value) {
+				severity, state = "ERROR", "active"
+			}
+			message := fmt.Sprintf("Alarm %s %s on %s", m.Name, state, source)
+			if _, ok := m.Value.(bool); !ok {
+				message += fmt.Sprintf(" (value %v)", m.Value)
+			}
+			logs = append(logs, metricLog(topic, p, m, received, severity, message))
+		}
+		if quality, ok := sparkplugUint(m.Properties["Quality"]); ok && quality != shared.SparkplugGoodQuality {
+			message := fmt.Sprintf("Metric %s on %s has bad quality %d (value %v)", m.Name, source, quality, m.Value)
+			logs = append(logs, metricLog(topic, p, m, received, "WARN", message))
+		}
+	}
+
+	if len(logs) == 0 && l.config.AllData && len(p.Metrics) > 0 {
+		logMsg := sparkplugLog(topic, p, received, "INFO", fmt.Sprintf("%d metric(s) from %s", len(p.Metrics), source))
+		logMsg.Context["metrics"] = metricValues(p)
+		logs = append(logs, logMsg)
+	}
+	return logs
+}
+
+// metricLog describes one metric of a DATA message, dated by the metric when it carries a
+// timestamp
+func metricLog(topic sparkplugTopic, p *sparkplugPayload, m sparkplugMetric, received time.Time, severity, message string) agent.LogMessage {
+	logMsg := sparkplugLog(topic, p, received, severity, message)
+	if m.Timestamp != 0 {
+		logMsg.Timestamp = time.UnixMilli(int64(m.Timestamp)).UTC().Format(time.RFC3339Nano)
+	}
+	metric := map[string]interface{}{
+		"name":     m.Name,
+		"datatype": sparkplugTypeNames[m.Datatype],
+		"value":    m.Value,
+	}
+	if m.Alias != nil {
+		metric["alias"] = *m.Alias
+	}
+	if m.Historical {
+		metric["historical"] = true
+	}
+	if len(m.Properties) > 0 {
+		metric["properties"] = m.Properties
+	}
+	logMsg.Context["metric"] = metric
+	if len(p.Metrics) > 1 {
+		logMsg.Context["metrics"] = metricValues(p)
+	}
+	return logMsg
+}
+
+// sparkplugLog creates a log of a Sparkplug message. The edge node is the host and the
+// device, or the group for node messages, the service.
+func sparkplugLog(topic sparkplugTopic, p *sparkplugPayload, received time.Time, severity, message string) agent.LogMessage {
+	logMsg := agent.LogMessage{
+		Timestamp: received.Format(time.RFC3339Nano),
+		Hostname:  topic.Node,
+		Severity:  severity,
+		Service:   topic.Group,
+		Message:   message,
+		Context: map[string]interface{}{
+			"protocol":     "sparkplug_b",
+			"group_id":     topic.Group,
+			"message_type": topic.MessageType,
+			"edge_node_id": topic.Node,
+		},
+	}
+	if topic.Device != "" {
+		logMsg.Service = topic.Device
+		logMsg.Context["device_id"] = topic.Device
+	}
+	if p.Timestamp != 0 {
+		logMsg.Timestamp = time.UnixMilli(int64(p.Timestamp)).UTC().Format(time.RFC3339Nano)
+	}
+	if p.Seq != nil {
+		logMsg.Context["seq"] = *p.Seq
+	}
+	if bdSeq := metricValue(p, "bdSeq"); bdSeq != nil {
+		logMsg.Context["bd_seq"] = bdSeq
+	}
+	return logMsg
+}
+
+// metricValues maps the names of a message's metrics to their values
+func metricValues(p *sparkplugPayload) map[string]interface{} {
+	values := make(map[string]interface{}, len(p.Metrics))
+	for _, m := range p.Metrics {
+		values[m.Name] = m.Value
+	}
+	return values
+}
+
+// metricValue returns the value of the named metric, or nil
+func metricValue(p *sparkplugPayload, name string) interface{} {
+	for _, m := range p.Metrics {
+		if m.Name == name {
+			return m.Value
+		}
+	}
+	return nil
+}
+
+// sparkplugUint reads a non-negative integer metric or property value
+func sparkplugUint(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// alarmActive reports whether an alarm metric's value signals an active alarm: true, a
+// non-zero number or a state other than a cleared one
+func alarmActive(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case uint64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "0", "false", "ok", "normal", "none", "clear", "cleared", "inactive":
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// SyslogConfig selects the syslog listeners to open. Empty addresses are not listened on.
+type SyslogConfig struct {
+	UDPAddr   string
+	TCPAddr   string
+	TLSAddr   string
+	TLSConfig *tls.Config // Required with TLSAddr
+}
+
+// SyslogServer receives syslog messages over UDP, TCP and TLS and publishes them for analysis
+type SyslogServer struct {
+	config    SyslogConfig
+	publisher *Publisher
+	udp       net.PacketConn
+	listeners []net.Listener
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewSyslogServer creates a syslog server publishing through publisher
+func NewSyslogServer(cfg SyslogConfig, publisher *Publisher) (*SyslogServer, error) {
+	if cfg.UDPAddr == "" && cfg.TCPAddr == "" && cfg.TLSAddr == "" {
+		return nil, fmt.Errorf("no syslog listen address configured")
+	}
+	if cfg.TLSAddr != "" && cfg.TLSConfig == nil {
+		return nil, fmt.Errorf("syslog over TLS needs a certificate")
+	}
+	return &SyslogServer{config: cfg, publisher: publisher, conns: make(map[net.Conn]bool)}, nil
+}
+
+// Start opens the configured listeners and receives messages until ctx is done or Stop is
+// called
+func (s *SyslogServer) Start(ctx context.Context) error {
+	if s.config.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", s.config.UDPAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for syslog on UDP %s: %w", s.config.UDPAddr, err)
+		}
+		s.udp = conn
+		log.Printf("Receiving syslog on UDP %s", conn.LocalAddr())
+		s.wg.Add(1)
+		go s.serveUDP(ctx, conn)
+	}
+	if s.config.TCPAddr != "" {
+		ln, err := net.Listen("tcp", s.config.TCPAddr)
+		if err != nil {
+			s.Stop()
+			return fmt.Errorf("failed to listen for syslog on TCP %s: %w", s.config.TCPAddr, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		log.Printf("Receiving syslog on TCP %s", ln.Addr())
+		s.wg.Add(1)
+		go s.serveStream(ctx, ln)
+	}
+	if s.config.TLSAddr != "" {
+		ln, err := tls.Listen("tcp", s.config.TLSAddr, s.config.TLSConfig)
+		if err != nil {
+			s.Stop()
+			return fmt.Errorf("failed to listen for syslog on TLS %s: %w", s.config.TLSAddr, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		log.Printf("Receiving syslog over TLS on %s", ln.Addr())
+		s.wg.Add(1)
+		go s.serveStream(ctx, ln)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+	return nil
+}
+
+// Stop closes the listeners and open connections and waits for received messages to be
+// published
+func (s *SyslogServer) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// serveUDP reads one message per datagram
+func (s *SyslogServer) serveUDP(ctx context.Context, conn net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, shared.SyslogMaxMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error reading syslog datagram: %v", err)
+			}
+			return
+		}
+		s.publish(ctx, buf[:n], addr.String())
+	}
+}
+
+// serveStream accepts TCP or TLS connections
+func (s *SyslogServer) serveStream(ctx context.Context, ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error accepting syslog connection: %v", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(ctx, conn)
+	}
+}
+
+// serveConn reads the messages of one connection, framed by octet counting or by newlines
+// (RFC 6587)
+func (s *SyslogServer) serveConn(ctx context.Context, conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	source := conn.RemoteAddr().String()
+	r := bufio.NewReaderSize(conn, shared.SyslogMaxMessage)
+	for {
+		conn.SetReadDeadline(time.Now().Add(shared.SyslogIdleTimeout))
+		frame, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error reading syslog from %s: %v", source, err)
+			}
+			return
+		}
+		s.publish(ctx, frame, source)
+	}
+}
+
+// readFrame reads one syslog message. Octet-counted frames start with their length and a
+// space; anything else runs to the end of the line.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] < '1' || first[0] > '9' {
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("message longer than %d bytes", shared.SyslogMaxMessage)
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+			return nil, err
+		}
+		return line, nil
+	}
+
+	prefix, err := r.ReadSlice(' ')
+	if err != nil {
+		return nil, fmt.Errorf("invalid octet count: %w", err)
+	}
+	n, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+	if err != nil || n <= 0 || n > shared.SyslogMaxMessage {
+		return nil, fmt.Errorf("invalid octet count %q", prefix)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// publish parses a received message and hands it to the agent pipeline
+func (s *SyslogServer) publish(ctx context.Context, data []byte, source string) {
+	logMsg, err := ParseSyslog(data, source, time.Now())
+	if err != nil {
+		log.Printf("Error parsing syslog from %s: %v", source, err)
+		return
+	}
+	if err := s.publisher.Publish(ctx, logMsg); err != nil {
+		log.Printf("Error publishing syslog from %s: %v", source, err)
+	}
+}
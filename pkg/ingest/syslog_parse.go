@@ -0,0 +1,260 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/agent"
+)
+
+// syslogFacilities names the syslog facilities 0 to 23
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+	"ntp", "security", "console", "solaris-cron", "local0", "local1", "local2", "local3", "local4", "local5",
+	"local6", "local7",
+}
+
+// defaultPriority is user.notice, which RFC 3164 assumes for messages without a priority
+const defaultPriority = 13
+
+// ParseSyslog converts an RFC 5424 or RFC 3164 syslog message into a log message. The
+// facility, application, process and message IDs and any structured data go into Context;
+// fields the sender left out fall back to the receive time and the sender's address.
+func ParseSyslog(data []byte, source string, received time.Time) (agent.LogMessage, error) {
+	line := string(bytes.TrimRight(data, "\r\n\x00"))
+	if strings.TrimSpace(line) == "" {
+		return agent.LogMessage{}, fmt.Errorf("empty syslog message")
+	}
+
+	pri, rest, ok := parsePriority(line)
+	if !ok {
+		pri, rest = defaultPriority, line
+	}
+	facility, severity := pri/8, pri%8
+
+	var logMsg agent.LogMessage
+	var err error
+	if strings.HasPrefix(rest, "1 ") {
+		logMsg, err = parseRFC5424(rest[2:], received)
+	} else {
+		logMsg = parseRFC3164(rest, received)
+	}
+	if err != nil {
+		return logMsg, err
+	}
+
+	logMsg.Severity = agent.SyslogSeverity(severity)
+	logMsg.Context["facility"] = syslogFacilities[facility]
+	logMsg.Context["source"] = source
+	if logMsg.Hostname == "" {
+		logMsg.Hostname = sourceHost(source)
+	}
+	if logMsg.Service == "" {
+		logMsg.Service = syslogFacilities[facility]
+	}
+	return logMsg, nil
+}
+
+// parsePriority reads the <PRI> prefix, 0 to 191
+func parsePriority(line string) (int, string, bool) {
+	if !strings.HasPrefix(line, "<") {
+		return 0, line, false
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return 0, line, false
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, line, false
+	}
+	return pri, line[end+1:], true
+}
+
+// parseRFC5424 reads "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]"
+func parseRFC5424(rest string, received time.Time) (agent.LogMessage, error) {
+	logMsg := agent.LogMessage{Context: map[string]interface{}{"protocol": "rfc5424"}}
+
+	fields := make([]string, 5)
+	for i := range fields {
+		var ok bool
+		fields[i], rest, ok = strings.Cut(rest, " ")
+		if !ok && i < len(fields)-1 {
+			return logMsg, fmt.Errorf("truncated RFC 5424 header")
+		}
+	}
+	timestamp, hostname, appName, procID, msgID := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	logMsg.Timestamp = received.Format(time.RFC3339Nano)
+	if timestamp != "-" {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return logMsg, fmt.Errorf("invalid RFC 5424 timestamp %q", timestamp)
+		}
+		logMsg.Timestamp = t.Format(time.RFC3339Nano)
+	}
+	if hostname != "-" {
+		logMsg.Hostname = hostname
+	}
+	if appName != "-" {
+		logMsg.Service = appName
+		logMsg.Context["app_name"] = appName
+	}
+	if procID != "-" {
+		logMsg.Context["proc_id"] = procID
+	}
+	if msgID != "-" {
+		logMsg.Context["msg_id"] = msgID
+	}
+
+	sd, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return logMsg, err
+	}
+	if len(sd) > 0 {
+		logMsg.Context["structured_data"] = sd
+	}
+	logMsg.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return logMsg, nil
+}
+
+// parseStructuredData reads "-" or one or more [SD-ID PARAM="VALUE" ...] elements and returns
+// them as SD-ID to parameters, with the rest of the line
+func parseStructuredData(rest string) (map[string]interface{}, string, error) {
+	if rest == "" {
+		return nil, rest, nil
+	}
+	if rest == "-" || strings.HasPrefix(rest, "- ") {
+		return nil, rest[1:], nil
+	}
+	if !strings.HasPrefix(rest, "[") {
+		return nil, rest, fmt.Errorf("invalid RFC 5424 structured data")
+	}
+
+	sd := make(map[string]interface{})
+	for strings.HasPrefix(rest, "[") {
+		rest = rest[1:]
+		end := strings.IndexAny(rest, " ]")
+		if end <= 0 {
+			return nil, rest, fmt.Errorf("invalid RFC 5424 structured data element")
+		}
+		id := rest[:end]
+		rest = rest[end:]
+
+		params := make(map[string]interface{})
+		for strings.HasPrefix(rest, " ") {
+			rest = rest[1:]
+			name, value, ok := strings.Cut(rest, `="`)
+			if !ok || name == "" || strings.ContainsAny(name, " ]") {
+				return nil, rest, fmt.Errorf("invalid RFC 5424 structured data parameter in %q", id)
+			}
+			var b strings.Builder
+			i := 0
+			for ; i < len(value); i++ {
+				c := value[i]
+				if c == '\\' && i+1 < len(value) && strings.IndexByte(`"\]`, value[i+1]) >= 0 {
+					i++
+					c = value[i]
+				} else if c == '"' {
+					break
+				}
+				b.WriteByte(c)
+			}
+			if i == len(value) {
+				return nil, rest, fmt.Errorf("unterminated RFC 5424 structured data value in %q", id)
+			}
+			params[name] = b.String()
+			rest = value[i+1:]
+		}
+		if !strings.HasPrefix(rest, "]") {
+			return nil, rest, fmt.Errorf("unterminated RFC 5424 structured data element %q", id)
+		}
+		rest = rest[1:]
+		sd[id] = params
+	}
+	return sd, rest, nil
+}
+
+// rfc3164Layouts are the timestamps seen after the priority of BSD syslog messages
+var rfc3164Layouts = []string{time.StampMilli, time.Stamp, time.RFC3339Nano}
+
+// parseRFC3164 reads the loosely defined BSD format, "TIMESTAMP HOSTNAME TAG[PID]: MSG", where
+// any part may be missing. The year and zone of a BSD timestamp are taken from the receive time.
+func parseRFC3164(rest string, received time.Time) agent.LogMessage {
+	logMsg := agent.LogMessage{
+		Timestamp: received.Format(time.RFC3339Nano),
+		Context:   map[string]interface{}{"protocol": "rfc3164"},
+	}
+
+	for _, layout := range rfc3164Layouts {
+		n := len(layout)
+		if layout == time.RFC3339Nano {
+			n = strings.IndexByte(rest, ' ')
+		}
+		if n <= 0 || len(rest) < n {
+			continue
+		}
+		t, err := time.Parse(layout, rest[:n])
+		if err != nil {
+			continue
+		}
+		if layout != time.RFC3339Nano {
+			t = time.Date(received.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), received.Location())
+			// A December message received in January is from last year
+			if t.After(received.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		logMsg.Timestamp = t.Format(time.RFC3339Nano)
+		rest = strings.TrimLeft(rest[n:], " ")
+
+		// The hostname follows a timestamp unless the next word is already the tag
+		if word, after, ok := strings.Cut(rest, " "); ok && !isTag(word) {
+			logMsg.Hostname = word
+			rest = after
+		}
+		break
+	}
+
+	if word, after, ok := strings.Cut(rest, " "); ok && isTag(word) {
+		tag := strings.TrimSuffix(word, ":")
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			tag = name
+			logMsg.Context["proc_id"] = strings.TrimSuffix(pid, "]")
+		}
+		logMsg.Service = tag
+		logMsg.Context["app_name"] = tag
+		rest = after
+	}
+	logMsg.Message = rest
+	return logMsg
+}
+
+// isTag reports whether a word is a BSD syslog tag such as "sshd:" or "sshd[42]:"
+func isTag(word string) bool {
+	if !strings.HasSuffix(word, ":") || len(word) < 2 {
+		return false
+	}
+	name, _, _ := strings.Cut(strings.TrimSuffix(word, ":"), "[")
+	if name == "" || len(name) > 48 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceHost strips the port from a sender's address
+func sourceHost(source string) string {
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		return host
+	}
+	return source
+}
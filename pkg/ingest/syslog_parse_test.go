@@ -0,0 +1,277 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/agent"
+)
+
+const bom = "\ufeff"
+
+func TestParseSyslog(t *testing.T) {
+	received := time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC)
+	source := "192.0.2.10:51514"
+
+	tests := []struct {
+		name     string
+		data     string
+		received time.Time
+		want     agent.LogMessage
+	}{
+		{
+			// RFC 5424 section 6.5, example 1
+			name: "rfc5424 with BOM",
+			data: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - " + bom + "'su root' failed for lonvick on /dev/pts/8",
+			want: agent.LogMessage{
+				Timestamp: "2003-10-11T22:14:15.003Z",
+				Hostname:  "mymachine.example.com",
+				Severity:  "CRITICAL",
+				Service:   "su",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+				Context: map[string]interface{}{
+					"protocol": "rfc5424", "facility": "auth", "source": source, "app_name": "su", "msg_id": "ID47",
+				},
+			},
+		},
+		{
+			// RFC 5424 section 6.5, example 2
+			name: "rfc5424 without BOM",
+			data: "<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts.",
+			want: agent.LogMessage{
+				Timestamp: "2003-08-24T05:14:15.000003-07:00",
+				Hostname:  "192.0.2.1",
+				Severity:  "NOTICE",
+				Service:   "myproc",
+				Message:   "%% It's time to make the do-nuts.",
+				Context: map[string]interface{}{
+					"protocol": "rfc5424", "facility": "local4", "source": source, "app_name": "myproc", "proc_id": "8710",
+				},
+			},
+		},
+		{
+			// RFC 5424 section 6.5, example 3
+			name: "rfc5424 structured data and message",
+			data: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] ` + bom + "An application event log entry...",
+			want: agent.LogMessage{
+				Timestamp: "2003-10-11T22:14:15.003Z",
+				Hostname:  "mymachine.example.com",
+				Severity:  "NOTICE",
+				Service:   "evntslog",
+				Message:   "An application event log entry...",
+				Context: map[string]interface{}{
+					"protocol": "rfc5424", "facility": "local4", "source": source, "app_name": "evntslog", "msg_id": "ID47",
+					"structured_data": map[string]interface{}{
+						"exampleSDID@32473": map[string]interface{}{"iut": "3", "eventSource": "Application", "eventID": "1011"},
+					},
+				},
+			},
+		},
+		{
+			// RFC 5424 section 6.5, example 4
+			name: "rfc5424 structured data only",
+			data: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"]`,
+			want: agent.LogMessage{
+				Timestamp: "2003-10-11T22:14:15.003Z",
+				Hostname:  "mymachine.example.com",
+				Severity:  "NOTICE",
+				Service:   "evntslog",
+				Context: map[string]interface{}{
+					"protocol": "rfc5424", "facility": "local4", "source": source, "app_name": "evntslog", "msg_id": "ID47",
+					"structured_data": map[string]interface{}{
+						"exampleSDID@32473":     map[string]interface{}{"iut": "3", "eventSource": "Application", "eventID": "1011"},
+						"examplePriority@32473": map[string]interface{}{"class": "high"},
+					},
+				},
+			},
+		},
+		{
+			name: "rfc5424 escaped structured data",
+			data: `<11>1 2026-10-17T08:00:00Z plc-01 historian - - [origin@32473 path="C:\\logs\]" note="say \"hi\""] write failed`,
+			want: agent.LogMessage{
+				Timestamp: "2026-10-17T08:00:00Z",
+				Hostname:  "plc-01",
+				Severity:  "ERROR",
+				Service:   "historian",
+				Message:   "write failed",
+				Context: map[string]interface{}{
+					"protocol": "rfc5424", "facility": "user", "source": source, "app_name": "historian",
+					"structured_data": map[string]interface{}{
+						"origin@32473": map[string]interface{}{"path": `C:\logs]`, "note": `say "hi"`},
+					},
+				},
+			},
+		},
+		{
+			name: "rfc5424 nil values",
+			data: "<14>1 - - - - - -",
+			want: agent.LogMessage{
+				Timestamp: "2026-10-17T08:30:00Z",
+				Hostname:  "192.0.2.10",
+				Severity:  "INFO",
+				Service:   "user",
+				Context:   map[string]interface{}{"protocol": "rfc5424", "facility": "user", "source": source},
+			},
+		},
+		{
+			// RFC 3164 section 5.4, example 1
+			name: "rfc3164 without year",
+			data: "<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			want: agent.LogMessage{
+				Timestamp: "2026-10-11T22:14:15Z",
+				Hostname:  "mymachine",
+				Severity:  "CRITICAL",
+				Service:   "su",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+				Context:   map[string]interface{}{"protocol": "rfc3164", "facility": "auth", "source": source, "app_name": "su"},
+			},
+		},
+		{
+			// RFC 3164 section 5.4, example 2
+			name: "rfc3164 without tag",
+			data: "<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!",
+			want: agent.LogMessage{
+				Timestamp: "2026-02-05T17:32:18Z",
+				Hostname:  "10.0.0.99",
+				Severity:  "NOTICE",
+				Service:   "user",
+				Message:   "Use the BFG!",
+				Context:   map[string]interface{}{"protocol": "rfc3164", "facility": "user", "source": source},
+			},
+		},
+		{
+			name:     "rfc3164 from last year",
+			data:     "<86>Dec 31 23:59:58 gw01 sshd[4721]: Accepted publickey for ops",
+			received: time.Date(2027, 1, 1, 0, 0, 5, 0, time.UTC),
+			want: agent.LogMessage{
+				Timestamp: "2026-12-31T23:59:58Z",
+				Hostname:  "gw01",
+				Severity:  "INFO",
+				Service:   "sshd",
+				Message:   "Accepted publickey for ops",
+				Context: map[string]interface{}{
+					"protocol": "rfc3164", "facility": "authpriv", "source": source, "app_name": "sshd", "proc_id": "4721",
+				},
+			},
+		},
+		{
+			name: "rfc3164 without priority",
+			data: "conveyor stopped\n",
+			want: agent.LogMessage{
+				Timestamp: "2026-10-17T08:30:00Z",
+				Hostname:  "192.0.2.10",
+				Severity:  "NOTICE",
+				Service:   "user",
+				Message:   "conveyor stopped",
+				Context:   map[string]interface{}{"protocol": "rfc3164", "facility": "user", "source": source},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := received
+			if !tt.received.IsZero() {
+				at = tt.received
+			}
+			got, err := ParseSyslog([]byte(tt.data), source, at)
+			if err != nil {
+				t.Fatalf("ParseSyslog() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSyslog() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSyslogErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", "\r\n"},
+		{"truncated header", "<14>1 2026-10-17T08:00:00Z host"},
+		{"invalid timestamp", "<14>1 yesterday host app - - - message"},
+		{"unterminated value", `<14>1 - host app - - [id@1 key="value] message`},
+		{"unterminated element", `<14>1 - host app - - [id@1 key="value" message`},
+		{"missing structured data", "<14>1 - host app - - message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSyslog([]byte(tt.data), "192.0.2.10:514", time.Now()); err == nil {
+				t.Errorf("ParseSyslog(%q) succeeded", tt.data)
+			}
+		})
+	}
+}
+
+// octetFrame prefixes a message with its octet count
+func octetFrame(msg string) string {
+	return strconv.Itoa(len(msg)) + " " + msg
+}
+
+func TestReadFrame(t *testing.T) {
+	first := "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - " + bom + "'su root' failed\nfor lonvick"
+	second := "<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!"
+
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{
+			name:   "octet counting",
+			stream: octetFrame(first) + octetFrame(second),
+			want:   []string{first, second},
+		},
+		{
+			name:   "newline delimited",
+			stream: second + "\n" + second,
+			want:   []string{second + "\n", second},
+		},
+		{
+			name:   "mixed",
+			stream: second + "\n" + octetFrame(first),
+			want:   []string{second + "\n", first},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.stream))
+			var got []string
+			for {
+				frame, err := readFrame(r)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("readFrame() error = %v", err)
+				}
+				got = append(got, string(frame))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readFrame() frames = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid octet count", func(t *testing.T) {
+		r := bufio.NewReader(strings.NewReader("12x <14>1 - - - - - -"))
+		if _, err := readFrame(r); err == nil {
+			t.Error("readFrame() accepted an invalid octet count")
+		}
+	})
+	t.Run("short frame", func(t *testing.T) {
+		r := bufio.NewReader(strings.NewReader("40 <14>1 - - - - - -"))
+		if _, err := readFrame(r); err == nil {
+			t.Error("readFrame() accepted a frame shorter than its octet count")
+		}
+	})
+}
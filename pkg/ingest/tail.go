@@ -0,0 +1,401 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/db"
+	"github.com/tobalo/gogent/pkg/shared"
+)
+
+// Tailer follows log files matched by glob patterns and publishes each new line, or each
+// record joined by a multiline pattern, for analysis. How far each file has been published is
+// checkpointed in SQLite so a restart resumes where it stopped; rotated files are read to
+// their end before the new file is followed, and truncated files are read again from the
+// start.
+type Tailer struct {
+	sources   []*tailSource
+	publisher *Publisher
+	poll      time.Duration
+	files     map[string]*tailedFile // Followed files by path
+	draining  []*tailedFile          // Files rotated away from their path, read to their end
+	buf       []byte
+	done      chan struct{}
+	once      sync.Once
+	wg        sync.WaitGroup
+}
+
+// tailedFile is the read state of one followed file
+type tailedFile struct {
+	path      string
+	source    *tailSource
+	file      *os.File
+	info      os.FileInfo
+	pos       int64    // Read position
+	committed int64    // End of the last published record
+	saved     int64    // Checkpointed offset
+	head      []byte   // The file's first bytes, up to TailHeadSize, identifying it in checkpoints
+	partial   []byte   // Line read without its newline yet
+	pending   []string // Record still collecting continuation lines
+	pendingAt int64    // End of the pending record's last line
+	lastRead  time.Time
+}
+
+// NewTailer creates a tailer publishing through publisher, checking files every poll
+func NewTailer(sources []TailSource, publisher *Publisher, poll time.Duration) (*Tailer, error) {
+	if poll <= 0 {
+		return nil, fmt.Errorf("tail poll interval must be positive")
+	}
+	t := &Tailer{
+		publisher: publisher,
+		poll:      poll,
+		files:     make(map[string]*tailedFile),
+		buf:       make([]byte, shared.TailMaxLine),
+		done:      make(chan struct{}),
+	}
+	for _, src := range sources {
+		compiled, err := compileSource(src)
+		if err != nil {
+			return nil, err
+		}
+		t.sources = append(t.sources, compiled)
+	}
+	return t, nil
+}
+
+// Start opens the files matched now, positioned at their checkpoint or, unless a source reads
+// from the beginning, at their end, and follows them until ctx is done or Stop is called
+func (t *Tailer) Start(ctx context.Context) {
+	t.scan(ctx, true)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer t.closeAll()
+		ticker := time.NewTicker(t.poll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.done:
+				return
+			case <-ticker.C:
+				t.scan(ctx, false)
+			}
+		}
+	}()
+}
+
+// Stop stops following files. Records not yet published are read again on the next start.
+func (t *Tailer) Stop() {
+	t.once.Do(func() { close(t.done) })
+	t.wg.Wait()
+}
+
+// scan picks up new, rotated and truncated files and publishes what was appended to each
+func (t *Tailer) scan(ctx context.Context, startup bool) {
+	for path, f := range t.files {
+		info, err := os.Stat(path)
+		if err != nil || !os.SameFile(info, f.info) {
+			log.Printf("Tailed file %s was rotated", path)
+			delete(t.files, path)
+			t.draining = append(t.draining, f)
+			continue
+		}
+		if info.Size() < f.pos {
+			log.Printf("Tailed file %s was truncated, reading it from the start", path)
+			f.restart()
+		}
+		f.info = info
+	}
+
+	for path, src := range t.matches() {
+		if _, ok := t.files[path]; ok {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		// A rotated file renamed to another matched path is followed on from where it was
+		if f := t.renamed(info); f != nil {
+			f.path, f.info = path, info
+			t.files[path] = f
+			continue
+		}
+		f, err := openTailedFile(path, src, info, startup && !src.FromBeginning)
+		if err != nil {
+			log.Printf("Error opening tailed file: %v", err)
+			continue
+		}
+		log.Printf("Tailing %s from offset %d", path, f.pos)
+		t.files[path] = f
+	}
+
+	for _, f := range t.draining {
+		t.read(ctx, f, true)
+		f.file.Close()
+	}
+	t.draining = nil
+	for _, f := range t.files {
+		t.read(ctx, f, false)
+	}
+}
+
+// matches returns the regular files matched by the sources' patterns, each with the first
+// source matching it
+func (t *Tailer) matches() map[string]*tailSource {
+	matched := make(map[string]*tailSource)
+	for _, src := range t.sources {
+		for _, pattern := range src.Paths {
+			paths, _ := filepath.Glob(pattern)
+			for _, path := range paths {
+				if _, ok := matched[path]; ok {
+					continue
+				}
+				if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+					matched[path] = src
+				}
+			}
+		}
+	}
+	return matched
+}
+
+// renamed takes the draining file that info describes off the draining list
+func (t *Tailer) renamed(info os.FileInfo) *tailedFile {
+	for i, f := range t.draining {
+		if os.SameFile(f.info, info) {
+			t.draining = append(t.draining[:i], t.draining[i+1:]...)
+			return f
+		}
+	}
+	return nil
+}
+
+// openTailedFile opens a file at its checkpoint if it is still the checkpointed file, else at
+// its end or its start
+func openTailedFile(path string, src *tailSource, info os.FileInfo, atEnd bool) (*tailedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	f := &tailedFile{path: path, source: src, file: file, info: info, lastRead: time.Now()}
+
+	checkpoint, err := db.GetTailOffset(path)
+	if err != nil {
+		log.Printf("Error reading checkpoint of %s: %v", path, err)
+	}
+	switch {
+	case checkpoint != nil && f.isCheckpointed(checkpoint, info.Size()):
+		f.pos = checkpoint.Offset
+	case checkpoint == nil && atEnd:
+		f.pos = info.Size()
+	}
+
+	f.head = make([]byte, min(f.pos, shared.TailHeadSize))
+	if _, err := io.ReadFull(file, f.head); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if _, err := file.Seek(f.pos, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek %s: %w", path, err)
+	}
+	f.committed, f.saved = f.pos, f.pos
+	if checkpoint != nil {
+		f.saved = checkpoint.Offset
+	}
+	return f, nil
+}
+
+// isCheckpointed reports whether the open file still starts with the bytes the checkpoint was
+// taken of
+func (f *tailedFile) isCheckpointed(checkpoint *db.TailOffset, size int64) bool {
+	if size < checkpoint.Offset || size < int64(checkpoint.HeadSize) {
+		return false
+	}
+	head := make([]byte, checkpoint.HeadSize)
+	if _, err := f.file.ReadAt(head, 0); err != nil {
+		return false
+	}
+	return headHash(head) == checkpoint.HeadHash
+}
+
+// restart reads a truncated file again from the start
+func (f *tailedFile) restart() {
+	f.pos, f.committed = 0, 0
+	f.head, f.partial, f.pending = nil, nil, nil
+	f.file.Seek(0, io.SeekStart)
+}
+
+// rewind drops what was read past the last published record so it is read again
+func (f *tailedFile) rewind() {
+	f.pos = f.committed
+	f.head = f.head[:min(f.pos, int64(len(f.head)))]
+	f.partial, f.pending = nil, nil
+	f.file.Seek(f.pos, io.SeekStart)
+}
+
+// read publishes the complete records appended to a file since the last read. A final read,
+// of a rotated file, also publishes a last line without a newline.
+func (t *Tailer) read(ctx context.Context, f *tailedFile, final bool) {
+	defer t.checkpoint(f)
+
+	for {
+		n, err := f.file.Read(t.buf)
+		if n > 0 {
+			f.lastRead = time.Now()
+			if err := t.consume(ctx, f, t.buf[:n]); err != nil {
+				log.Printf("Error publishing %s: %v", f.path, err)
+				f.rewind()
+				return
+			}
+		}
+		if errors.Is(err, io.EOF) || n == 0 {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading %s: %v", f.path, err)
+			return
+		}
+	}
+
+	var err error
+	if final && len(f.partial) > 0 {
+		line := string(f.partial)
+		f.partial = nil
+		err = t.line(ctx, f, line, f.pos)
+	}
+	if err == nil && len(f.pending) > 0 && (final || time.Since(f.lastRead) >= shared.TailFlushTimeout) {
+		err = t.flush(ctx, f)
+	}
+	if err != nil {
+		log.Printf("Error publishing %s: %v", f.path, err)
+		f.rewind()
+	}
+}
+
+// consume splits data read at the file's position into lines
+func (t *Tailer) consume(ctx context.Context, f *tailedFile, data []byte) error {
+	if f.pos < shared.TailHeadSize {
+		f.head = append(f.head, data[:min(int64(len(data)), shared.TailHeadSize-f.pos)]...)
+	}
+	f.pos += int64(len(data))
+
+	start := f.pos - int64(len(f.partial)) - int64(len(data))
+	data = append(f.partial, data...)
+	f.partial = nil
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if err := t.line(ctx, f, string(bytes.TrimSuffix(data[:i], []byte("\r"))), start+int64(i)+1); err != nil {
+			return err
+		}
+		start += int64(i) + 1
+		data = data[i+1:]
+	}
+
+	// Overlong lines are cut rather than buffered without bound
+	if len(data) >= shared.TailMaxLine {
+		return t.line(ctx, f, string(data), f.pos)
+	}
+	f.partial = append([]byte(nil), data...)
+	return nil
+}
+
+// line handles one line ending at offset end, joining continuation lines into the pending
+// record when the source has a multiline pattern
+func (t *Tailer) line(ctx context.Context, f *tailedFile, line string, end int64) error {
+	if f.source.multiline == nil {
+		if strings.TrimSpace(line) == "" {
+			f.committed = end
+			return nil
+		}
+		return t.publish(ctx, f, line, end)
+	}
+
+	if len(f.pending) > 0 && f.source.multiline.MatchString(line) {
+		f.pending = append(f.pending, line)
+		f.pendingAt = end
+		return nil
+	}
+	if err := t.flush(ctx, f); err != nil {
+		return err
+	}
+	if strings.TrimSpace(line) == "" {
+		f.committed = end
+		return nil
+	}
+	f.pending = []string{line}
+	f.pendingAt = end
+	return nil
+}
+
+// flush publishes the pending multiline record
+func (t *Tailer) flush(ctx context.Context, f *tailedFile) error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	record := strings.Join(f.pending, "\n")
+	f.pending = nil
+	return t.publish(ctx, f, record, f.pendingAt)
+}
+
+// publish parses a record ending at offset end and hands it to the agent pipeline
+func (t *Tailer) publish(ctx context.Context, f *tailedFile, record string, end int64) error {
+	if err := t.publisher.Publish(ctx, f.source.parse(record, f.path, time.Now())); err != nil {
+		return err
+	}
+	f.committed = end
+	return nil
+}
+
+// checkpoint stores how far a file has been published
+func (t *Tailer) checkpoint(f *tailedFile) {
+	if f.committed == f.saved {
+		return
+	}
+	err := db.SaveTailOffset(db.TailOffset{
+		Path:     f.path,
+		Offset:   f.committed,
+		HeadSize: len(f.head),
+		HeadHash: headHash(f.head),
+	})
+	if err != nil {
+		log.Printf("Error saving checkpoint of %s: %v", f.path, err)
+		return
+	}
+	f.saved = f.committed
+}
+
+// closeAll closes the followed files
+func (t *Tailer) closeAll() {
+	for path, f := range t.files {
+		f.file.Close()
+		delete(t.files, path)
+	}
+	for _, f := range t.draining {
+		f.file.Close()
+	}
+	t.draining = nil
+}
+
+// headHash identifies a file by its first bytes
+func headHash(head []byte) string {
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,195 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tobalo/gogent/pkg/agent"
+)
+
+// TailSource is a group of files that are tailed and parsed alike
+type TailSource struct {
+	Paths         []string `json:"paths"`          // Glob patterns of the files to tail
+	Hostname      string   `json:"hostname"`       // Defaults to this machine's hostname
+	Service       string   `json:"service"`        // Defaults to the file name without its extension
+	Severity      string   `json:"severity"`       // Defaults to INFO
+	Parser        string   `json:"parser"`         // raw (the default), regex or json
+	Pattern       string   `json:"pattern"`        // Regex with named groups, for the regex parser
+	TimeLayout    string   `json:"time_layout"`    // Go layout of parsed timestamps, RFC 3339 by default
+	Multiline     string   `json:"multiline"`      // Regex matching continuation lines, which are joined to the line before
+	FromBeginning bool     `json:"from_beginning"` // Read files found at startup from the start rather than the end
+}
+
+// LoadTailSources reads tail sources from a JSON file of the form {"sources": [...]}
+func LoadTailSources(path string) ([]TailSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tail config: %w", err)
+	}
+	var cfg struct {
+		Sources []TailSource `json:"sources"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid tail config %s: %w", path, err)
+	}
+	if len(cfg.Sources) == 0 {
+		return nil, fmt.Errorf("no sources in tail config %s", path)
+	}
+	return cfg.Sources, nil
+}
+
+// tailSource is a validated TailSource with its expressions compiled
+type tailSource struct {
+	TailSource
+	pattern   *regexp.Regexp
+	multiline *regexp.Regexp
+}
+
+// compileSource validates a source and fills in its defaults
+func compileSource(src TailSource) (*tailSource, error) {
+	if len(src.Paths) == 0 {
+		return nil, fmt.Errorf("tail source has no paths")
+	}
+	for _, p := range src.Paths {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid tail path %q: %w", p, err)
+		}
+	}
+	if src.Hostname == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hostname: %w", err)
+		}
+		src.Hostname = host
+	}
+	if src.Severity == "" {
+		src.Severity = "INFO"
+	}
+
+	ts := &tailSource{TailSource: src}
+	switch src.Parser {
+	case "", "raw", "json":
+		if src.Pattern != "" {
+			return nil, fmt.Errorf("pattern given for the %q parser of %v", src.Parser, src.Paths)
+		}
+	case "regex":
+		if src.Pattern == "" {
+			return nil, fmt.Errorf("regex parser of %v needs a pattern", src.Paths)
+		}
+		pattern, err := regexp.Compile(src.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for %v: %w", src.Paths, err)
+		}
+		ts.pattern = pattern
+	default:
+		return nil, fmt.Errorf("unsupported parser %q for %v, want raw, regex or json", src.Parser, src.Paths)
+	}
+	if src.Multiline != "" {
+		multiline, err := regexp.Compile(src.Multiline)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline pattern for %v: %w", src.Paths, err)
+		}
+		ts.multiline = multiline
+	}
+	return ts, nil
+}
+
+// parse converts a record read from path into a log message. The first line is parsed;
+// continuation lines joined by the multiline pattern are appended to its message.
+func (src *tailSource) parse(record, path string, received time.Time) agent.LogMessage {
+	logMsg := agent.LogMessage{
+		Timestamp: received.Format(time.RFC3339Nano),
+		Hostname:  src.Hostname,
+		Severity:  src.Severity,
+		Service:   src.Service,
+		Message:   record,
+		Context:   map[string]interface{}{"protocol": "file", "source": path},
+	}
+	if logMsg.Service == "" {
+		logMsg.Service = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	first, rest, multiline := strings.Cut(record, "\n")
+	var fields map[string]interface{}
+	switch src.Parser {
+	case "regex":
+		fields = src.matchFields(first)
+	case "json":
+		json.Unmarshal([]byte(first), &fields)
+	}
+	if fields == nil {
+		return logMsg
+	}
+
+	logMsg.Message = first
+	for key, value := range fields {
+		s, isString := value.(string)
+		switch {
+		case isString && (key == "message" || key == "msg"):
+			logMsg.Message = s
+		case isString && (key == "severity" || key == "level"):
+			logMsg.Severity = strings.ToUpper(s)
+		case isString && (key == "hostname" || key == "host"):
+			logMsg.Hostname = s
+		case isString && (key == "service" || key == "app"):
+			logMsg.Service = s
+		case key == "timestamp" || key == "time" || key == "@timestamp":
+			if t, ok := src.parseTime(value, received); ok {
+				logMsg.Timestamp = t.Format(time.RFC3339Nano)
+			} else {
+				logMsg.Context[key] = value
+			}
+		default:
+			logMsg.Context[key] = value
+		}
+	}
+	if multiline {
+		logMsg.Message += "\n" + rest
+	}
+	return logMsg
+}
+
+// matchFields returns the named groups of the pattern that matched line, or nil if it did
+// not match
+func (src *tailSource) matchFields(line string) map[string]interface{} {
+	match := src.pattern.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	for i, name := range src.pattern.SubexpNames() {
+		if name != "" && match[i] != "" {
+			fields[name] = match[i]
+		}
+	}
+	return fields
+}
+
+// parseTime reads a timestamp string in the source's layout, or a number of Unix seconds.
+// Layouts without a year get the receive year, and layouts without a zone local time.
+func (src *tailSource) parseTime(value interface{}, received time.Time) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		sec := int64(v)
+		return time.Unix(sec, int64((v-float64(sec))*1e9)), true
+	case string:
+		layout := src.TimeLayout
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		t, err := time.ParseInLocation(layout, v, time.Local)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if t.Year() == 0 {
+			t = t.AddDate(received.Year(), 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
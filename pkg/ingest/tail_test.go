@@ -0,0 +1,180 @@
+package ingest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/tobalo/gogent/pkg/agent"
+	"github.com/tobalo/gogent/pkg/db"
+)
+
+// TestTailer follows a log file through rotation, truncation and restarts. The db package
+// keeps one connection per process, so the steps share one tailer database.
+func TestTailer(t *testing.T) {
+	if _, err := db.InitDB(filepath.Join(t.TempDir(), "tail.db")); err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	publisher, sub := startJetStream(t)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "conveyor.log")
+	sources := []TailSource{{Paths: []string{filepath.Join(dir, "*.log")}, Hostname: "plc-01"}}
+
+	write := func(name, data string, flag int) {
+		t.Helper()
+		f, err := os.OpenFile(name, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendTo := func(name, data string) { write(name, data, os.O_APPEND) }
+	newTailer := func() *Tailer {
+		t.Helper()
+		tailer, err := NewTailer(sources, publisher, time.Second)
+		if err != nil {
+			t.Fatalf("failed to create tailer: %v", err)
+		}
+		return tailer
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		var got []string
+		for _, logMsg := range published(t, sub, len(want)) {
+			got = append(got, logMsg.Message)
+			if logMsg.Service != "conveyor" || logMsg.Hostname != "plc-01" {
+				t.Errorf("published log = %+v", logMsg)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("published %q, want %q", got, want)
+		}
+		if msgs, _ := sub.Fetch(1, nats.MaxWait(100*time.Millisecond)); len(msgs) > 0 {
+			t.Errorf("also published %s", msgs[0].Data)
+		}
+	}
+
+	appendTo(path, "Belt started\n")
+	tailer := newTailer()
+
+	t.Run("starts at the end", func(t *testing.T) {
+		tailer.scan(ctx, true)
+		appendTo(path, "Belt 3 stopped\nBelt 3 ")
+		tailer.scan(ctx, false)
+		expect("Belt 3 stopped")
+		appendTo(path, "restarted\n")
+		tailer.scan(ctx, false)
+		expect("Belt 3 restarted")
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		appendTo(path, "Before rotation\n")
+		rotated := path + ".1"
+		if err := os.Rename(path, rotated); err != nil {
+			t.Fatal(err)
+		}
+		appendTo(rotated, "Last line without newline")
+		appendTo(path, "First line of the new file\n")
+		tailer.scan(ctx, false)
+		expect("Before rotation", "Last line without newline", "First line of the new file")
+	})
+
+	t.Run("truncation", func(t *testing.T) {
+		write(path, "Cut\n", os.O_TRUNC)
+		tailer.scan(ctx, false)
+		expect("Cut")
+	})
+
+	t.Run("resumes from the checkpoint", func(t *testing.T) {
+		tailer.closeAll()
+		appendTo(path, "While down 1\nWhile down 2\n")
+		tailer = newTailer()
+		tailer.scan(ctx, true)
+		expect("While down 1", "While down 2")
+	})
+
+	t.Run("replaced file is read from the start", func(t *testing.T) {
+		tailer.closeAll()
+		write(path, "Fresh file with other contents\n", os.O_TRUNC)
+		tailer = newTailer()
+		tailer.scan(ctx, true)
+		expect("Fresh file with other contents")
+		tailer.closeAll()
+	})
+}
+
+func TestTailSourceParse(t *testing.T) {
+	received := time.Date(2026, 10, 17, 8, 30, 0, 0, time.UTC)
+	path := "/var/log/historian.log"
+
+	tests := []struct {
+		name   string
+		source TailSource
+		record string
+		want   agent.LogMessage
+	}{
+		{
+			name:   "raw",
+			source: TailSource{Paths: []string{path}, Hostname: "plc-01"},
+			record: "Segment written",
+			want: agent.LogMessage{
+				Timestamp: "2026-10-17T08:30:00Z", Hostname: "plc-01", Severity: "INFO", Service: "historian",
+				Message: "Segment written", Context: map[string]interface{}{"protocol": "file", "source": path},
+			},
+		},
+		{
+			name: "regex with continuation lines",
+			source: TailSource{
+				Paths: []string{path}, Hostname: "plc-01", Service: "hist", Parser: "regex",
+				Pattern:    `^(?P<time>\S+ \S+) (?P<level>\w+) \[(?P<thread>\w+)\] (?P<message>.*)$`,
+				TimeLayout: "2006-01-02 15:04:05",
+			},
+			record: "2026-10-17 08:29:59 error [writer] Write failed\n  at segment.go:42",
+			want: agent.LogMessage{
+				Timestamp: time.Date(2026, 10, 17, 8, 29, 59, 0, time.Local).Format(time.RFC3339Nano),
+				Hostname:  "plc-01", Severity: "ERROR", Service: "hist",
+				Message: "Write failed\n  at segment.go:42",
+				Context: map[string]interface{}{"protocol": "file", "source": path, "thread": "writer"},
+			},
+		},
+		{
+			name:   "json",
+			source: TailSource{Paths: []string{path}, Hostname: "plc-01", Parser: "json"},
+			record: `{"time": 1792225800, "level": "warn", "msg": "Disk 91% full", "host": "hist-01", "disk": "/var"}`,
+			want: agent.LogMessage{
+				Timestamp: time.Unix(1792225800, 0).Format(time.RFC3339Nano),
+				Hostname:  "hist-01", Severity: "WARN", Service: "historian", Message: "Disk 91% full",
+				Context: map[string]interface{}{"protocol": "file", "source": path, "disk": "/var"},
+			},
+		},
+		{
+			name:   "unparsable line is kept raw",
+			source: TailSource{Paths: []string{path}, Hostname: "plc-01", Parser: "json"},
+			record: "not json",
+			want: agent.LogMessage{
+				Timestamp: "2026-10-17T08:30:00Z", Hostname: "plc-01", Severity: "INFO", Service: "historian",
+				Message: "not json", Context: map[string]interface{}{"protocol": "file", "source": path},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := compileSource(tt.source)
+			if err != nil {
+				t.Fatalf("compileSource() error = %v", err)
+			}
+			if got := src.parse(tt.record, path, received); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package shared
 
+import "time"
+
 // NATS Stream Constants
 const (
 	// StreamName is the name of the NATS stream
@@ -8,6 +10,63 @@ const (
 	ConsumerName = "AGENT_CONSUMER"
 	// SubjectName is the NATS subject for agent technical support messages
 	SubjectName = "agent.technical.support"
+	// FormatSubjects matches the subjects of logs in other input formats, published to
+	// agent.technical.support.<format>
+	FormatSubjects = SubjectName + ".>"
+	// FormatHeader is the message header naming the input format of a log, taking precedence
+	// over the subject suffix
+	FormatHeader = "Gogent-Format"
+	// ReplyToHeader is the message header publishers set to receive the analysis,
+	// since the JetStream reply subject is reserved for acknowledgements
+	ReplyToHeader = "Gogent-Reply-To"
+	// DLQStreamName is the name of the stream holding logs that repeatedly failed analysis
+	DLQStreamName = "AGENT_DLQ"
+	// DLQSubjectName is the NATS subject dead-lettered logs are published to
+	DLQSubjectName = "agent.dlq.technical.support"
+	// AnalysisSubjectName is the NATS subject every stored analysis is published to
+	AnalysisSubjectName = "agent.analyses"
+	// AnomalySubjectName is the NATS subject log rate anomalies are published to
+	AnomalySubjectName = "agent.anomalies"
+	// IncidentSubjectName is the NATS subject incident lifecycle events are published to
+	IncidentSubjectName = "agent.incidents"
+	// FeedbackSubjectName is the NATS request subject operators submit feedback on analyses to
+	FeedbackSubjectName = "agent.feedback"
+	// FeedbackListSubjectName is the NATS request subject stored feedback is retrieved from
+	FeedbackListSubjectName = "agent.feedback.list"
+	// LogQuerySubjectName is the NATS request subject stored logs are queried on
+	LogQuerySubjectName = "agent.logs.query"
+	// QueryServiceName and QueryServiceVersion identify the log query NATS micro service
+	QueryServiceName    = "gogent-logs"
+	QueryServiceVersion = "1.0.0"
+	// ReportSubjectName is the NATS subject shift reports are published to
+	ReportSubjectName = "agent.reports"
+	// SparkplugSubjects matches Sparkplug B messages published by MQTT clients; the MQTT
+	// gateway turns the topic spBv1.0/group/NDATA/node into spBv1//0.group.NDATA.node
+	SparkplugSubjects = "spBv1//0.>"
+	// MaxDeliveriesAdvisory is the subject prefix JetStream uses to announce exhausted deliveries
+	MaxDeliveriesAdvisory = "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES"
+)
+
+// JetStream Consumer Constants
+const (
+	// AckWait is how long the server waits for an ack before redelivering a message
+	AckWait = 90 * time.Second
+	// NakDelay is the base delay before a failed message is redelivered
+	NakDelay = 5 * time.Second
+	// AnalysisTimeout bounds a single LLM analysis
+	AnalysisTimeout = 30 * time.Second
+	// StructuredRetries is how many times a malformed JSON analysis is re-requested
+	StructuredRetries = 2
+	// BreakerThreshold is how many consecutive failures open a provider's circuit
+	BreakerThreshold = 3
+	// BreakerCooldown is how long an open circuit waits before probing the provider again
+	BreakerCooldown = time.Minute
+	// MaxDeliver is how many times a message is attempted before it is dead-lettered
+	MaxDeliver = 5
+	// Workers is the default number of concurrent analysis workers
+	Workers = 2
+	// BatchDelay is how long related logs are collected before a batch is analyzed
+	BatchDelay = 2 * time.Second
 )
 
 // NATS Configuration Constants
@@ -36,6 +95,8 @@ const (
 	ProviderClaude = "CLAUDE"
 	// ProviderDeepSeek represents the DeepSeek provider
 	ProviderDeepSeek = "DEEPSEEK"
+	// ProviderMock represents the deterministic in-process mock provider
+	ProviderMock = "MOCK"
 )
 
 // Model Names
@@ -58,6 +119,121 @@ const (
 	Provider = ProviderOllama
 	// AgentModel is the model used by the agent
 	AgentModel = ModelPhi35
+	// CacheTTL is how long an analysis is reused for logs with the same fingerprint
+	CacheTTL = time.Hour
+	// TemplateDepth is the depth of the Drain log template tree
+	TemplateDepth = 4
+	// TemplateSimilarity is the share of tokens a log must share with a template to join it
+	TemplateSimilarity = 0.5
+	// TemplateLimit is how many log templates are kept in memory, the least recently seen
+	// being forgotten beyond it
+	TemplateLimit = 10000
+	// ClusterBands is the number of MinHash LSH bands used to find near-duplicate candidates
+	ClusterBands = 16
+	// ClusterRows is the number of signature values per LSH band
+	ClusterRows = 4
+	// ClusterThreshold is the TF-IDF cosine similarity a log needs to join a cluster
+	ClusterThreshold = 0.8
+	// ClusterWindow is the number of recent logs the TF-IDF vocabulary is computed over
+	ClusterWindow = 10000
+	// ClusterLimit is how many log clusters are kept in memory, the least recently joined being
+	// forgotten beyond it
+	ClusterLimit = 10000
+	// AnomalyWindow is the width of the windows log rates are counted in
+	AnomalyWindow = 5 * time.Minute
+	// AnomalyThreshold is how many standard deviations above the baseline make a spike
+	AnomalyThreshold = 4.0
+	// AnomalyMinCount is how many logs a window needs before it can be a spike
+	AnomalyMinCount = 10
+	// AnomalyWarmup is how many windows a source needs before its spikes and silences are reported
+	AnomalyWarmup = 12
+	// AnomalySilenceExpected is how many logs must have been expected during a gap to report a silence
+	AnomalySilenceExpected = 5.0
+	// IncidentWindow is how close together correlated logs must arrive to open an incident
+	IncidentWindow = 10 * time.Minute
+	// IncidentQuiet is how long an incident must go without new logs before it is closed
+	IncidentQuiet = 15 * time.Minute
+	// IncidentMinLogs is how many correlated logs open an incident
+	IncidentMinLogs = 3
+	// IncidentCheck is how often open incidents are checked for quiet periods
+	IncidentCheck = 30 * time.Second
+	// IncidentPromptEntries is how many recent entries an incident summary prompt lists
+	IncidentPromptEntries = 20
+	// IncidentSummaryTimeout bounds an incident summary across the provider chain
+	IncidentSummaryTimeout = 2 * time.Minute
+	// HostGroupPattern extracts a host's group, e.g. "line3-plc" from "line3-plc-07"
+	HostGroupPattern = `^(.+?)[-_.]?\d+$`
+	// HistoryResults is how many similar past logs are added to a prompt
+	HistoryResults = 3
+	// HistoryTerms is the most words of a message a similar-log search uses
+	HistoryTerms = 32
+	// HistoryOversample is how many vector matches are fetched per similar log shown, since
+	// matches without an analysis of their own are skipped
+	HistoryOversample = 4
+	// EmbedModel is the default Ollama embedding model
+	EmbedModel = "nomic-embed-text"
+	// EmbedDims is the size of the hash embedder's vectors
+	EmbedDims = 256
+	// EmbedTimeout bounds a single embedding request
+	EmbedTimeout = 10 * time.Second
+	// OllamaURL is the default Ollama server address
+	OllamaURL = "http://localhost:11434"
+	// FeedbackPoorRating is the highest rating that rejects an analysis, on a scale of 1 to 5
+	FeedbackPoorRating = 2
+	// FeedbackLimit is how many feedback entries are listed by default
+	FeedbackLimit = 50
+	// FeedbackTimeout bounds a feedback request
+	FeedbackTimeout = 5 * time.Second
+	// QueryLimit is how many log entries a query returns by default, and QueryMaxLimit at most
+	QueryLimit    = 100
+	QueryMaxLimit = 1000
+	// QueryTimeout bounds a log query request
+	QueryTimeout = 10 * time.Second
+	// ReportDir is where shift reports are written
+	ReportDir = "./reports"
+	// ReportTopLogs is how many of the highest-risk entries a shift report lists
+	ReportTopLogs = 10
+	// ReportSummaryTimeout bounds a shift report's executive summary across the provider chain
+	ReportSummaryTimeout = 5 * time.Minute
+	// HTTPMaxBody bounds the body of a request to the HTTP API
+	HTTPMaxBody = 1 << 20
+	// HTTPStreamBuffer is how many analyses an event stream client may fall behind by before
+	// analyses are dropped for it
+	HTTPStreamBuffer = 256
+	// HTTPHeartbeat is how often idle event streams are sent a comment to keep proxies from
+	// closing them
+	HTTPHeartbeat = 15 * time.Second
+	// StatsRange is the time range the dashboard statistics and incidents cover by default
+	StatsRange = 24 * time.Hour
+	// StatsBucket is the default width of a dashboard histogram bucket, and StatsMaxBuckets
+	// bounds how many buckets one request may ask for
+	StatsBucket     = time.Hour
+	StatsMaxBuckets = 1000
+	// HTTPShutdownTimeout bounds how long shutdown waits for HTTP requests to finish
+	HTTPShutdownTimeout = 10 * time.Second
+	// SyslogMaxMessage bounds a received syslog message, framing included
+	SyslogMaxMessage = 64 * 1024
+	// SyslogIdleTimeout closes syslog TCP and TLS connections that stay silent this long
+	SyslogIdleTimeout = 10 * time.Minute
+	// OTLPMaxBody bounds an OTLP export request, after decompression
+	OTLPMaxBody = 4 << 20
+	// GELFMaxMessage bounds a GELF message after decompression
+	GELFMaxMessage = 1 << 20
+	// SparkplugAlarmPattern matches the names of Sparkplug metrics reported as alarms
+	SparkplugAlarmPattern = `(?i)alarm|fault|trip|error`
+	// SparkplugGoodQuality is the OPC quality code of a good metric value; metrics with any
+	// other Quality property are reported as faulty
+	SparkplugGoodQuality = 192
+	// TailPoll is how often tailed files are checked for new lines, rotation and truncation
+	TailPoll = time.Second
+	// TailMaxLine bounds a tailed line; longer lines are cut
+	TailMaxLine = 64 * 1024
+	// TailHeadSize is how many leading bytes of a tailed file identify it in its checkpoint
+	TailHeadSize = 1024
+	// TailFlushTimeout publishes a multiline record once its file has been quiet this long
+	TailFlushTimeout = 2 * time.Second
+	// PromptReload is how often the prompt template directory is checked for changes
+	PromptReload = 10 * time.Second
 	// AgentInstructions are the instructions for the agent
 	AgentInstructions = "You are a technical analyst that executes natural language reporting from technical information and raw SIGINT data. Analyze system logs and provide concise, actionable insights."
 )